@@ -1,39 +1,209 @@
 package main
 
 import (
-	"fmt"
-	"log"
+	"context"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+	// Embed the time zone database so /quotes/today?tz= works on hosts without one
+	_ "time/tzdata"
 
+	"github.com/jorge2751/GoAPI/internal/api/data"
 	"github.com/jorge2751/GoAPI/internal/api/middleware"
+	"github.com/jorge2751/GoAPI/internal/api/requestid"
 	"github.com/jorge2751/GoAPI/internal/api/routes"
+	"github.com/jorge2751/GoAPI/internal/api/server"
 )
 
 func main() {
-	// Get port from environment variable or use default
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-	}
+	// Log JSON records to stdout, tagging them with the request ID when one is in the context
+	slog.SetDefault(slog.New(requestid.NewLogHandler(slog.NewJSONHandler(os.Stdout, nil))))
 
-	// Get WeatherAPI key
-	weatherAPIKey := os.Getenv("WEATHERAPI_KEY")
-	if weatherAPIKey == "" {
-		log.Println("Warning: WEATHERAPI_KEY environment variable not set. Weather endpoint will not work.")
+	// Load server settings (port, timeouts, shutdown grace period) from the environment
+	cfg, err := server.LoadConfig(os.Getenv)
+	if err != nil {
+		slog.Error("Invalid server configuration", "error", err)
+		os.Exit(1)
 	}
 
 	// Create services
-	weatherService := routes.NewWeatherService(weatherAPIKey)
+	quoteStorePath := os.Getenv("QUOTE_STORE_PATH")
+	if quoteStorePath == "" {
+		quoteStorePath = "quotes.json"
+	}
+	// New stores start with the quotes in QUOTES_FILE, or the built-in ones
+	seed := data.DefaultQuotes()
+	if quotesFile := os.Getenv("QUOTES_FILE"); quotesFile != "" {
+		seed, err = data.LoadQuotes(quotesFile)
+		if err != nil {
+			slog.Error("Invalid quotes file", "error", err)
+			os.Exit(1)
+		}
+	}
+	quoteStore, err := data.NewQuoteStore(os.Getenv("QUOTE_STORE"), quoteStorePath, seed)
+	if err != nil {
+		slog.Error("Invalid quote store configuration", "error", err)
+		os.Exit(1)
+	}
+	quoteService := data.NewQuoteServiceWithStore(quoteStore)
+	quoteService.MaxVoters = envInt("QUOTE_MAX_VOTERS", data.DefaultMaxVoters)
+	quotes := routes.NewQuoteAPI(quoteService)
+	// VOTER_TOKENS lists the API clients allowed to vote without a cookie, as name:token pairs
+	if voterTokens := os.Getenv("VOTER_TOKENS"); voterTokens != "" {
+		quotes.VoterTokens, err = routes.ParseVoterTokens(voterTokens)
+		if err != nil {
+			slog.Error("Invalid VOTER_TOKENS", "error", err)
+			os.Exit(1)
+		}
+	}
+	// ART_DIR replaces the built-in art gallery with the .txt files in a directory
+	artService := data.NewArtService()
+	if artDir := os.Getenv("ART_DIR"); artDir != "" {
+		pieces, err := data.LoadArt(os.DirFS(artDir))
+		if err != nil {
+			slog.Error("Invalid art directory", "dir", artDir, "error", err)
+			os.Exit(1)
+		}
+		artService = data.NewArtServiceWithArt(pieces)
+	}
+	weatherService := routes.NewWeatherServiceWithProviders(weatherProviders()...)
+	weatherService.Cache = routes.NewWeatherCache(
+		envDuration("WEATHER_CACHE_TTL", routes.DefaultWeatherCacheTTL),
+		envDuration("WEATHER_CACHE_STALE", routes.DefaultWeatherCacheStale),
+		envInt("WEATHER_CACHE_MAX_ENTRIES", routes.DefaultWeatherCacheMaxEntries),
+	)
+	subscriptions := routes.NewSubscriptionManager(weatherService)
+	subscriptions.Interval = envDuration("WEATHER_SUBSCRIPTION_INTERVAL", routes.DefaultSubscriptionInterval)
+	subscriptions.Webhook.Retry.MaxAttempts = envInt("WEBHOOK_ATTEMPTS", routes.DefaultWebhookAttempts)
+	subscriptions.Webhook.AllowPrivateNetworks = envBool("WEBHOOK_ALLOW_PRIVATE_NETWORKS", false)
+	streamer := routes.NewWeatherStreamer(weatherService)
+	streamer.Interval = envDuration("WEATHER_STREAM_INTERVAL", routes.DefaultStreamInterval)
+	streamer.Heartbeat = envDuration("WEATHER_STREAM_HEARTBEAT", routes.DefaultStreamHeartbeat)
+	streamer.MaxLocations = envInt("WEATHER_STREAM_MAX_LOCATIONS", routes.DefaultStreamMaxLocations)
+	streamer.MaxSubscribers = envInt("WEATHER_STREAM_MAX_SUBSCRIBERS", routes.DefaultStreamMaxSubscribers)
 
 	// Define HTTP server
 	mux := http.NewServeMux()
 
+	// Middleware applied to every route, outermost first
+	chain := middleware.NewChain(middleware.LoggingMiddleware, middleware.RecoveryMiddleware)
+
 	// Register routes with middleware
-	routes.RegisterRoutes(mux, middleware.LoggingMiddleware, weatherService)
+	routes.RegisterRoutes(mux, chain, routes.Services{
+		Quotes:        quotes,
+		Art:           routes.NewArtAPI(artService),
+		Weather:       weatherService,
+		Subscriptions: subscriptions,
+		Streamer:      streamer,
+		Debug:         envBool("DEBUG_ENDPOINTS", false),
+	})
+
+	srv := server.New(cfg, routes.FallbackHandler(mux, chain))
+
+	// Let services release upstream resources once shutdown starts
+	srv.RegisterOnShutdown(weatherService.CloseIdleConnections)
+	// End open weather streams, which Shutdown would otherwise wait on
+	srv.RegisterOnShutdown(streamer.Close)
+
+	// Stop accepting new requests on SIGINT/SIGTERM and drain the in-flight ones
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Check weather subscriptions in the background until shutdown
+	pollerDone := make(chan struct{})
+	go func() {
+		defer close(pollerDone)
+		subscriptions.Run(ctx)
+	}()
+
+	slog.Info("Server starting", "port", cfg.Port)
+	if err := server.ListenAndServe(ctx, srv, cfg.ShutdownTimeout); err != nil {
+		slog.Error("Server error", "error", err)
+		os.Exit(1)
+	}
+	<-pollerDone
+	slog.Info("Server stopped")
+}
+
+// envDuration reads a duration from the environment, exiting on invalid values
+func envDuration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil || parsed < 0 {
+		slog.Error("Invalid duration in environment", "key", key, "value", value)
+		os.Exit(1)
+	}
+	return parsed
+}
+
+// envInt reads an integer from the environment, exiting on invalid values
+func envInt(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		slog.Error("Invalid integer in environment", "key", key, "value", value)
+		os.Exit(1)
+	}
+	return parsed
+}
+
+// envBool reads a boolean from the environment, exiting on invalid values
+func envBool(key string, fallback bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		slog.Error("Invalid boolean in environment", "key", key, "value", value)
+		os.Exit(1)
+	}
+	return parsed
+}
 
-	// Start server
-	addr := fmt.Sprintf(":%s", port)
-	fmt.Printf("Server starting on port %s...\n", port)
-	log.Fatal(http.ListenAndServe(addr, mux))
+// weatherProviders builds the primary weather provider and the optional fallback
+// from WEATHER_PROVIDER and WEATHER_FALLBACK_PROVIDER, exiting on unknown names
+func weatherProviders() []routes.WeatherProvider {
+	names := []string{os.Getenv("WEATHER_PROVIDER")}
+	if names[0] == "" {
+		names[0] = routes.ProviderWeatherAPI
+	}
+	if fallback := os.Getenv("WEATHER_FALLBACK_PROVIDER"); fallback != "" {
+		names = append(names, fallback)
+	}
+
+	// Get WeatherAPI key
+	weatherAPIKey := os.Getenv("WEATHERAPI_KEY")
+
+	providers := make([]routes.WeatherProvider, 0, len(names))
+	for _, name := range names {
+		// Each provider gets its own retry policy and circuit breaker
+		upstream := routes.NewUpstream()
+		upstream.Retry.MaxAttempts = envInt("WEATHER_RETRY_ATTEMPTS", routes.DefaultWeatherRetryAttempts)
+		upstream.Breaker = routes.NewCircuitBreaker(
+			envInt("WEATHER_BREAKER_FAILURES", routes.DefaultWeatherBreakerFailures),
+			envDuration("WEATHER_BREAKER_COOLDOWN", routes.DefaultWeatherBreakerCooldown),
+		)
+
+		provider, err := routes.NewWeatherProvider(name, weatherAPIKey, upstream)
+		if err != nil {
+			slog.Error("Invalid weather provider configuration", "error", err)
+			os.Exit(1)
+		}
+		if provider.Name() == routes.ProviderWeatherAPI && weatherAPIKey == "" {
+			slog.Warn("WEATHERAPI_KEY environment variable not set. Weather endpoint will not work.")
+		}
+		providers = append(providers, provider)
+	}
+	return providers
 }
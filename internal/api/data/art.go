@@ -1,65 +1,211 @@
 package data
 
-// Art represents an ASCII art piece with a title and content
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/rand/v2"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// ErrArtNotFound is returned when no art piece has the requested ID
+var ErrArtNotFound = errors.New("art not found")
+
+// artExtension is the file extension of art pieces
+const artExtension = ".txt"
+
+// defaultArtFS holds the built-in gallery
+//
+//go:embed art/*.txt
+var defaultArtFS embed.FS
+
+// Art represents an ASCII art piece. Width and Height are its size in characters
+// and lines.
 type Art struct {
+	ID      string `json:"id"`
 	Title   string `json:"title"`
-	Content string `json:"content"`
+	Artist  string `json:"artist,omitempty"`
+	Width   int    `json:"width"`
+	Height  int    `json:"height"`
+	Content string `json:"content,omitempty"`
+}
+
+// DefaultArt returns the built-in gallery, embedded in the binary
+func DefaultArt() []Art {
+	art, err := LoadArt(defaultArtFS)
+	if err != nil {
+		panic("built-in art: " + err.Error())
+	}
+	return art
 }
 
-// ArtService provides ASCII art functionality
+// LoadArt reads every .txt file in fsys, including subdirectories, as an art piece
+// named by its file name: m-pattern.txt is the piece "m-pattern". A file may start
+// with front matter between two "---" lines setting its title and artist:
+//
+//	---
+//	title: M Pattern
+//	artist: Someone
+//	---
+//
+// Pieces without a title are titled after their ID. The pieces are sorted by ID.
+func LoadArt(fsys fs.FS) ([]Art, error) {
+	var pieces []Art
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || path.Ext(name) != artExtension {
+			return err
+		}
+		content, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		art, err := parseArt(strings.TrimSuffix(path.Base(name), artExtension), string(content))
+		if err != nil {
+			return fmt.Errorf("art file %s: %w", name, err)
+		}
+		if slices.ContainsFunc(pieces, func(a Art) bool { return a.ID == art.ID }) {
+			return fmt.Errorf("art file %s: another file is already named %q", name, art.ID)
+		}
+		pieces = append(pieces, art)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(pieces) == 0 {
+		return nil, errors.New("no " + artExtension + " art files found")
+	}
+	slices.SortFunc(pieces, func(a, b Art) int { return strings.Compare(a.ID, b.ID) })
+	return pieces, nil
+}
+
+// parseArt reads an art file's optional front matter and measures its content
+func parseArt(id, file string) (Art, error) {
+	if !validArtID(id) {
+		return Art{}, fmt.Errorf("file name %q must be lowercase letters, digits and hyphens, and not %q", id, "random")
+	}
+	art := Art{ID: id}
+
+	lines := strings.Split(strings.ReplaceAll(file, "\r\n", "\n"), "\n")
+	if lines[0] == "---" {
+		end := slices.Index(lines[1:], "---") + 1
+		if end == 0 {
+			return Art{}, errors.New(`front matter must end with a "---" line`)
+		}
+		for _, line := range lines[1:end] {
+			key, value, ok := strings.Cut(line, ":")
+			if !ok {
+				return Art{}, fmt.Errorf(`front matter line %q must be "key: value"`, line)
+			}
+			switch strings.TrimSpace(key) {
+			case "title":
+				art.Title = strings.TrimSpace(value)
+			case "artist":
+				art.Artist = strings.TrimSpace(value)
+			default:
+				return Art{}, fmt.Errorf("unknown front matter key %q", strings.TrimSpace(key))
+			}
+		}
+		lines = lines[end+1:]
+	}
+	if art.Title == "" {
+		art.Title = artTitle(id)
+	}
+
+	art.Content = strings.TrimRight(strings.Join(lines, "\n"), "\n")
+	if strings.TrimSpace(art.Content) == "" {
+		return Art{}, errors.New("art is empty")
+	}
+	if !utf8.ValidString(art.Content) {
+		return Art{}, errors.New("art must be UTF-8 text")
+	}
+	for _, line := range strings.Split(art.Content, "\n") {
+		art.Width = max(art.Width, utf8.RuneCountInString(line))
+		art.Height++
+	}
+	return art, nil
+}
+
+// validArtID reports whether id can name an art piece. "random" is taken by the
+// /art/random route.
+func validArtID(id string) bool {
+	if id == "" || id == "random" {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// artTitle makes a title from an ID: "m-pattern" becomes "M Pattern"
+func artTitle(id string) string {
+	words := strings.FieldsFunc(id, func(r rune) bool { return r == '-' })
+	for i, word := range words {
+		words[i] = strings.ToUpper(word[:1]) + word[1:]
+	}
+	return strings.Join(words, " ")
+}
+
+// ArtService serves a fixed gallery of ASCII art. It is safe for concurrent use.
 type ArtService struct {
-	art Art
+	pieces []Art
+
+	// mu guards r, which is not safe for concurrent use
+	mu sync.Mutex
+	r  *rand.Rand
 }
 
-// NewArtService creates a new ArtService with the predefined artwork
+// NewArtService creates a new ArtService with the built-in gallery
 func NewArtService() *ArtService {
-	// Define our ASCII art
-	art := Art{
-		Title: "M Pattern",
-		Content: `MMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMM
-MMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMM
-MMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMM
-MMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMM
-MMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMM
-MMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMM
-MMMMMMMMMMMMMMMMMMMMMMMMMMMWKkolc:cclldOKNWMMMMMMMMMMMMMMMMMMMMMMMMMMMMM
-MMMMMMMMMMMMMMMMMMMMMMMMMXx;.           .';lxOKNWMMMMMMMMMMMMMMMMMMMMMMM
-MMMMMMMMMMMMMMMMMMMMMMMWO,                    .';coxkO0XWMMMMMMMMMMMMMMM
-MMMMMMMMMMMMMMMMMMMMMMM0'                             .dNMMMMMMMMMMMMMMM
-MMMMMMMMMMMMMMMMMMMMMMWd.                            .oNMMMMMMMMMMMMMMMM
-MMMMMMMMMMMMMMMMMMMXOdo;  ..                        .oNMMMMMMMMMMMMMMMMM
-MMMMMMMMMMMMMMMMMWk,    .lKO:.                       .dNMMMMMMMMMMMMMMMM
-MMMMMMMMMMMMMMMMMO'    .dNMMW0d;.                     .OMMMMMMMMMMMMMMMM
-MMMMMMMMMMMMMMMMMx.   .dWMMMMMMWXOxollccccloxk:       .xMMMMMMMMMMMMMMMM
-MMMMMMMMMMMMMMMMMk.   :XMMMMMMMMMMMMWWNXKXXWMMO'      'OMMMMMMMMMMMMMMMM
-MMMMMMMMMMMMMMMMMX:  .oOkxdoodkkk0NOoc;,,;:cdkx:      :XMMMMMMMMMMMMMMMM
-MMMMMMMMMMMMMMMMNk:'. .,okkkkkkOo;,;,o000OOO000O; .dOdlxNMMMMMMMMMMMMMMM
-MMMMMMMMMMMMMMMWdcOXl  oWN0kddxxc';;.cxlcdxxXMMK; .xMM0lkMMMMMMMMMMMMMMM
-MMMMMMMMMMMMMMMXldWWo  :KXOdclkd',0kc:dkkXNXNNNo.  oWMKcxMMMMMMMMMMMMMMM
-MMMMMMMMMMMMMMMWkl0Wx. ,xkkkkkkl;xWWXOxOOOOOOOc.   lXOloXMMMMMMMMMMMMMMM
-MMMMMMMMMMMMMMMMW0xOk' oNWWWWWXdkNMMMMMMMMMMMWo    'clkNMMMMMMMMMMMMMMMM
-MMMMMMMMMMMMMMMMMMWNXc .:kNWXOo;cdoccccldOXWXk;   .c0WMMMMMMMMMMMMMMMMMM
-MMMMMMMMMMMMMMMMMMMMM0'  .,;.....   ..'''.',.     cXMMMMMMMMMMMMMMMMMMMM
-MMMMMMMMMMMMMMMMMMMMMWx.   .d0KKOoclodONN0:      :KMMMMMMMMMMMMMMMMMMMMM
-MMMMMMMMMMMMMMMMMMMMMMWx.  ;KMMWKOkxxOXMWXc    .cXMMMMMMMMMMMMMMMMMMMMMM
-MMMMMMMMMMMMMMMMMMMMMMMWO;  'coddc;;:cll:.    ,kNMMMMMMMMMMMMMMMMMMMMMMM
-MMMMMMMMMMMMMMMMMMMMMMMMMNk:.              .:kNMMMMMMMMMMMMMMMMMMMMMMMMM
-MMMMMMMMMMMMMMMMMMMMMMMMMMMWKxc,..    ..,cxKWMMMMMMMMMMMMMMMMMMMMMMMMMMM
-MMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMWXK0000KXWMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMM
-MMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMM
-MMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMM
-MMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMM
-MMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMM
-MMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMM
-MMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMM`,
+	return NewArtServiceWithArt(DefaultArt())
+}
+
+// NewArtServiceWithArt creates a new ArtService serving pieces, picking random pieces
+// from a randomly seeded source
+func NewArtServiceWithArt(pieces []Art) *ArtService {
+	return NewArtServiceWithSource(pieces, rand.NewPCG(rand.Uint64(), rand.Uint64()))
+}
+
+// NewArtServiceWithSource creates a new ArtService serving pieces that picks random
+// pieces from source, so a fixed seed gives a repeatable sequence
+func NewArtServiceWithSource(pieces []Art, source rand.Source) *ArtService {
+	return &ArtService{pieces: slices.Clone(pieces), r: rand.New(source)}
+}
+
+// List returns every piece in ID order, without its content
+func (as *ArtService) List() []Art {
+	list := make([]Art, len(as.pieces))
+	for i, art := range as.pieces {
+		art.Content = ""
+		list[i] = art
 	}
+	return list
+}
 
-	return &ArtService{
-		art: art,
+// Get returns the piece with the given ID
+func (as *ArtService) Get(id string) (Art, error) {
+	i := slices.IndexFunc(as.pieces, func(a Art) bool { return a.ID == id })
+	if i < 0 {
+		return Art{}, ErrArtNotFound
 	}
+	return as.pieces[i], nil
 }
 
-// GetArt returns the ASCII art
-func (as *ArtService) GetArt() Art {
-	return as.art
+// Random returns a random piece, or ErrArtNotFound when the gallery is empty
+func (as *ArtService) Random() (Art, error) {
+	if len(as.pieces) == 0 {
+		return Art{}, ErrArtNotFound
+	}
+	as.mu.Lock()
+	i := as.r.IntN(len(as.pieces))
+	as.mu.Unlock()
+	return as.pieces[i], nil
 }
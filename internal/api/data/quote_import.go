@@ -0,0 +1,100 @@
+package data
+
+import (
+	"errors"
+	"strings"
+)
+
+// ImportReport describes the outcome of a quote import. Rows are numbered from 1
+// in the order they appear in the imported file.
+type ImportReport struct {
+	DryRun bool `json:"dry_run"`
+	Rows   int  `json:"rows"`
+	// Created holds the new quotes; in a dry run they have no IDs yet
+	Created    []Quote           `json:"created"`
+	Duplicates []ImportDuplicate `json:"duplicates"`
+	Errors     []ImportError     `json:"errors"`
+}
+
+// ImportDuplicate is a row skipped because its quote is already in the collection
+// or earlier in the same import
+type ImportDuplicate struct {
+	Row    int    `json:"row"`
+	Text   string `json:"text"`
+	Author string `json:"author"`
+	// ExistingID is the ID of the stored quote; it is empty for a repeat within the import
+	ExistingID string `json:"existing_id,omitempty"`
+}
+
+// ImportError is a row skipped because it failed validation
+type ImportError struct {
+	Row     int    `json:"row"`
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Import adds the valid quotes in rows that are not already in the collection.
+// Quotes are duplicates when their text and author match ignoring case and
+// whitespace. The quotes are stored in one change, so if storing fails an error is
+// returned and nothing is added. With dryRun the report is computed but nothing
+// is stored.
+func (qs *QuoteService) Import(rows []Quote, dryRun bool) (ImportReport, error) {
+	// Serialize imports so concurrent ones cannot both add the same quote
+	qs.importMu.Lock()
+	defer qs.importMu.Unlock()
+
+	report := ImportReport{
+		DryRun:     dryRun,
+		Rows:       len(rows),
+		Created:    []Quote{},
+		Duplicates: []ImportDuplicate{},
+		Errors:     []ImportError{},
+	}
+
+	existing, err := qs.store.List()
+	if err != nil {
+		return ImportReport{}, err
+	}
+	seen := make(map[string]string, len(existing)+len(rows))
+	for _, q := range existing {
+		seen[quoteKey(q)] = q.ID
+	}
+
+	for i, row := range rows {
+		q, err := row.Validate()
+		if err != nil {
+			rowErr := ImportError{Row: i + 1, Message: err.Error()}
+			var validationErr *ValidationError
+			if errors.As(err, &validationErr) {
+				rowErr.Field, rowErr.Message = validationErr.Field, validationErr.Message
+			}
+			report.Errors = append(report.Errors, rowErr)
+			continue
+		}
+
+		key := quoteKey(q)
+		if id, ok := seen[key]; ok {
+			report.Duplicates = append(report.Duplicates, ImportDuplicate{Row: i + 1, Text: q.Text, Author: q.Author, ExistingID: id})
+			continue
+		}
+		seen[key] = ""
+
+		q.ID = ""
+		report.Created = append(report.Created, q)
+	}
+
+	if !dryRun && len(report.Created) > 0 {
+		if report.Created, err = qs.store.CreateMany(report.Created); err != nil {
+			return ImportReport{}, err
+		}
+	}
+	return report, nil
+}
+
+// quoteKey identifies a quote by its text and author, ignoring case and whitespace
+func quoteKey(q Quote) string {
+	normalize := func(s string) string {
+		return strings.ToLower(strings.Join(strings.Fields(s), " "))
+	}
+	return normalize(q.Text) + "\x00" + normalize(q.Author)
+}
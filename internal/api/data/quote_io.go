@@ -0,0 +1,583 @@
+package data
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Quote file formats
+const (
+	QuoteFormatJSON = "json"
+	QuoteFormatCSV  = "csv"
+	QuoteFormatYAML = "yaml"
+)
+
+// quoteTagSeparator separates tags within a CSV field
+const quoteTagSeparator = ";"
+
+// csvTranslationPrefix starts the names of CSV columns holding translations, such as text_es
+const csvTranslationPrefix = "text_"
+
+// csvFormulaPrefixes are the characters that make spreadsheets read a cell as a formula
+const csvFormulaPrefixes = "=+-@\t\r"
+
+// csvQuoteHeader is the header row written by EncodeQuotes, followed by one
+// translation column per language
+var csvQuoteHeader = []string{"id", "text", "author", "tags", "language"}
+
+// ValidQuoteFormat reports whether format is a supported quote file format
+func ValidQuoteFormat(format string) bool {
+	switch format {
+	case QuoteFormatJSON, QuoteFormatCSV, QuoteFormatYAML:
+		return true
+	}
+	return false
+}
+
+// QuoteFormatFromPath returns the quote file format for path's extension, or ""
+func QuoteFormatFromPath(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return QuoteFormatJSON
+	case ".csv":
+		return QuoteFormatCSV
+	case ".yaml", ".yml":
+		return QuoteFormatYAML
+	}
+	return ""
+}
+
+// LoadQuotes reads and validates the quotes in the file at path, in the format given
+// by its extension. It fails on the first invalid quote.
+func LoadQuotes(path string) ([]Quote, error) {
+	format := QuoteFormatFromPath(path)
+	if format == "" {
+		return nil, fmt.Errorf("quote file %s: extension must be .json, .csv, .yaml or .yml", path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	quotes, err := DecodeQuotes(f, format)
+	if err != nil {
+		return nil, fmt.Errorf("quote file %s: %w", path, err)
+	}
+	for i, q := range quotes {
+		if quotes[i], err = q.Validate(); err != nil {
+			return nil, fmt.Errorf("quote file %s: row %d: %w", path, i+1, err)
+		}
+	}
+	return quotes, nil
+}
+
+// EncodeQuotes writes quotes to w in format
+func EncodeQuotes(w io.Writer, format string, quotes []Quote) error {
+	switch format {
+	case QuoteFormatJSON:
+		if quotes == nil {
+			quotes = []Quote{}
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(quotes)
+
+	case QuoteFormatCSV:
+		var languages []string
+		for _, q := range quotes {
+			for lang := range q.Translations {
+				if !slices.Contains(languages, lang) {
+					languages = append(languages, lang)
+				}
+			}
+		}
+		slices.Sort(languages)
+
+		writer := csv.NewWriter(w)
+		header := slices.Clone(csvQuoteHeader)
+		for _, lang := range languages {
+			header = append(header, csvTranslationPrefix+lang)
+		}
+		writer.Write(header)
+		for _, q := range quotes {
+			record := []string{q.ID, q.Text, q.Author, strings.Join(q.Tags, quoteTagSeparator), q.Language}
+			for _, lang := range languages {
+				record = append(record, q.Translations[lang])
+			}
+			for i, cell := range record {
+				record[i] = csvEscapeFormula(cell)
+			}
+			writer.Write(record)
+		}
+		writer.Flush()
+		return writer.Error()
+
+	case QuoteFormatYAML:
+		return encodeQuotesYAML(w, quotes)
+	}
+	return fmt.Errorf("unsupported quote format %q", format)
+}
+
+// DecodeQuotes reads quotes in format from r. It fails on malformed documents but
+// does not validate the quotes; IDs are read but not checked.
+func DecodeQuotes(r io.Reader, format string) ([]Quote, error) {
+	switch format {
+	case QuoteFormatJSON:
+		var quotes []Quote
+		decoder := json.NewDecoder(r)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&quotes); err != nil {
+			return nil, fmt.Errorf("invalid JSON: expected an array of quotes: %w", err)
+		}
+		return quotes, nil
+
+	case QuoteFormatCSV:
+		return decodeQuotesCSV(r)
+
+	case QuoteFormatYAML:
+		return decodeQuotesYAML(r)
+	}
+	return nil, fmt.Errorf("unsupported quote format %q", format)
+}
+
+// csvNeedsFormulaEscape reports whether a spreadsheet could read cell as a formula,
+// directly or once the ' added by csvEscapeFormula is removed
+func csvNeedsFormulaEscape(cell string) bool {
+	for strings.HasPrefix(cell, "'") {
+		cell = cell[1:]
+	}
+	return cell != "" && strings.IndexByte(csvFormulaPrefixes, cell[0]) >= 0
+}
+
+// csvEscapeFormula prefixes cell with ' when a spreadsheet would read it as a formula
+func csvEscapeFormula(cell string) string {
+	if csvNeedsFormulaEscape(cell) {
+		return "'" + cell
+	}
+	return cell
+}
+
+// csvUnescapeFormula removes the ' added by csvEscapeFormula
+func csvUnescapeFormula(cell string) string {
+	if rest, ok := strings.CutPrefix(cell, "'"); ok && csvNeedsFormulaEscape(rest) {
+		return rest
+	}
+	return cell
+}
+
+// decodeQuotesCSV reads a CSV file whose header names the text, author and
+// optional id, tags, language and text_<language> columns, in any order and
+// case. Empty translation cells are skipped, and a ' the export put before a
+// cell starting with a formula character is removed.
+func decodeQuotesCSV(r io.Reader) ([]Quote, error) {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("invalid CSV: missing header row")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+
+	columns := map[string]int{}
+	translations := map[string]int{}
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		if len(name) > len(csvTranslationPrefix) && strings.EqualFold(name[:len(csvTranslationPrefix)], csvTranslationPrefix) {
+			translations[name[len(csvTranslationPrefix):]] = i
+			continue
+		}
+		name = strings.ToLower(name)
+		if !slices.Contains(csvQuoteHeader, name) {
+			return nil, fmt.Errorf("invalid CSV: unknown column %q", name)
+		}
+		columns[name] = i
+	}
+	for _, required := range []string{"text", "author"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("invalid CSV: missing %q column", required)
+		}
+	}
+
+	var quotes []Quote
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return quotes, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+		for i, cell := range record {
+			record[i] = csvUnescapeFormula(cell)
+		}
+
+		q := Quote{Text: record[columns["text"]], Author: record[columns["author"]]}
+		if i, ok := columns["id"]; ok {
+			q.ID = record[i]
+		}
+		if i, ok := columns["tags"]; ok && strings.TrimSpace(record[i]) != "" {
+			q.Tags = strings.Split(record[i], quoteTagSeparator)
+		}
+		if i, ok := columns["language"]; ok {
+			q.Language = record[i]
+		}
+		for lang, i := range translations {
+			if strings.TrimSpace(record[i]) == "" {
+				continue
+			}
+			if q.Translations == nil {
+				q.Translations = map[string]string{}
+			}
+			q.Translations[lang] = record[i]
+		}
+		quotes = append(quotes, q)
+	}
+}
+
+// encodeQuotesYAML writes quotes as a YAML sequence of mappings with double-quoted strings
+func encodeQuotesYAML(w io.Writer, quotes []Quote) error {
+	bw := bufio.NewWriter(w)
+	if len(quotes) == 0 {
+		bw.WriteString("[]\n")
+	}
+	for _, q := range quotes {
+		tags := make([]string, len(q.Tags))
+		for i, tag := range q.Tags {
+			tags[i] = yamlQuote(tag)
+		}
+		fmt.Fprintf(bw, "- id: %s\n  text: %s\n  author: %s\n  tags: [%s]\n  language: %s\n",
+			yamlQuote(q.ID), yamlQuote(q.Text), yamlQuote(q.Author), strings.Join(tags, ", "), yamlQuote(q.Language))
+		if len(q.Translations) > 0 {
+			bw.WriteString("  translations:\n")
+			for _, lang := range slices.Sorted(maps.Keys(q.Translations)) {
+				fmt.Fprintf(bw, "    %s: %s\n", yamlQuote(lang), yamlQuote(q.Translations[lang]))
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// yamlQuote returns s as a YAML double-quoted scalar. Quotes, backslashes and
+// unprintable characters are escaped with the escapes yamlUnquote reads, and invalid
+// UTF-8 is replaced with U+FFFD, since YAML strings cannot hold it.
+func yamlQuote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, c := range strings.ToValidUTF8(s, string(utf8.RuneError)) {
+		switch c {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			switch {
+			case c == ' ' || unicode.IsPrint(c):
+				b.WriteRune(c)
+			case c <= 0xff:
+				fmt.Fprintf(&b, `\x%02x`, c)
+			case c <= 0xffff:
+				fmt.Fprintf(&b, `\u%04x`, c)
+			default:
+				fmt.Fprintf(&b, `\U%08x`, c)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// yamlEscapes maps the single-character escapes of YAML double-quoted scalars to
+// the characters they stand for
+var yamlEscapes = map[byte]rune{
+	'0': 0, 'a': '\a', 'b': '\b', 't': '\t', '\t': '\t', 'n': '\n', 'v': '\v', 'f': '\f',
+	'r': '\r', 'e': 0x1b, ' ': ' ', '"': '"', '/': '/', '\\': '\\',
+	'N': 0x85, '_': 0xa0, 'L': 0x2028, 'P': 0x2029,
+}
+
+// yamlEscapeDigits maps the escapes of YAML double-quoted scalars that are followed
+// by a hexadecimal code point to its number of digits
+var yamlEscapeDigits = map[byte]int{'x': 2, 'u': 4, 'U': 8}
+
+// yamlUnquote parses a YAML double-quoted scalar on a single line, accepting every
+// escape YAML 1.2 defines: the single-character ones in yamlEscapes and \xXX,
+// \uXXXX and \UXXXXXXXX code points
+func yamlUnquote(s string) (string, error) {
+	invalid := fmt.Errorf("invalid double-quoted string %s", s)
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return "", invalid
+	}
+
+	var b strings.Builder
+	for i := 1; i < len(s)-1; i++ {
+		switch c := s[i]; c {
+		case '"':
+			return "", invalid // Unescaped quote before the end
+		case '\\':
+			i++
+			if i == len(s)-1 {
+				return "", invalid
+			}
+			if r, ok := yamlEscapes[s[i]]; ok {
+				b.WriteRune(r)
+				continue
+			}
+			digits := yamlEscapeDigits[s[i]]
+			if digits == 0 || i+digits >= len(s) {
+				return "", invalid
+			}
+			code, err := strconv.ParseUint(s[i+1:i+1+digits], 16, 32)
+			if err != nil || !utf8.ValidRune(rune(code)) {
+				return "", invalid
+			}
+			b.WriteRune(rune(code))
+			i += digits
+		default:
+			b.WriteByte(c)
+		}
+	}
+	if !utf8.ValidString(b.String()) {
+		return "", invalid
+	}
+	return b.String(), nil
+}
+
+// YAML blocks that continue over the lines after their key
+const (
+	yamlNoBlock = iota
+	yamlTagsBlock
+	yamlTranslationsBlock
+)
+
+// decodeQuotesYAML reads the YAML subset written by encodeQuotesYAML: a sequence of
+// mappings with id, text, author, tags, language and translations keys, whose values
+// are plain, single- or double-quoted scalars, whose tags are a flow ([a, b]) or block
+// sequence and whose translations are a block mapping of language tags to text.
+// Double-quoted scalars must fit on one line but may use any YAML escape.
+// Comments must be on their own line; anchors, tags and block scalars are not supported.
+func decodeQuotesYAML(r io.Reader) ([]Quote, error) {
+	var (
+		quotes      []Quote
+		cur         *Quote
+		itemIndent  = -1
+		fieldIndent = -1 // Indentation of the current quote's keys
+		block       = yamlNoBlock
+	)
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		raw := scanner.Text()
+		content := strings.TrimSpace(raw)
+		if content == "" || strings.HasPrefix(content, "#") || content == "---" {
+			continue
+		}
+		if strings.HasPrefix(strings.TrimLeft(raw, " "), "\t") {
+			return nil, fmt.Errorf("invalid YAML: line %d: tabs are not allowed for indentation", line)
+		}
+		indent := len(raw) - len(strings.TrimLeft(raw, " "))
+		lineErr := func(msg string) error {
+			return fmt.Errorf("invalid YAML: line %d: %s", line, msg)
+		}
+
+		if cur == nil && content == "[]" {
+			continue // Empty sequence
+		}
+
+		item, isItem := strings.CutPrefix(content, "-")
+		isItem = isItem && (item == "" || item[0] == ' ')
+		switch {
+		case isItem && (itemIndent < 0 || indent == itemIndent):
+			itemIndent = indent
+			quotes = append(quotes, Quote{})
+			cur = &quotes[len(quotes)-1]
+			block = yamlNoBlock
+			fieldIndent = indent + 1 + len(item) - len(strings.TrimLeft(item, " "))
+			item = strings.TrimSpace(item)
+			if item == "" {
+				fieldIndent = -1 // Set by the first key line
+				continue
+			}
+			var err error
+			if block, err = setYAMLField(cur, item); err != nil {
+				return nil, lineErr(err.Error())
+			}
+
+		case isItem && block == yamlTagsBlock && indent > itemIndent:
+			tag, err := yamlScalar(strings.TrimSpace(item))
+			if err != nil {
+				return nil, lineErr(err.Error())
+			}
+			cur.Tags = append(cur.Tags, tag)
+
+		case block == yamlTranslationsBlock && indent > fieldIndent:
+			lang, text, err := yamlKeyValue(content)
+			if err == nil {
+				lang, err = yamlScalar(lang)
+			}
+			if err == nil {
+				text, err = yamlScalar(text)
+			}
+			if err != nil {
+				return nil, lineErr(err.Error())
+			}
+			cur.Translations[lang] = text
+
+		case cur != nil && indent > itemIndent:
+			if fieldIndent < 0 {
+				fieldIndent = indent
+			}
+			var err error
+			if block, err = setYAMLField(cur, content); err != nil {
+				return nil, lineErr(err.Error())
+			}
+
+		default:
+			return nil, lineErr("expected a list of quotes (\"- text: ...\")")
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return quotes, nil
+}
+
+// yamlKeyValue splits a "key: value" line
+func yamlKeyValue(content string) (string, string, error) {
+	key, value, ok := strings.Cut(content, ":")
+	if !ok || (value != "" && value[0] != ' ') {
+		return "", "", errors.New(`expected "key: value"`)
+	}
+	return strings.TrimSpace(key), strings.TrimSpace(value), nil
+}
+
+// setYAMLField sets the field named by a "key: value" line. It returns the block
+// the line opens, if any: a sequence of tags or a mapping of translations.
+func setYAMLField(q *Quote, content string) (int, error) {
+	key, value, err := yamlKeyValue(content)
+	if err != nil {
+		return yamlNoBlock, err
+	}
+
+	switch key {
+	case "tags":
+		if value == "" {
+			q.Tags = []string{}
+			return yamlTagsBlock, nil
+		}
+		tags, err := yamlFlowSequence(value)
+		q.Tags = tags
+		return yamlNoBlock, err
+	case "translations":
+		q.Translations = map[string]string{}
+		if value == "" {
+			return yamlTranslationsBlock, nil
+		}
+		if value != "{}" {
+			return yamlNoBlock, errors.New("translations must be a mapping of language tags to text, one per line")
+		}
+		return yamlNoBlock, nil
+	}
+
+	scalar, err := yamlScalar(value)
+	if err != nil {
+		return yamlNoBlock, err
+	}
+	switch key {
+	case "id":
+		q.ID = scalar
+	case "text":
+		q.Text = scalar
+	case "author":
+		q.Author = scalar
+	case "language":
+		q.Language = scalar
+	default:
+		return yamlNoBlock, fmt.Errorf("unknown key %q", key)
+	}
+	return yamlNoBlock, nil
+}
+
+// yamlScalar parses a plain, single-quoted or double-quoted scalar
+func yamlScalar(s string) (string, error) {
+	switch {
+	case strings.HasPrefix(s, `"`):
+		return yamlUnquote(s)
+	case strings.HasPrefix(s, "'"):
+		if len(s) < 2 || !strings.HasSuffix(s, "'") {
+			return "", fmt.Errorf("unterminated single-quoted string %s", s)
+		}
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	case strings.HasPrefix(s, "|") || strings.HasPrefix(s, ">"):
+		return "", errors.New("block scalars are not supported; use a quoted string")
+	case strings.HasPrefix(s, "&") || strings.HasPrefix(s, "*") || strings.HasPrefix(s, "!"):
+		return "", errors.New("anchors, aliases and tags are not supported")
+	case s == "~" || s == "null":
+		return "", nil
+	}
+	return s, nil
+}
+
+// yamlFlowSequence parses a flow sequence of scalars such as [a, "b, c"]
+func yamlFlowSequence(s string) ([]string, error) {
+	if !strings.HasPrefix(s, "[") || !strings.HasSuffix(s, "]") {
+		return nil, errors.New("tags must be a sequence such as [life, time]")
+	}
+	inner := strings.TrimSpace(s[1 : len(s)-1])
+	items := []string{}
+	if inner == "" {
+		return items, nil
+	}
+
+	// Split on commas outside quotes
+	var quote rune
+	escaped := false
+	start := 0
+	var parts []string
+	for i, c := range inner {
+		switch {
+		case escaped:
+			escaped = false
+		case quote == '"' && c == '\\':
+			escaped = true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			parts = append(parts, inner[start:i])
+			start = i + 1
+		}
+	}
+	parts = append(parts, inner[start:])
+
+	for _, part := range parts {
+		item, err := yamlScalar(strings.TrimSpace(part))
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
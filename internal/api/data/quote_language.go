@@ -0,0 +1,154 @@
+package data
+
+import (
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultQuoteLanguage is the language of quotes that do not name one, and the
+// fallback when a quote has no translation in any requested language
+const DefaultQuoteLanguage = "en"
+
+// MaxQuoteTranslations caps the number of translations per quote
+const MaxQuoteTranslations = 20
+
+// NormalizeLanguage returns a BCP 47 language tag in canonical case ("pt-BR",
+// "zh-Hant"), accepting "_" as a separator. It returns "" when tag is not a
+// well-formed language tag.
+func NormalizeLanguage(tag string) string {
+	subtags := strings.FieldsFunc(strings.TrimSpace(tag), func(r rune) bool { return r == '-' || r == '_' })
+	if len(subtags) == 0 || strings.Count(tag, "-")+strings.Count(tag, "_") != len(subtags)-1 {
+		return ""
+	}
+	for i, sub := range subtags {
+		if !isASCIIAlphanumeric(sub) || len(sub) > 8 {
+			return ""
+		}
+		sub = strings.ToLower(sub)
+		switch {
+		case i == 0:
+			// The primary language is two or three letters
+			if len(sub) < 2 || len(sub) > 3 || strings.ContainsAny(sub, "0123456789") {
+				return ""
+			}
+		case len(sub) == 2 && !strings.ContainsAny(sub, "0123456789"):
+			sub = strings.ToUpper(sub) // Region
+		case len(sub) == 4 && !strings.ContainsAny(sub, "0123456789"):
+			sub = strings.ToUpper(sub[:1]) + sub[1:] // Script
+		}
+		subtags[i] = sub
+	}
+	return strings.Join(subtags, "-")
+}
+
+func isASCIIAlphanumeric(s string) bool {
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// validateLanguages normalizes the quote's language and translations, giving quotes
+// without a language DefaultQuoteLanguage
+func (q Quote) validateLanguages() (Quote, error) {
+	if strings.TrimSpace(q.Language) == "" {
+		q.Language = DefaultQuoteLanguage
+	} else if q.Language = NormalizeLanguage(q.Language); q.Language == "" {
+		return Quote{}, &ValidationError{Field: "language", Message: "Field 'language' must be a language tag such as 'en' or 'es-MX'"}
+	}
+
+	if len(q.Translations) == 0 {
+		q.Translations = nil
+		return q, nil
+	}
+	if len(q.Translations) > MaxQuoteTranslations {
+		return Quote{}, &ValidationError{Field: "translations",
+			Message: "Field 'translations' may hold at most " + strconv.Itoa(MaxQuoteTranslations) + " translations"}
+	}
+	translations := make(map[string]string, len(q.Translations))
+	for lang, text := range q.Translations {
+		tag := NormalizeLanguage(lang)
+		if tag == "" {
+			return Quote{}, &ValidationError{Field: "translations", Message: "Translation language '" + lang + "' is not a language tag"}
+		}
+		if tag == q.Language {
+			return Quote{}, &ValidationError{Field: "translations", Message: "Translation language '" + lang + "' is the quote's own language"}
+		}
+		if _, ok := translations[tag]; ok {
+			return Quote{}, &ValidationError{Field: "translations", Message: "Translation language '" + tag + "' is given more than once"}
+		}
+		text = strings.TrimSpace(text)
+		if text == "" || utf8.RuneCountInString(text) > MaxQuoteTextLength {
+			return Quote{}, &ValidationError{Field: "translations",
+				Message: "Translation '" + tag + "' must be 1 to " + strconv.Itoa(MaxQuoteTextLength) + " characters"}
+		}
+		translations[tag] = text
+	}
+	q.Translations = translations
+	return q, nil
+}
+
+// Languages returns the languages the quote can be read in, its own first and
+// then its translations in order
+func (q Quote) Languages() []string {
+	own := q.Language
+	if own == "" {
+		own = DefaultQuoteLanguage
+	}
+	return append([]string{own}, slices.Sorted(maps.Keys(q.Translations))...)
+}
+
+// In returns the quote in lang, one of its Languages, without its other translations
+func (q Quote) In(lang string) Quote {
+	if text, ok := q.Translations[lang]; ok {
+		q.Text = text
+		q.Language = lang
+	} else if q.Language == "" {
+		q.Language = DefaultQuoteLanguage
+	}
+	q.Translations = nil
+	return q
+}
+
+// MatchLanguage returns the language of the quote that best matches the ranked
+// preferences, which are language tags or "*" for any. A preference matches its
+// own tag, then its more general forms ("es-MX" then "es"), then any regional
+// variant of its language ("es" matches "es-AR"). Without a match it falls back to
+// DefaultQuoteLanguage and then to the quote's own language.
+func (q Quote) MatchLanguage(preferences []string) string {
+	available := q.Languages()
+	has := func(tag string) bool {
+		return slices.ContainsFunc(available, func(lang string) bool { return strings.EqualFold(lang, tag) })
+	}
+
+	for _, pref := range preferences {
+		if pref == "*" {
+			return available[0]
+		}
+		for tag := pref; tag != ""; {
+			if i := slices.IndexFunc(available, func(lang string) bool { return strings.EqualFold(lang, tag) }); i >= 0 {
+				return available[i]
+			}
+			cut := strings.LastIndex(tag, "-")
+			if cut < 0 {
+				break
+			}
+			tag = tag[:cut]
+		}
+		base, _, _ := strings.Cut(pref, "-")
+		for _, lang := range available {
+			if langBase, _, _ := strings.Cut(lang, "-"); strings.EqualFold(langBase, base) {
+				return lang
+			}
+		}
+	}
+	if has(DefaultQuoteLanguage) {
+		return DefaultQuoteLanguage
+	}
+	return available[0]
+}
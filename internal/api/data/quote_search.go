@@ -0,0 +1,198 @@
+package data
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+)
+
+// Quote page sizes
+const (
+	DefaultQuotePageSize = 20
+	MaxQuotePageSize     = 100
+)
+
+// Quote sort fields. Prefixing a field with "-" sorts in descending order.
+const (
+	QuoteSortID     = "id"
+	QuoteSortAuthor = "author"
+	QuoteSortText   = "text"
+)
+
+// ErrInvalidCursor is returned for cursors that were not issued for the same sort order
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// QuoteQuery selects a page of quotes
+type QuoteQuery struct {
+	// Author keeps quotes by this author, ignoring case
+	Author string
+	// Search keeps quotes whose text contains it, ignoring case
+	Search string
+	// Tags keeps quotes that have every one of these tags
+	Tags []string
+	// Sort is a sort field, optionally prefixed with "-"; empty sorts by ID
+	Sort string
+	// Cursor continues from the page that returned it
+	Cursor string
+	// Limit is the page size, DefaultQuotePageSize when zero
+	Limit int
+}
+
+// QuotePage is one page of quotes matching a QuoteQuery
+type QuotePage struct {
+	Quotes []Quote `json:"quotes"`
+	// Total counts every matching quote, not only those on the page
+	Total int `json:"total"`
+	// NextCursor fetches the following page; it is empty on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// quoteCursor is the position a page ended at: the sort key and ID of its last quote
+type quoteCursor struct {
+	Sort string `json:"s"`
+	Key  string `json:"k"`
+	ID   string `json:"id"`
+}
+
+// ValidQuoteSort reports whether sort is a supported sort order
+func ValidQuoteSort(sort string) bool {
+	switch strings.TrimPrefix(sort, "-") {
+	case "", QuoteSortID, QuoteSortAuthor, QuoteSortText:
+		return true
+	}
+	return false
+}
+
+// Search returns the page of quotes selected by query. Cursors point after the
+// last quote of a page rather than at an offset, so quotes added or removed
+// between requests do not shift later pages.
+func (qs *QuoteService) Search(query QuoteQuery) (QuotePage, error) {
+	if !ValidQuoteSort(query.Sort) {
+		return QuotePage{}, &ValidationError{Field: "sort", Message: "Unsupported sort order " + query.Sort}
+	}
+	limit := query.Limit
+	if limit <= 0 {
+		limit = DefaultQuotePageSize
+	}
+	limit = min(limit, MaxQuotePageSize)
+
+	quotes, err := qs.store.List()
+	if err != nil {
+		return QuotePage{}, err
+	}
+
+	// Filter
+	search := strings.ToLower(query.Search)
+	author := strings.TrimSpace(query.Author)
+	matches := quotes[:0]
+	for _, q := range quotes {
+		if author != "" && !strings.EqualFold(q.Author, author) {
+			continue
+		}
+		if search != "" && !strings.Contains(strings.ToLower(q.Text), search) {
+			continue
+		}
+		if !hasTags(q, query.Tags) {
+			continue
+		}
+		matches = append(matches, q)
+	}
+
+	// Sort
+	field, descending := strings.CutPrefix(query.Sort, "-")
+	compare := func(a, b Quote) int {
+		c := cmp.Compare(quoteSortKey(a, field), quoteSortKey(b, field))
+		if c == 0 {
+			c = compareQuoteIDs(a.ID, b.ID)
+		}
+		if descending {
+			return -c
+		}
+		return c
+	}
+	slices.SortFunc(matches, compare)
+
+	page := QuotePage{Total: len(matches)}
+
+	// Skip past the cursor
+	start := 0
+	if query.Cursor != "" {
+		cursor, err := decodeQuoteCursor(query.Cursor)
+		if err != nil || cursor.Sort != query.Sort {
+			return QuotePage{}, ErrInvalidCursor
+		}
+		last := quoteFromSortKey(cursor.Key, cursor.ID, field)
+		start, _ = slices.BinarySearchFunc(matches, last, compare)
+		if start < len(matches) && compare(matches[start], last) == 0 {
+			start++
+		}
+	}
+
+	end := min(start+limit, len(matches))
+	page.Quotes = slices.Clone(matches[start:end])
+	if end < len(matches) {
+		last := matches[end-1]
+		page.NextCursor = encodeQuoteCursor(quoteCursor{Sort: query.Sort, Key: quoteSortKey(last, field), ID: last.ID})
+	}
+	return page, nil
+}
+
+// hasTags reports whether q has every tag in tags
+func hasTags(q Quote, tags []string) bool {
+	for _, tag := range tags {
+		if !slices.Contains(q.Tags, NormalizeTag(tag)) {
+			return false
+		}
+	}
+	return true
+}
+
+// quoteSortKey returns the value of q that field sorts on. Text and author sort
+// case-insensitively; the ID sorts through compareQuoteIDs alone.
+func quoteSortKey(q Quote, field string) string {
+	switch field {
+	case QuoteSortAuthor:
+		return strings.ToLower(q.Author)
+	case QuoteSortText:
+		return strings.ToLower(q.Text)
+	}
+	return ""
+}
+
+// quoteFromSortKey builds a quote that sorts at the given key and ID
+func quoteFromSortKey(key, id, field string) Quote {
+	q := Quote{ID: id}
+	switch field {
+	case QuoteSortAuthor:
+		q.Author = key
+	case QuoteSortText:
+		q.Text = key
+	}
+	return q
+}
+
+// compareQuoteIDs orders numeric IDs by value and falls back to string order
+func compareQuoteIDs(a, b string) int {
+	if c := cmp.Compare(len(a), len(b)); c != 0 {
+		return c
+	}
+	return strings.Compare(a, b)
+}
+
+func encodeQuoteCursor(c quoteCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeQuoteCursor(s string) (quoteCursor, error) {
+	var c quoteCursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(data, &c)
+	return c, err
+}
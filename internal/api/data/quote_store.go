@@ -0,0 +1,312 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+)
+
+// Quote store backends
+const (
+	QuoteStoreMemory = "memory"
+	QuoteStoreFile   = "file"
+)
+
+// ErrQuoteNotFound is returned when no quote has the requested ID
+var ErrQuoteNotFound = errors.New("quote not found")
+
+// QuoteStore keeps the quote collection. Implementations assign IDs on Create and
+// are safe for concurrent use; they do not validate quotes.
+type QuoteStore interface {
+	// List returns every quote in creation order
+	List() ([]Quote, error)
+	// Get returns the quote with the given ID or ErrQuoteNotFound
+	Get(id string) (Quote, error)
+	// Create stores q under a new ID and returns it with the ID set
+	Create(q Quote) (Quote, error)
+	// CreateMany stores quotes under new IDs as one change: either all of them are
+	// stored or, on error, none are
+	CreateMany(quotes []Quote) ([]Quote, error)
+	// Update replaces the quote with the given ID or returns ErrQuoteNotFound
+	Update(id string, q Quote) (Quote, error)
+	// Delete removes the quote with the given ID or returns ErrQuoteNotFound
+	Delete(id string) error
+}
+
+// NewQuoteStore creates the store named by kind: QuoteStoreMemory, or QuoteStoreFile
+// persisted at path. New stores are seeded with seed.
+func NewQuoteStore(kind, path string, seed []Quote) (QuoteStore, error) {
+	switch kind {
+	case "", QuoteStoreMemory:
+		return NewMemoryQuoteStore(seed), nil
+	case QuoteStoreFile:
+		return NewFileQuoteStore(path, seed)
+	default:
+		return nil, fmt.Errorf("unknown quote store %q (want %q or %q)", kind, QuoteStoreMemory, QuoteStoreFile)
+	}
+}
+
+// quoteSet is the collection shared by the store implementations; callers lock around it
+type quoteSet struct {
+	Quotes []Quote `json:"quotes"`
+	// NextID is the numeric ID given to the next created quote. IDs are never reused.
+	NextID int `json:"next_id"`
+}
+
+// newQuoteSet creates a set holding seed, numbered from 1
+func newQuoteSet(seed []Quote) quoteSet {
+	set := quoteSet{Quotes: make([]Quote, 0, len(seed)), NextID: 1}
+	for _, q := range seed {
+		set.create(q)
+	}
+	return set
+}
+
+func (s *quoteSet) clone() quoteSet {
+	return quoteSet{Quotes: slices.Clone(s.Quotes), NextID: s.NextID}
+}
+
+func (s *quoteSet) index(id string) int {
+	return slices.IndexFunc(s.Quotes, func(q Quote) bool { return q.ID == id })
+}
+
+func (s *quoteSet) get(id string) (Quote, error) {
+	i := s.index(id)
+	if i < 0 {
+		return Quote{}, ErrQuoteNotFound
+	}
+	return s.Quotes[i], nil
+}
+
+func (s *quoteSet) create(q Quote) Quote {
+	q.ID = strconv.Itoa(s.NextID)
+	q.Tags = slices.Clone(q.Tags)
+	q.Translations = maps.Clone(q.Translations)
+	s.NextID++
+	s.Quotes = append(s.Quotes, q)
+	return q
+}
+
+func (s *quoteSet) createMany(quotes []Quote) []Quote {
+	created := make([]Quote, len(quotes))
+	for i, q := range quotes {
+		created[i] = s.create(q)
+	}
+	return created
+}
+
+func (s *quoteSet) update(id string, q Quote) (Quote, error) {
+	i := s.index(id)
+	if i < 0 {
+		return Quote{}, ErrQuoteNotFound
+	}
+	q.ID = id
+	q.Tags = slices.Clone(q.Tags)
+	q.Translations = maps.Clone(q.Translations)
+	s.Quotes[i] = q
+	return q, nil
+}
+
+func (s *quoteSet) delete(id string) error {
+	i := s.index(id)
+	if i < 0 {
+		return ErrQuoteNotFound
+	}
+	s.Quotes = slices.Delete(s.Quotes, i, i+1)
+	return nil
+}
+
+// MemoryQuoteStore keeps quotes in memory; they are lost on restart
+type MemoryQuoteStore struct {
+	mu  sync.RWMutex
+	set quoteSet
+}
+
+// NewMemoryQuoteStore creates a MemoryQuoteStore holding seed
+func NewMemoryQuoteStore(seed []Quote) *MemoryQuoteStore {
+	return &MemoryQuoteStore{set: newQuoteSet(seed)}
+}
+
+// List returns every quote in creation order
+func (s *MemoryQuoteStore) List() ([]Quote, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Clone(s.set.Quotes), nil
+}
+
+// Get returns the quote with the given ID
+func (s *MemoryQuoteStore) Get(id string) (Quote, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.set.get(id)
+}
+
+// Create stores q under a new ID
+func (s *MemoryQuoteStore) Create(q Quote) (Quote, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.set.create(q), nil
+}
+
+// CreateMany stores quotes under new IDs
+func (s *MemoryQuoteStore) CreateMany(quotes []Quote) ([]Quote, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.set.createMany(quotes), nil
+}
+
+// Update replaces the quote with the given ID
+func (s *MemoryQuoteStore) Update(id string, q Quote) (Quote, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.set.update(id, q)
+}
+
+// Delete removes the quote with the given ID
+func (s *MemoryQuoteStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.set.delete(id)
+}
+
+// FileQuoteStore keeps quotes in memory and writes the whole collection to a JSON
+// file after every change, so quotes survive restarts
+type FileQuoteStore struct {
+	path string
+
+	mu  sync.RWMutex
+	set quoteSet
+}
+
+// NewFileQuoteStore opens the store persisted at path, creating the file with seed
+// when it does not exist yet
+func NewFileQuoteStore(path string, seed []Quote) (*FileQuoteStore, error) {
+	s := &FileQuoteStore{path: path}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		s.set = newQuoteSet(seed)
+		if err := s.save(); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, fmt.Errorf("reading quote store: %w", err)
+	default:
+		if err := json.Unmarshal(data, &s.set); err != nil {
+			return nil, fmt.Errorf("parsing quote store %s: %w", path, err)
+		}
+		if s.set.Quotes == nil {
+			s.set.Quotes = []Quote{}
+		}
+		// Guard against hand-edited files reusing IDs
+		s.set.NextID = max(s.set.NextID, 1)
+		for _, q := range s.set.Quotes {
+			if n, err := strconv.Atoi(q.ID); err == nil && n >= s.set.NextID {
+				s.set.NextID = n + 1
+			}
+		}
+	}
+	return s, nil
+}
+
+// List returns every quote in creation order
+func (s *FileQuoteStore) List() ([]Quote, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Clone(s.set.Quotes), nil
+}
+
+// Get returns the quote with the given ID
+func (s *FileQuoteStore) Get(id string) (Quote, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.set.get(id)
+}
+
+// Create stores q under a new ID and saves the file
+func (s *FileQuoteStore) Create(q Quote) (Quote, error) {
+	var created Quote
+	err := s.change(func(set *quoteSet) error {
+		created = set.create(q)
+		return nil
+	})
+	return created, err
+}
+
+// CreateMany stores quotes under new IDs and saves the file once
+func (s *FileQuoteStore) CreateMany(quotes []Quote) ([]Quote, error) {
+	var created []Quote
+	err := s.change(func(set *quoteSet) error {
+		created = set.createMany(quotes)
+		return nil
+	})
+	return created, err
+}
+
+// Update replaces the quote with the given ID and saves the file
+func (s *FileQuoteStore) Update(id string, q Quote) (Quote, error) {
+	var updated Quote
+	err := s.change(func(set *quoteSet) (err error) {
+		updated, err = set.update(id, q)
+		return err
+	})
+	return updated, err
+}
+
+// Delete removes the quote with the given ID and saves the file
+func (s *FileQuoteStore) Delete(id string) error {
+	return s.change(func(set *quoteSet) error {
+		return set.delete(id)
+	})
+}
+
+// change applies fn and saves the result, leaving the store untouched if either fails
+func (s *FileQuoteStore) change(fn func(*quoteSet) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := s.set.clone()
+	if err := fn(&s.set); err != nil {
+		s.set = previous
+		return err
+	}
+	if err := s.save(); err != nil {
+		s.set = previous
+		return err
+	}
+	return nil
+}
+
+// save writes the collection to a temporary file and renames it over the store,
+// so a crash never leaves a partially written file
+func (s *FileQuoteStore) save() error {
+	data, err := json.MarshalIndent(s.set, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("saving quote store: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // No-op once renamed
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("saving quote store: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("saving quote store: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("saving quote store: %w", err)
+	}
+	return nil
+}
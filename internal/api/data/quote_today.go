@@ -0,0 +1,40 @@
+package data
+
+import (
+	"hash/fnv"
+	"math/rand/v2"
+	"time"
+)
+
+// quoteOfTheDaySalt keeps the daily shuffles independent of other seeded sequences
+const quoteOfTheDaySalt = 0x71756f7465
+
+// QuoteOfTheDay returns the quote for the calendar date of day, in day's location.
+// The choice depends only on the date and the collection, so every caller gets the
+// same quote all day. With noRepeat, days are grouped into cycles as long as the
+// collection and each cycle walks a shuffle of it, so no quote comes back until
+// every other quote has had its day. Adding or removing quotes changes the choices.
+func (qs *QuoteService) QuoteOfTheDay(day time.Time, noRepeat bool) (Quote, error) {
+	quotes, err := qs.store.List()
+	if err != nil {
+		return Quote{}, err
+	}
+	if len(quotes) == 0 {
+		return Quote{}, ErrQuoteNotFound
+	}
+	n := uint64(len(quotes))
+
+	if !noRepeat {
+		h := fnv.New64a()
+		h.Write([]byte(day.Format(time.DateOnly)))
+		return quotes[h.Sum64()%n], nil
+	}
+
+	// Days since 1970-01-01 for the local calendar date; dates before it are not served
+	year, month, date := day.Date()
+	days := uint64(max(time.Date(year, month, date, 0, 0, 0, 0, time.UTC).Unix()/86400, 0))
+	cycle, position := days/n, days%n
+
+	order := rand.New(rand.NewPCG(cycle, quoteOfTheDaySalt)).Perm(len(quotes))
+	return quotes[order[position]], nil
+}
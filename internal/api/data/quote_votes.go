@@ -0,0 +1,294 @@
+package data
+
+import (
+	"cmp"
+	"errors"
+	"slices"
+	"sync"
+)
+
+// Default and maximum number of quotes returned by Top
+const (
+	DefaultTopQuotes = 10
+	MaxTopQuotes     = 100
+)
+
+// DefaultMaxVoters bounds how many voters can hold votes or favorites at once
+const DefaultMaxVoters = 100_000
+
+// ErrInvalidVote is returned for votes other than -1, 0 and 1
+var ErrInvalidVote = errors.New("vote must be -1, 0 or 1")
+
+// ErrTooManyVoters is returned when a new voter would exceed the voter limit
+var ErrTooManyVoters = errors.New("too many voters")
+
+// QuoteRating summarizes the votes and favorites of a quote
+type QuoteRating struct {
+	QuoteID   string `json:"quote_id"`
+	Score     int    `json:"score"`
+	Upvotes   int    `json:"upvotes"`
+	Downvotes int    `json:"downvotes"`
+	Favorites int    `json:"favorites"`
+	// Vote and Favorite describe the requesting voter's own vote and favorite
+	Vote     int  `json:"vote"`
+	Favorite bool `json:"favorite"`
+}
+
+// RatedQuote is a quote with its rating
+type RatedQuote struct {
+	Quote  Quote       `json:"quote"`
+	Rating QuoteRating `json:"rating"`
+}
+
+// quoteRatings records votes and favorites by voter. Voters are opaque strings
+// identifying an API client or an anonymous visitor.
+type quoteRatings struct {
+	mu sync.RWMutex
+	// votes maps quote IDs to each voter's vote, +1 or -1
+	votes map[string]map[string]int
+	// favorites maps quote IDs to the voters that marked them
+	favorites map[string]map[string]struct{}
+	// voters counts the votes and favorites each voter holds, so voters without
+	// any are dropped and the number of voters can be capped
+	voters map[string]int
+}
+
+func newQuoteRatings() *quoteRatings {
+	return &quoteRatings{
+		votes:     make(map[string]map[string]int),
+		favorites: make(map[string]map[string]struct{}),
+		voters:    make(map[string]int),
+	}
+}
+
+// hold records that voter holds one more vote or favorite, failing with
+// ErrTooManyVoters when voter is new and maxVoters are already known. Callers
+// hold the write lock.
+func (qr *quoteRatings) hold(voter string, maxVoters int) error {
+	if qr.voters[voter] == 0 && len(qr.voters) >= maxVoters {
+		return ErrTooManyVoters
+	}
+	qr.voters[voter]++
+	return nil
+}
+
+// release records that voter gave up a vote or favorite; callers hold the write lock
+func (qr *quoteRatings) release(voter string) {
+	if qr.voters[voter]--; qr.voters[voter] <= 0 {
+		delete(qr.voters, voter)
+	}
+}
+
+// rating summarizes quoteID for voter; callers hold at least the read lock
+func (qr *quoteRatings) rating(quoteID, voter string) QuoteRating {
+	rating := QuoteRating{QuoteID: quoteID, Vote: qr.votes[quoteID][voter]}
+	for _, vote := range qr.votes[quoteID] {
+		if vote > 0 {
+			rating.Upvotes++
+		} else {
+			rating.Downvotes++
+		}
+	}
+	rating.Score = rating.Upvotes - rating.Downvotes
+	rating.Favorites = len(qr.favorites[quoteID])
+	_, rating.Favorite = qr.favorites[quoteID][voter]
+	return rating
+}
+
+// score returns the score of quoteID; callers hold at least the read lock
+func (qr *quoteRatings) score(quoteID string) int {
+	score := 0
+	for _, vote := range qr.votes[quoteID] {
+		score += vote
+	}
+	return score
+}
+
+// forget drops the votes and favorites of a deleted quote. Vote and SetFavorite
+// look the quote up while holding the lock, so nothing is recorded for it once
+// forget has run.
+func (qr *quoteRatings) forget(quoteID string) {
+	qr.mu.Lock()
+	defer qr.mu.Unlock()
+	for voter := range qr.votes[quoteID] {
+		qr.release(voter)
+	}
+	for voter := range qr.favorites[quoteID] {
+		qr.release(voter)
+	}
+	delete(qr.votes, quoteID)
+	delete(qr.favorites, quoteID)
+}
+
+// maxVoters returns the voter limit in effect
+func (qs *QuoteService) maxVoters() int {
+	if qs.MaxVoters > 0 {
+		return qs.MaxVoters
+	}
+	return DefaultMaxVoters
+}
+
+// Rating returns the rating of the quote with the given ID, as seen by voter
+func (qs *QuoteService) Rating(quoteID, voter string) (QuoteRating, error) {
+	if _, err := qs.store.Get(quoteID); err != nil {
+		return QuoteRating{}, err
+	}
+
+	qs.ratings.mu.RLock()
+	defer qs.ratings.mu.RUnlock()
+	return qs.ratings.rating(quoteID, voter), nil
+}
+
+// Vote records voter's vote on a quote: 1 up, -1 down, 0 to withdraw it.
+// Each voter has one vote per quote, so voting again replaces the earlier vote.
+// It returns ErrTooManyVoters when voter is new and the voter limit is reached.
+func (qs *QuoteService) Vote(quoteID, voter string, vote int) (QuoteRating, error) {
+	if vote < -1 || vote > 1 {
+		return QuoteRating{}, ErrInvalidVote
+	}
+
+	qr := qs.ratings
+	qr.mu.Lock()
+	defer qr.mu.Unlock()
+
+	if _, err := qs.store.Get(quoteID); err != nil {
+		return QuoteRating{}, err
+	}
+
+	_, voted := qr.votes[quoteID][voter]
+	switch {
+	case vote == 0 && voted:
+		delete(qr.votes[quoteID], voter)
+		qr.release(voter)
+	case vote != 0:
+		if !voted {
+			if err := qr.hold(voter, qs.maxVoters()); err != nil {
+				return QuoteRating{}, err
+			}
+		}
+		if qr.votes[quoteID] == nil {
+			qr.votes[quoteID] = make(map[string]int)
+		}
+		qr.votes[quoteID][voter] = vote
+	}
+	return qr.rating(quoteID, voter), nil
+}
+
+// SetFavorite marks or unmarks a quote as one of voter's favorites. It returns
+// ErrTooManyVoters when voter is new and the voter limit is reached.
+func (qs *QuoteService) SetFavorite(quoteID, voter string, favorite bool) (QuoteRating, error) {
+	qr := qs.ratings
+	qr.mu.Lock()
+	defer qr.mu.Unlock()
+
+	if _, err := qs.store.Get(quoteID); err != nil {
+		return QuoteRating{}, err
+	}
+
+	_, marked := qr.favorites[quoteID][voter]
+	switch {
+	case !favorite && marked:
+		delete(qr.favorites[quoteID], voter)
+		qr.release(voter)
+	case favorite && !marked:
+		if err := qr.hold(voter, qs.maxVoters()); err != nil {
+			return QuoteRating{}, err
+		}
+		if qr.favorites[quoteID] == nil {
+			qr.favorites[quoteID] = make(map[string]struct{})
+		}
+		qr.favorites[quoteID][voter] = struct{}{}
+	}
+	return qr.rating(quoteID, voter), nil
+}
+
+// Favorites returns voter's favorite quotes in creation order
+func (qs *QuoteService) Favorites(voter string) ([]Quote, error) {
+	quotes, err := qs.store.List()
+	if err != nil {
+		return nil, err
+	}
+
+	qs.ratings.mu.RLock()
+	defer qs.ratings.mu.RUnlock()
+
+	favorites := []Quote{}
+	for _, q := range quotes {
+		if _, ok := qs.ratings.favorites[q.ID][voter]; ok {
+			favorites = append(favorites, q)
+		}
+	}
+	return favorites, nil
+}
+
+// Top returns up to limit quotes with the highest scores, ties broken by
+// favorites and then by age. Quotes nobody voted on or marked are left out.
+func (qs *QuoteService) Top(limit int) ([]RatedQuote, error) {
+	if limit <= 0 {
+		limit = DefaultTopQuotes
+	}
+	limit = min(limit, MaxTopQuotes)
+
+	quotes, err := qs.store.List()
+	if err != nil {
+		return nil, err
+	}
+
+	qs.ratings.mu.RLock()
+	rated := []RatedQuote{}
+	for _, q := range quotes {
+		rating := qs.ratings.rating(q.ID, "")
+		if rating.Upvotes+rating.Downvotes+rating.Favorites > 0 {
+			rated = append(rated, RatedQuote{Quote: q, Rating: rating})
+		}
+	}
+	qs.ratings.mu.RUnlock()
+
+	slices.SortStableFunc(rated, func(a, b RatedQuote) int {
+		if c := cmp.Compare(b.Rating.Score, a.Rating.Score); c != 0 {
+			return c
+		}
+		return cmp.Compare(b.Rating.Favorites, a.Rating.Favorites)
+	})
+	return rated[:min(limit, len(rated))], nil
+}
+
+// GetWeightedRandomQuote returns a random quote, favoring well-voted ones. A quote
+// with score s has weight 1+s when s >= 0 and 1/(1-s) otherwise, so a quote at +4
+// comes up five times as often as an unvoted one and a quote at -4 a fifth as often.
+func (qs *QuoteService) GetWeightedRandomQuote() (Quote, error) {
+	quotes, err := qs.store.List()
+	if err != nil {
+		return Quote{}, err
+	}
+	if len(quotes) == 0 {
+		return Quote{}, ErrQuoteNotFound
+	}
+
+	weights := make([]float64, len(quotes))
+	total := 0.0
+	qs.ratings.mu.RLock()
+	for i, q := range quotes {
+		score := float64(qs.ratings.score(q.ID))
+		if score >= 0 {
+			weights[i] = 1 + score
+		} else {
+			weights[i] = 1 / (1 - score)
+		}
+		total += weights[i]
+	}
+	qs.ratings.mu.RUnlock()
+
+	qs.mu.Lock()
+	target := qs.r.Float64() * total
+	qs.mu.Unlock()
+
+	for i, weight := range weights {
+		if target < weight {
+			return quotes[i], nil
+		}
+		target -= weight
+	}
+	// Rounding can leave target just above the last weight
+	return quotes[len(quotes)-1], nil
+}
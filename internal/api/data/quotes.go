@@ -1,51 +1,212 @@
 package data
 
 import (
-	"math/rand"
-	"time"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
 )
 
-// Quote represents a quote with its text and author
+// Quote length limits, in characters
+const (
+	MaxQuoteTextLength   = 500
+	MaxQuoteAuthorLength = 100
+	MaxQuoteTags         = 10
+	MaxQuoteTagLength    = 30
+)
+
+// Quote represents a quote with its text, author and topic tags. Language is the
+// language tag of Text, and Translations maps other language tags to translated text.
 type Quote struct {
-	Text   string `json:"text"`
-	Author string `json:"author"`
+	ID           string            `json:"id"`
+	Text         string            `json:"text"`
+	Author       string            `json:"author"`
+	Tags         []string          `json:"tags"`
+	Language     string            `json:"language"`
+	Translations map[string]string `json:"translations,omitempty"`
+}
+
+// ValidationError reports a quote field that failed validation
+type ValidationError struct {
+	Field   string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+// Validate trims the quote's fields, lowercases and deduplicates its tags, normalizes
+// its language tags, and checks them against the limits. It returns the normalized quote.
+func (q Quote) Validate() (Quote, error) {
+	q.Text = strings.TrimSpace(q.Text)
+	q.Author = strings.TrimSpace(q.Author)
+
+	fields := []struct {
+		name  string
+		value string
+		max   int
+	}{
+		{"text", q.Text, MaxQuoteTextLength},
+		{"author", q.Author, MaxQuoteAuthorLength},
+	}
+	for _, f := range fields {
+		if f.value == "" {
+			return Quote{}, &ValidationError{Field: f.name, Message: "Field '" + f.name + "' must not be empty"}
+		}
+		if utf8.RuneCountInString(f.value) > f.max {
+			return Quote{}, &ValidationError{Field: f.name,
+				Message: "Field '" + f.name + "' must be at most " + strconv.Itoa(f.max) + " characters"}
+		}
+	}
+
+	if len(q.Tags) > MaxQuoteTags {
+		return Quote{}, &ValidationError{Field: "tags", Message: "Field 'tags' may hold at most " + strconv.Itoa(MaxQuoteTags) + " tags"}
+	}
+	tags := make([]string, 0, len(q.Tags))
+	for _, tag := range q.Tags {
+		tag = NormalizeTag(tag)
+		if tag == "" || utf8.RuneCountInString(tag) > MaxQuoteTagLength || strings.IndexFunc(tag, invalidTagRune) >= 0 {
+			return Quote{}, &ValidationError{Field: "tags",
+				Message: "Tags must be 1 to " + strconv.Itoa(MaxQuoteTagLength) + " letters, digits or hyphens"}
+		}
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	q.Tags = tags
+	return q.validateLanguages()
 }
 
-// QuoteService provides quote-related functionality
+// NormalizeTag returns tag trimmed and lowercased, the form tags are stored and matched in
+func NormalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+// invalidTagRune reports whether r may not appear in a tag
+func invalidTagRune(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-'
+}
+
+// DefaultQuotes returns the quotes a new store is seeded with
+func DefaultQuotes() []Quote {
+	return []Quote{
+		{Text: "Life is what happens when you're busy making other plans.", Author: "John Lennon", Tags: []string{"life"},
+			Language: "en", Translations: map[string]string{"es": "La vida es lo que pasa mientras estás ocupado haciendo otros planes."}},
+		{Text: "The way to get started is to quit talking and begin doing.", Author: "Walt Disney", Tags: []string{"motivation", "action"},
+			Language: "en", Translations: map[string]string{"es": "La manera de empezar es dejar de hablar y comenzar a hacer."}},
+		{Text: "Your time is limited, so don't waste it living someone else's life.", Author: "Steve Jobs", Tags: []string{"life", "time"},
+			Language: "en", Translations: map[string]string{"es": "Tu tiempo es limitado, así que no lo desperdicies viviendo la vida de otra persona."}},
+		{Text: "The future belongs to those who believe in the beauty of their dreams.", Author: "Eleanor Roosevelt", Tags: []string{"dreams", "future"},
+			Language: "en", Translations: map[string]string{"es": "El futuro pertenece a quienes creen en la belleza de sus sueños."}},
+		{Text: "The purpose of our lives is to be happy.", Author: "Dalai Lama", Tags: []string{"happiness", "life"},
+			Language: "en", Translations: map[string]string{"es": "El propósito de nuestras vidas es ser felices."}},
+		{Text: "Get busy living or get busy dying.", Author: "Stephen King", Tags: []string{"life", "motivation"},
+			Language: "en", Translations: map[string]string{"es": "Ocúpate de vivir o ocúpate de morir."}},
+		{Text: "You only live once, but if you do it right, once is enough.", Author: "Mae West", Tags: []string{"life"},
+			Language: "en", Translations: map[string]string{"es": "Solo se vive una vez, pero si lo haces bien, una vez es suficiente."}},
+		{Text: "Many of life's failures are people who did not realize how close they were to success when they gave up.", Author: "Thomas A. Edison", Tags: []string{"success", "perseverance"},
+			Language: "en", Translations: map[string]string{"es": "Muchos de los fracasos de la vida son de personas que no se dieron cuenta de lo cerca que estaban del éxito cuando se rindieron."}},
+		{Text: "The secret of success is to do the common thing uncommonly well.", Author: "John D. Rockefeller Jr.", Tags: []string{"success"},
+			Language: "en", Translations: map[string]string{"es": "El secreto del éxito es hacer lo común de manera poco común."}},
+		{Text: "The best time to plant a tree was 20 years ago. The second best time is now.", Author: "Chinese Proverb", Tags: []string{"action", "time"},
+			Language: "en", Translations: map[string]string{"es": "El mejor momento para plantar un árbol fue hace 20 años. El segundo mejor momento es ahora."}},
+	}
+}
+
+// QuoteService provides quote-related functionality on top of a QuoteStore.
+// It is safe for concurrent use and meant to be shared for the server's lifetime.
 type QuoteService struct {
-	quotes []Quote
-	r      *rand.Rand
+	store QuoteStore
+
+	// mu guards r, which is not safe for concurrent use
+	mu sync.Mutex
+	r  *rand.Rand
+
+	// importMu serializes imports
+	importMu sync.Mutex
+
+	// ratings holds votes and favorites in memory; they are not persisted
+	ratings *quoteRatings
+	// MaxVoters bounds how many voters can hold votes or favorites at once;
+	// zero means DefaultMaxVoters. Set it before the service is shared.
+	MaxVoters int
 }
 
-// NewQuoteService creates a new QuoteService with predefined quotes
+// NewQuoteService creates a new QuoteService with the default quotes kept in memory
 func NewQuoteService() *QuoteService {
-	// Create a random source with time seed
-	source := rand.NewSource(time.Now().UnixNano())
-	r := rand.New(source)
-
-	// Define our list of quotes
-	quotes := []Quote{
-		{Text: "Life is what happens when you're busy making other plans.", Author: "John Lennon"},
-		{Text: "The way to get started is to quit talking and begin doing.", Author: "Walt Disney"},
-		{Text: "Your time is limited, so don't waste it living someone else's life.", Author: "Steve Jobs"},
-		{Text: "The future belongs to those who believe in the beauty of their dreams.", Author: "Eleanor Roosevelt"},
-		{Text: "The purpose of our lives is to be happy.", Author: "Dalai Lama"},
-		{Text: "Get busy living or get busy dying.", Author: "Stephen King"},
-		{Text: "You only live once, but if you do it right, once is enough.", Author: "Mae West"},
-		{Text: "Many of life's failures are people who did not realize how close they were to success when they gave up.", Author: "Thomas A. Edison"},
-		{Text: "The secret of success is to do the common thing uncommonly well.", Author: "John D. Rockefeller Jr."},
-		{Text: "The best time to plant a tree was 20 years ago. The second best time is now.", Author: "Chinese Proverb"},
-	}
+	return NewQuoteServiceWithStore(NewMemoryQuoteStore(DefaultQuotes()))
+}
+
+// NewQuoteServiceWithStore creates a new QuoteService reading and writing quotes in store,
+// picking random quotes from a randomly seeded source
+func NewQuoteServiceWithStore(store QuoteStore) *QuoteService {
+	return NewQuoteServiceWithSource(store, rand.NewPCG(rand.Uint64(), rand.Uint64()))
+}
 
+// NewQuoteServiceWithSource creates a new QuoteService that picks random quotes from
+// source, so a fixed seed gives a repeatable sequence of quotes
+func NewQuoteServiceWithSource(store QuoteStore, source rand.Source) *QuoteService {
 	return &QuoteService{
-		quotes: quotes,
-		r:      r,
+		store:   store,
+		r:       rand.New(source),
+		ratings: newQuoteRatings(),
 	}
 }
 
-// GetRandomQuote returns a random quote from the collection
-func (qs *QuoteService) GetRandomQuote() Quote {
+// GetRandomQuote returns a random quote from the collection, or ErrQuoteNotFound when it is empty
+func (qs *QuoteService) GetRandomQuote() (Quote, error) {
+	quotes, err := qs.store.List()
+	if err != nil {
+		return Quote{}, err
+	}
+	if len(quotes) == 0 {
+		return Quote{}, ErrQuoteNotFound
+	}
+
 	// Get a random index from our quotes slice
-	randomIndex := qs.r.Intn(len(qs.quotes))
-	return qs.quotes[randomIndex]
+	qs.mu.Lock()
+	randomIndex := qs.r.IntN(len(quotes))
+	qs.mu.Unlock()
+	return quotes[randomIndex], nil
+}
+
+// List returns every quote in creation order
+func (qs *QuoteService) List() ([]Quote, error) {
+	return qs.store.List()
+}
+
+// Get returns the quote with the given ID
+func (qs *QuoteService) Get(id string) (Quote, error) {
+	return qs.store.Get(id)
+}
+
+// Create validates q and adds it to the collection under a new ID
+func (qs *QuoteService) Create(q Quote) (Quote, error) {
+	q, err := q.Validate()
+	if err != nil {
+		return Quote{}, err
+	}
+	return qs.store.Create(q)
+}
+
+// Update validates q and replaces the quote with the given ID, keeping its ID
+func (qs *QuoteService) Update(id string, q Quote) (Quote, error) {
+	q, err := q.Validate()
+	if err != nil {
+		return Quote{}, err
+	}
+	return qs.store.Update(id, q)
+}
+
+// Delete removes the quote with the given ID along with its votes and favorites
+func (qs *QuoteService) Delete(id string) error {
+	if err := qs.store.Delete(id); err != nil {
+		return err
+	}
+	qs.ratings.forget(id)
+	return nil
 }
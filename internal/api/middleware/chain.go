@@ -0,0 +1,47 @@
+package middleware
+
+import "net/http"
+
+// Middleware wraps an http.Handler with additional behaviour
+type Middleware func(http.Handler) http.Handler
+
+// FromHandlerFunc adapts a middleware written against http.HandlerFunc to a Middleware
+func FromHandlerFunc(m func(http.HandlerFunc) http.HandlerFunc) Middleware {
+	return func(next http.Handler) http.Handler {
+		return m(next.ServeHTTP)
+	}
+}
+
+// Chain is an ordered list of middleware applied to handlers.
+// The first middleware in the chain is the outermost one, so it sees the request first.
+// Chains are immutable: Use returns a new Chain, which makes it safe to derive
+// per-route chains from a shared global one.
+type Chain struct {
+	middlewares []Middleware
+}
+
+// NewChain creates a Chain from the given middleware
+func NewChain(middlewares ...Middleware) Chain {
+	return Chain{}.Use(middlewares...)
+}
+
+// Use returns a new Chain with the given middleware appended after the existing ones
+func (c Chain) Use(middlewares ...Middleware) Chain {
+	combined := make([]Middleware, 0, len(c.middlewares)+len(middlewares))
+	combined = append(combined, c.middlewares...)
+	combined = append(combined, middlewares...)
+	return Chain{middlewares: combined}
+}
+
+// Then wraps h with every middleware in the chain
+func (c Chain) Then(h http.Handler) http.Handler {
+	for i := len(c.middlewares) - 1; i >= 0; i-- {
+		h = c.middlewares[i](h)
+	}
+	return h
+}
+
+// ThenFunc wraps fn with every middleware in the chain
+func (c Chain) ThenFunc(fn http.HandlerFunc) http.Handler {
+	return c.Then(fn)
+}
@@ -1,46 +1,99 @@
 package middleware
 
 import (
-	"log"
+	"log/slog"
 	"net/http"
 	"time"
+
+	"github.com/jorge2751/GoAPI/internal/api/requestid"
 )
 
 // customResponseWriter is a wrapper for http.ResponseWriter that captures the status code
+// and the number of bytes written
 type customResponseWriter struct {
 	http.ResponseWriter
-	statusCode int
+	statusCode  int
+	bytes       int
+	wroteHeader bool
 }
 
 // WriteHeader captures the status code before calling the underlying ResponseWriter
 func (crw *customResponseWriter) WriteHeader(code int) {
-	crw.statusCode = code
+	if !crw.wroteHeader {
+		crw.statusCode = code
+		crw.wroteHeader = true
+	}
 	crw.ResponseWriter.WriteHeader(code)
 }
 
-// LoggingMiddleware logs the incoming HTTP request and its duration
-func LoggingMiddleware(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		// Start timer
-		startTime := time.Now()
+// Write counts the bytes written to the underlying ResponseWriter
+func (crw *customResponseWriter) Write(b []byte) (int, error) {
+	crw.wroteHeader = true
+	n, err := crw.ResponseWriter.Write(b)
+	crw.bytes += n
+	return n, err
+}
+
+// Unwrap exposes the underlying ResponseWriter to http.ResponseController
+func (crw *customResponseWriter) Unwrap() http.ResponseWriter {
+	return crw.ResponseWriter
+}
+
+// LoggingMiddleware logs each request as a single structured record using the default slog logger
+func LoggingMiddleware(next http.Handler) http.Handler {
+	return NewLoggingMiddleware(nil)(next)
+}
+
+// NewLoggingMiddleware returns a logging middleware that writes to logger.
+// A nil logger means slog.Default() at the time of each request. The logger's handler
+// should be a requestid.LogHandler so the record carries the request ID.
+//
+// The middleware reuses a valid incoming X-Request-ID header or generates a new one,
+// echoes it on the response and stores it in the request context.
+func NewLoggingMiddleware(logger *slog.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Start timer
+			startTime := time.Now()
+
+			// Propagate the caller's request ID or create one
+			id := r.Header.Get(requestid.Header)
+			if !requestid.Valid(id) {
+				id = requestid.New()
+			}
+			w.Header().Set(requestid.Header, id)
+			r = r.WithContext(requestid.NewContext(r.Context(), id))
 
-		// Create a custom response writer to capture the status code
-		crw := &customResponseWriter{
-			ResponseWriter: w,
-			statusCode:     http.StatusOK, // Default to 200 OK
-		}
+			// Create a custom response writer to capture the status code
+			crw := &customResponseWriter{
+				ResponseWriter: w,
+				statusCode:     http.StatusOK, // Default to 200 OK
+			}
 
-		// Log request details
-		log.Printf("Request: %s %s", r.Method, r.URL.Path)
+			// Call the actual handler
+			next.ServeHTTP(crw, r)
 
-		// Call the actual handler
-		next(crw, r)
+			// Calculate duration
+			duration := time.Since(startTime)
 
-		// Calculate duration
-		duration := time.Since(startTime)
+			level := slog.LevelInfo
+			if crw.statusCode >= http.StatusInternalServerError {
+				level = slog.LevelError
+			}
 
-		// Log response details
-		log.Printf("Response: %s %s - Status: %d - Duration: %v",
-			r.Method, r.URL.Path, crw.statusCode, duration)
+			l := logger
+			if l == nil {
+				l = slog.Default()
+			}
+			l.LogAttrs(r.Context(), level, "request",
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", crw.statusCode),
+				slog.Int("bytes", crw.bytes),
+				slog.String("remote_addr", r.RemoteAddr),
+				slog.String("user_agent", r.UserAgent()),
+				slog.Float64("duration_ms", float64(duration.Microseconds())/1000),
+			)
+		})
 	}
 }
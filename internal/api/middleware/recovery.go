@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"sync/atomic"
+
+	"github.com/jorge2751/GoAPI/internal/api/response"
+)
+
+// recoveredPanics counts panics caught by RecoveryMiddleware since startup
+var recoveredPanics atomic.Int64
+
+// RecoveredPanics returns the number of handler panics recovered since startup
+func RecoveredPanics() int64 {
+	return recoveredPanics.Load()
+}
+
+// RecoveryMiddleware catches panics from later handlers, logs the stack trace with the
+// request ID and answers with a JSON 500 instead of dropping the connection.
+// It should run inside LoggingMiddleware so the request ID is available and the
+// 500 is logged.
+func RecoveryMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		crw := &customResponseWriter{
+			ResponseWriter: w,
+			statusCode:     http.StatusOK,
+		}
+
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			// http.ErrAbortHandler is the documented way to abort a response; let net/http handle it
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+
+			total := recoveredPanics.Add(1)
+			slog.ErrorContext(r.Context(), "panic recovered",
+				"panic", recovered,
+				"stack", string(debug.Stack()),
+				"panics_total", total,
+			)
+
+			// Too late to change the response once the handler started writing it
+			if crw.wroteHeader {
+				return
+			}
+
+			response.Error(w, r, http.StatusInternalServerError, response.CodeInternal, "Internal server error")
+		}()
+
+		next.ServeHTTP(crw, r)
+	})
+}
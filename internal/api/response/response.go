@@ -0,0 +1,81 @@
+package response
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/jorge2751/GoAPI/internal/api/requestid"
+)
+
+// Envelope statuses
+const (
+	StatusSuccess = "success"
+	StatusError   = "error"
+)
+
+// Machine-readable error codes returned in ErrorBody.Code
+const (
+	CodeMissingParameter = "missing_parameter"
+	CodeInvalidParameter = "invalid_parameter"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeNotConfigured    = "not_configured"
+	CodeUpstreamFailure  = "upstream_failure"
+	// CodeRateLimited means a quota or rate limit is used up for now
+	CodeRateLimited = "rate_limited"
+	// CodeUnauthorized means the request lacks the credentials the resource requires
+	CodeUnauthorized = "unauthorized"
+	// CodeLimitReached means a resource cannot be created because a fixed limit is reached
+	CodeLimitReached = "limit_reached"
+	// CodeUpstreamUnavailable means an upstream is failing and calls to it are paused
+	CodeUpstreamUnavailable = "upstream_unavailable"
+	CodeInternal            = "internal_error"
+)
+
+// Envelope is the JSON body shared by every endpoint.
+// Successful responses carry Data, failed ones carry Error.
+type Envelope[T any] struct {
+	Status    string     `json:"status"`
+	Data      T          `json:"data,omitempty"`
+	Error     *ErrorBody `json:"error,omitempty"`
+	RequestID string     `json:"request_id,omitempty"`
+}
+
+// ErrorBody describes what went wrong in a failed request
+type ErrorBody struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// JSON writes data wrapped in a success envelope with the given status code
+func JSON(w http.ResponseWriter, r *http.Request, status int, data any) {
+	write(w, r, status, Envelope[any]{
+		Status:    StatusSuccess,
+		Data:      data,
+		RequestID: requestid.FromContext(r.Context()),
+	})
+}
+
+// Error writes an error envelope with the given status code, error code and message
+func Error(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	write(w, r, status, Envelope[any]{
+		Status: StatusError,
+		Error: &ErrorBody{
+			Code:    code,
+			Message: message,
+		},
+		RequestID: requestid.FromContext(r.Context()),
+	})
+}
+
+// write encodes the envelope as the response body
+func write(w http.ResponseWriter, r *http.Request, status int, envelope Envelope[any]) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	// Headers are already sent, so an encoding failure can only be logged
+	if err := json.NewEncoder(w).Encode(envelope); err != nil {
+		slog.ErrorContext(r.Context(), "Error encoding response", "error", err)
+	}
+}
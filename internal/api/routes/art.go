@@ -1,26 +1,86 @@
 package routes
 
 import (
+	"errors"
+	"log/slog"
 	"net/http"
+	"strings"
 
 	"github.com/jorge2751/GoAPI/internal/api/data"
+	"github.com/jorge2751/GoAPI/internal/api/response"
 )
 
-// ArtHandler returns ASCII art directly as plain text
-func ArtHandler(w http.ResponseWriter, r *http.Request) {
-	// Set content type to plain text
-	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+// ArtAPI serves the ASCII art gallery held by a data.ArtService
+type ArtAPI struct {
+	Art *data.ArtService
+}
 
-	// Create a new art service
-	artService := data.NewArtService()
+// NewArtAPI creates an ArtAPI for art
+func NewArtAPI(art *data.ArtService) *ArtAPI {
+	return &ArtAPI{Art: art}
+}
 
-	// Get the art
-	art := artService.GetArt()
+// ListHandler returns the IDs, titles and dimensions of every piece in the gallery
+func (api *ArtAPI) ListHandler(w http.ResponseWriter, r *http.Request) {
+	response.JSON(w, r, http.StatusOK, api.Art.List())
+}
 
-	// Write the art content directly to the response
-	_, err := w.Write([]byte(art.Content))
+// GetHandler returns the piece named by the {id} path value
+func (api *ArtAPI) GetHandler(w http.ResponseWriter, r *http.Request) {
+	art, err := api.Art.Get(r.PathValue("id"))
+	if errors.Is(err, data.ErrArtNotFound) {
+		response.Error(w, r, http.StatusNotFound, response.CodeNotFound, "No art with ID '"+r.PathValue("id")+"'")
+		return
+	}
+	writeArt(w, r, art)
+}
+
+// RandomHandler returns a random piece from the gallery
+func (api *ArtAPI) RandomHandler(w http.ResponseWriter, r *http.Request) {
+	art, err := api.Art.Random()
 	if err != nil {
-		http.Error(w, "Failed to write response", http.StatusInternalServerError)
+		response.Error(w, r, http.StatusNotFound, response.CodeNotFound, "The art gallery is empty")
 		return
 	}
+	writeArt(w, r, art)
+}
+
+// writeArt writes a piece directly as plain text, which displays properly in a
+// terminal or browser. ?format=json or an Accept header preferring
+// application/json returns it with its metadata in the JSON envelope instead.
+func writeArt(w http.ResponseWriter, r *http.Request, art data.Art) {
+	w.Header().Add("Vary", "Accept")
+	format := r.URL.Query().Get("format")
+	switch format {
+	case "":
+		format = negotiateArtFormat(r.Header.Values("Accept"))
+	case "json", "text":
+	default:
+		response.Error(w, r, http.StatusBadRequest, response.CodeInvalidParameter, "Query parameter 'format' must be text or json")
+		return
+	}
+	if format == "json" {
+		response.JSON(w, r, http.StatusOK, art)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	// The status line is already sent if this fails, so the error can only be logged
+	if _, err := w.Write([]byte(art.Content + "\n")); err != nil {
+		slog.ErrorContext(r.Context(), "Error writing art response", "error", err)
+	}
+}
+
+// negotiateArtFormat returns "json" when the client prefers JSON to plain text, and "text" otherwise
+func negotiateArtFormat(accept []string) string {
+	for _, mediaType := range rankByQuality(accept, strings.ToLower) {
+		switch mediaType {
+		case "application/json":
+			return "json"
+		case "text/plain", "text/*", "*/*":
+			return "text"
+		}
+	}
+	return "text"
 }
@@ -0,0 +1,54 @@
+package routes
+
+import (
+	"cmp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// rankByQuality returns the items of comma-separated header values such as Accept or
+// Accept-Language, best first by their q parameter. Items keep the client's order
+// among equal qualities. normalize returns each item's canonical form, or "" to drop
+// a malformed item; items with a malformed quality or q=0 are dropped too.
+func rankByQuality(values []string, normalize func(string) string) []string {
+	type weighted struct {
+		item    string
+		quality float64
+	}
+	var items []weighted
+	for _, value := range values {
+	parts:
+		for _, part := range strings.Split(value, ",") {
+			item, params, _ := strings.Cut(part, ";")
+			if item = normalize(strings.TrimSpace(item)); item == "" {
+				continue
+			}
+
+			quality := 1.0
+			for _, param := range strings.Split(params, ";") {
+				name, q, ok := strings.Cut(strings.TrimSpace(param), "=")
+				if !ok || !strings.EqualFold(strings.TrimSpace(name), "q") {
+					continue
+				}
+				var err error
+				if quality, err = strconv.ParseFloat(strings.TrimSpace(q), 64); err != nil || quality < 0 || quality > 1 {
+					continue parts
+				}
+			}
+			if quality > 0 {
+				items = append(items, weighted{item, quality})
+			}
+		}
+	}
+	if len(items) == 0 {
+		return nil
+	}
+
+	slices.SortStableFunc(items, func(a, b weighted) int { return cmp.Compare(b.quality, a.quality) })
+	ranked := make([]string, len(items))
+	for i, it := range items {
+		ranked[i] = it.item
+	}
+	return ranked
+}
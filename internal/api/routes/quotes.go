@@ -2,38 +2,282 @@ package routes
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/jorge2751/GoAPI/internal/api/data"
+	"github.com/jorge2751/GoAPI/internal/api/response"
 )
 
-// QuoteResponse is the response structure for quote endpoints
-type QuoteResponse struct {
-	Status string     `json:"status"`
-	Data   data.Quote `json:"data"`
+// maxQuoteBody caps the size of quote request bodies, room for a quote and its translations
+const maxQuoteBody = 64 << 10
+
+// QuoteRequest is the body of quote create and update requests
+type QuoteRequest struct {
+	Text         string            `json:"text"`
+	Author       string            `json:"author"`
+	Tags         []string          `json:"tags"`
+	Language     string            `json:"language"`
+	Translations map[string]string `json:"translations"`
+}
+
+// quote returns the quote described by the request
+func (req QuoteRequest) quote() data.Quote {
+	return data.Quote{Text: req.Text, Author: req.Author, Tags: req.Tags, Language: req.Language, Translations: req.Translations}
+}
+
+// QuoteAPI serves the quote collection held by a data.QuoteService
+type QuoteAPI struct {
+	Quotes *data.QuoteService
+	// Now returns the current time; nil means time.Now
+	Now func() time.Time
+	// VoterTokens maps the API tokens clients send as "Authorization: Bearer <token>"
+	// to the names they vote as
+	VoterTokens map[string]string
+
+	// voterKey signs anonymous voter cookies, so clients cannot make up voter IDs
+	voterKey []byte
 }
 
-// RandomQuoteHandler returns a random quote
-func RandomQuoteHandler(w http.ResponseWriter, r *http.Request) {
-	// Set content type
-	w.Header().Set("Content-Type", "application/json")
+// DailyQuote is the quote of the day for a date in a time zone
+type DailyQuote struct {
+	Date     string     `json:"date"`
+	Timezone string     `json:"timezone"`
+	Quote    data.Quote `json:"quote"`
+}
 
-	// Create a new quote service
-	quoteService := data.NewQuoteService()
+// NewQuoteAPI creates a QuoteAPI for quotes
+func NewQuoteAPI(quotes *data.QuoteService) *QuoteAPI {
+	return &QuoteAPI{Quotes: quotes, voterKey: []byte(randomHex(32))}
+}
+
+// RandomHandler returns a random quote. With ?weighted=true quotes are picked in
+// proportion to their vote score instead of uniformly. When ?lang= or the
+// Accept-Language header asks for languages, the quote is returned in the best
+// available one without its other translations. ?format= or the Accept header
+// selects JSON, plain text, an HTML snippet, an SVG card or Markdown.
+func (api *QuoteAPI) RandomHandler(w http.ResponseWriter, r *http.Request) {
+	preferences, ok := languagePreferences(w, r)
+	if !ok {
+		return
+	}
+	rendering, ok := quoteRenderingFor(w, r)
+	if !ok {
+		return
+	}
+	weighted := false
+	if raw := r.URL.Query().Get("weighted"); raw != "" {
+		var err error
+		weighted, err = strconv.ParseBool(raw)
+		if err != nil {
+			response.Error(w, r, http.StatusBadRequest, response.CodeInvalidParameter, "Query parameter 'weighted' must be 'true' or 'false'")
+			return
+		}
+	}
 
 	// Get a random quote
-	randomQuote := quoteService.GetRandomQuote()
+	getQuote := api.Quotes.GetRandomQuote
+	if weighted {
+		getQuote = api.Quotes.GetWeightedRandomQuote
+	}
+	randomQuote, err := getQuote()
+	if err != nil {
+		writeQuoteError(w, r, err)
+		return
+	}
+	if preferences != nil {
+		randomQuote = randomQuote.In(randomQuote.MatchLanguage(preferences))
+	}
+	w.Header().Set("Content-Language", quoteLanguage(randomQuote))
+
+	// Render and send response
+	writeQuote(w, r, rendering, randomQuote)
+}
+
+// ListHandler returns a page of quotes. ?author= keeps one author's quotes, ?q= searches
+// the text, and ?tag= (repeatable) keeps quotes with every given tag, all ignoring case.
+// ?sort= orders by id (default), author or text, descending with a "-" prefix. ?limit=
+// sets the page size and ?cursor= continues from a previous page, whose URL is also
+// given in a Link header. X-Total-Count carries the number of matching quotes.
+func (api *QuoteAPI) ListHandler(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	query := data.QuoteQuery{
+		Author: params.Get("author"),
+		Search: params.Get("q"),
+		Tags:   params["tag"],
+		Sort:   params.Get("sort"),
+		Cursor: params.Get("cursor"),
+	}
+	if !data.ValidQuoteSort(query.Sort) {
+		response.Error(w, r, http.StatusBadRequest, response.CodeInvalidParameter,
+			"Query parameter 'sort' must be 'id', 'author' or 'text', optionally prefixed with '-'")
+		return
+	}
+	if raw := params.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > data.MaxQuotePageSize {
+			response.Error(w, r, http.StatusBadRequest, response.CodeInvalidParameter,
+				"Query parameter 'limit' must be between 1 and "+strconv.Itoa(data.MaxQuotePageSize))
+			return
+		}
+		query.Limit = limit
+	}
+
+	page, err := api.Quotes.Search(query)
+	if errors.Is(err, data.ErrInvalidCursor) {
+		response.Error(w, r, http.StatusBadRequest, response.CodeInvalidParameter,
+			"Query parameter 'cursor' is invalid or was issued for another sort order")
+		return
+	}
+	if err != nil {
+		writeQuoteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(page.Total))
+	if page.NextCursor != "" {
+		next := *r.URL
+		nextParams := next.Query()
+		nextParams.Set("cursor", page.NextCursor)
+		next.RawQuery = nextParams.Encode()
+		w.Header().Set("Link", "<"+next.RequestURI()+`>; rel="next"`)
+	}
+	response.JSON(w, r, http.StatusOK, page)
+}
+
+// TodayHandler returns the quote of the day. ?tz= names the IANA time zone whose
+// calendar date is used (default UTC) and ?no_repeat=true avoids repeating a quote
+// until the whole collection has been shown. Responses may be cached until the
+// next midnight in that time zone.
+func (api *QuoteAPI) TodayHandler(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
 
-	// Create response
-	response := QuoteResponse{
-		Status: "success",
-		Data:   randomQuote,
+	loc := time.UTC
+	if tz := params.Get("tz"); tz != "" {
+		var err error
+		loc, err = time.LoadLocation(tz)
+		// LoadLocation also accepts "Local", which would leak the server's zone
+		if err != nil || tz == "Local" {
+			response.Error(w, r, http.StatusBadRequest, response.CodeInvalidParameter,
+				"Query parameter 'tz' must be an IANA time zone such as 'Europe/Madrid'")
+			return
+		}
 	}
+	noRepeat := false
+	if raw := params.Get("no_repeat"); raw != "" {
+		var err error
+		noRepeat, err = strconv.ParseBool(raw)
+		if err != nil {
+			response.Error(w, r, http.StatusBadRequest, response.CodeInvalidParameter, "Query parameter 'no_repeat' must be 'true' or 'false'")
+			return
+		}
+	}
+
+	now := time.Now
+	if api.Now != nil {
+		now = api.Now
+	}
+	today := now().In(loc)
+
+	quote, err := api.Quotes.QuoteOfTheDay(today, noRepeat)
+	if err != nil {
+		writeQuoteError(w, r, err)
+		return
+	}
+
+	// Cache until the next local midnight; time.Date normalizes day+1 and DST shifts
+	year, month, day := today.Date()
+	midnight := time.Date(year, month, day+1, 0, 0, 0, 0, loc)
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(midnight.Sub(today).Seconds())))
+	w.Header().Set("Expires", midnight.UTC().Format(http.TimeFormat))
+
+	response.JSON(w, r, http.StatusOK, DailyQuote{
+		Date:     today.Format(time.DateOnly),
+		Timezone: loc.String(),
+		Quote:    quote,
+	})
+}
+
+// CreateHandler adds the quote in the request body and returns it with its ID
+func (api *QuoteAPI) CreateHandler(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeQuoteRequest(w, r)
+	if !ok {
+		return
+	}
+
+	quote, err := api.Quotes.Create(req.quote())
+	if err != nil {
+		writeQuoteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Location", "/quotes/"+quote.ID)
+	response.JSON(w, r, http.StatusCreated, quote)
+}
 
-	// Encode and send response
-	err := json.NewEncoder(w).Encode(response)
+// GetHandler returns the quote named by the {id} path value
+func (api *QuoteAPI) GetHandler(w http.ResponseWriter, r *http.Request) {
+	quote, err := api.Quotes.Get(r.PathValue("id"))
 	if err != nil {
-		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		writeQuoteError(w, r, err)
 		return
 	}
+	response.JSON(w, r, http.StatusOK, quote)
+}
+
+// UpdateHandler replaces the quote named by the {id} path value
+func (api *QuoteAPI) UpdateHandler(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeQuoteRequest(w, r)
+	if !ok {
+		return
+	}
+
+	quote, err := api.Quotes.Update(r.PathValue("id"), req.quote())
+	if err != nil {
+		writeQuoteError(w, r, err)
+		return
+	}
+	response.JSON(w, r, http.StatusOK, quote)
+}
+
+// DeleteHandler removes the quote named by the {id} path value
+func (api *QuoteAPI) DeleteHandler(w http.ResponseWriter, r *http.Request) {
+	if err := api.Quotes.Delete(r.PathValue("id")); err != nil {
+		writeQuoteError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decodeQuoteRequest reads a QuoteRequest body, writing a 400 response when it is malformed
+func decodeQuoteRequest(w http.ResponseWriter, r *http.Request) (QuoteRequest, bool) {
+	var req QuoteRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxQuoteBody))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		response.Error(w, r, http.StatusBadRequest, response.CodeInvalidParameter, "Request body must be a JSON object with 'text', 'author' and optional 'tags', 'language' and 'translations'")
+		return QuoteRequest{}, false
+	}
+	return req, true
+}
+
+// writeQuoteError maps quote service errors to error responses
+func writeQuoteError(w http.ResponseWriter, r *http.Request, err error) {
+	var validationErr *data.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		response.Error(w, r, http.StatusBadRequest, response.CodeInvalidParameter, validationErr.Message)
+	case errors.Is(err, data.ErrQuoteNotFound):
+		response.Error(w, r, http.StatusNotFound, response.CodeNotFound, "Quote not found")
+	case errors.Is(err, data.ErrTooManyVoters):
+		response.Error(w, r, http.StatusConflict, response.CodeLimitReached, "No new voters are accepted right now")
+	default:
+		slog.ErrorContext(r.Context(), "Quote store error", "error", err)
+		response.Error(w, r, http.StatusInternalServerError, response.CodeInternal, "Failed to access quotes")
+	}
 }
@@ -0,0 +1,109 @@
+package routes
+
+import (
+	"bytes"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/jorge2751/GoAPI/internal/api/data"
+	"github.com/jorge2751/GoAPI/internal/api/response"
+)
+
+// maxQuoteImportBody caps the size of quote import files
+const maxQuoteImportBody = 1 << 20
+
+// quoteFormatTypes maps quote file formats to the media type they are served as
+var quoteFormatTypes = map[string]string{
+	data.QuoteFormatJSON: "application/json",
+	data.QuoteFormatCSV:  "text/csv; charset=utf-8",
+	data.QuoteFormatYAML: "application/yaml",
+}
+
+// quoteFormatFromContentType returns the quote file format for a request's media type, or ""
+func quoteFormatFromContentType(contentType string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "application/json":
+		return data.QuoteFormatJSON
+	case "text/csv":
+		return data.QuoteFormatCSV
+	case "application/yaml", "application/x-yaml", "text/yaml", "text/x-yaml":
+		return data.QuoteFormatYAML
+	}
+	return ""
+}
+
+// ImportHandler adds the quotes in the request body, a JSON array, a CSV file with a
+// text,author[,tags] header or a YAML list. The format comes from ?format= or the
+// Content-Type header. Duplicates of stored quotes and invalid rows are skipped and
+// reported; with ?dry_run=true nothing is stored.
+func (api *QuoteAPI) ImportHandler(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	format := params.Get("format")
+	if format == "" {
+		format = quoteFormatFromContentType(r.Header.Get("Content-Type"))
+	}
+	if !data.ValidQuoteFormat(format) {
+		response.Error(w, r, http.StatusBadRequest, response.CodeInvalidParameter,
+			"Set query parameter 'format' or the Content-Type header to json, csv or yaml")
+		return
+	}
+	dryRun := false
+	if raw := params.Get("dry_run"); raw != "" {
+		var err error
+		dryRun, err = strconv.ParseBool(raw)
+		if err != nil {
+			response.Error(w, r, http.StatusBadRequest, response.CodeInvalidParameter, "Query parameter 'dry_run' must be 'true' or 'false'")
+			return
+		}
+	}
+
+	rows, err := data.DecodeQuotes(http.MaxBytesReader(w, r.Body, maxQuoteImportBody), format)
+	if err != nil {
+		response.Error(w, r, http.StatusBadRequest, response.CodeInvalidParameter, "Request body is not a valid quote file: "+err.Error())
+		return
+	}
+
+	report, err := api.Quotes.Import(rows, dryRun)
+	if err != nil {
+		writeQuoteError(w, r, err)
+		return
+	}
+	response.JSON(w, r, http.StatusOK, report)
+}
+
+// ExportHandler returns every quote as a file download in ?format= json (default),
+// csv or yaml. Exported files can be imported again or loaded at startup.
+func (api *QuoteAPI) ExportHandler(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = data.QuoteFormatJSON
+	}
+	if !data.ValidQuoteFormat(format) {
+		response.Error(w, r, http.StatusBadRequest, response.CodeInvalidParameter, "Query parameter 'format' must be json, csv or yaml")
+		return
+	}
+
+	quotes, err := api.Quotes.List()
+	if err != nil {
+		writeQuoteError(w, r, err)
+		return
+	}
+
+	// Encode before writing so a failure can still be reported with a status
+	var buf bytes.Buffer
+	if err := data.EncodeQuotes(&buf, format, quotes); err != nil {
+		slog.ErrorContext(r.Context(), "Error encoding quote export", "format", format, "error", err)
+		response.Error(w, r, http.StatusInternalServerError, response.CodeInternal, "Failed to export quotes")
+		return
+	}
+
+	w.Header().Set("Content-Type", quoteFormatTypes[format])
+	w.Header().Set("Content-Disposition", `attachment; filename="quotes.`+format+`"`)
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		slog.ErrorContext(r.Context(), "Error writing quote export", "error", err)
+	}
+}
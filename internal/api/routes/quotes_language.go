@@ -0,0 +1,44 @@
+package routes
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/jorge2751/GoAPI/internal/api/data"
+	"github.com/jorge2751/GoAPI/internal/api/response"
+)
+
+// languagePreferences returns the languages the client asked for, best first, from
+// ?lang= (a comma-separated list of tags) or else the Accept-Language header. It
+// returns nil when the client expressed no preference, and writes a 400 response
+// and returns false for a malformed ?lang=. The response is marked as varying by
+// Accept-Language either way.
+func languagePreferences(w http.ResponseWriter, r *http.Request) ([]string, bool) {
+	w.Header().Add("Vary", "Accept-Language")
+
+	if raw := r.URL.Query().Get("lang"); raw != "" {
+		var preferences []string
+		for _, tag := range strings.Split(raw, ",") {
+			lang := data.NormalizeLanguage(tag)
+			if lang == "" {
+				response.Error(w, r, http.StatusBadRequest, response.CodeInvalidParameter,
+					"Query parameter 'lang' must be language tags such as 'es' or 'en-US', separated by commas")
+				return nil, false
+			}
+			preferences = append(preferences, lang)
+		}
+		return preferences, true
+	}
+	return parseAcceptLanguage(r.Header.Values("Accept-Language")), true
+}
+
+// parseAcceptLanguage returns the language ranges of Accept-Language header values
+// ordered by quality, dropping malformed ranges and those with q=0
+func parseAcceptLanguage(values []string) []string {
+	return rankByQuality(values, func(lang string) string {
+		if lang == "*" {
+			return lang
+		}
+		return data.NormalizeLanguage(lang)
+	})
+}
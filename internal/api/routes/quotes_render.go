@@ -0,0 +1,281 @@
+package routes
+
+import (
+	"fmt"
+	"html"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jorge2751/GoAPI/internal/api/data"
+	"github.com/jorge2751/GoAPI/internal/api/response"
+)
+
+// Quote rendering formats
+const (
+	QuoteRenderJSON     = "json"
+	QuoteRenderText     = "text"
+	QuoteRenderHTML     = "html"
+	QuoteRenderSVG      = "svg"
+	QuoteRenderMarkdown = "markdown"
+)
+
+// quoteRenderTypes maps media types to the rendering format served for them, in
+// the order formats are listed in errors
+var quoteRenderTypes = []struct {
+	mediaType string
+	format    string
+}{
+	{"application/json", QuoteRenderJSON},
+	{"text/plain", QuoteRenderText},
+	{"text/html", QuoteRenderHTML},
+	{"image/svg+xml", QuoteRenderSVG},
+	{"text/markdown", QuoteRenderMarkdown},
+}
+
+// quoteRenderWildcards maps media ranges with wildcards to the format served for them
+var quoteRenderWildcards = map[string]string{
+	"*/*":           QuoteRenderJSON,
+	"application/*": QuoteRenderJSON,
+	"text/*":        QuoteRenderText,
+	"image/*":       QuoteRenderSVG,
+}
+
+// QuoteTheme holds the colors of HTML and SVG quote cards
+type QuoteTheme struct {
+	Background string
+	Text       string
+	Accent     string
+}
+
+// DefaultQuoteTheme names the theme used without ?theme=
+const DefaultQuoteTheme = "light"
+
+// QuoteThemes are the themes selectable with ?theme=
+var QuoteThemes = map[string]QuoteTheme{
+	"light": {Background: "#ffffff", Text: "#24292f", Accent: "#0969da"},
+	"dark":  {Background: "#0d1117", Text: "#e6edf3", Accent: "#58a6ff"},
+	"sepia": {Background: "#f4ecd8", Text: "#5b4636", Accent: "#a0522d"},
+}
+
+// SVG quote card layout, in pixels
+const (
+	DefaultQuoteCardWidth = 600
+	MinQuoteCardWidth     = 300
+	MaxQuoteCardWidth     = 1200
+
+	cardPadding        = 32
+	cardFontSize       = 20
+	cardLineHeight     = 28
+	cardAuthorFontSize = 16
+	// cardCharWidth estimates the average glyph width of the serif font as a
+	// fraction of its size, since the SVG is laid out without measuring text
+	cardCharWidth = 0.5
+)
+
+// textQuoteWidth is the column plain text quotes are wrapped at
+const textQuoteWidth = 72
+
+// quoteRendering describes how a quote response is rendered
+type quoteRendering struct {
+	format string
+	theme  QuoteTheme
+	width  int
+}
+
+// quoteRenderingFor reads the rendering format from ?format= or else the Accept
+// header, defaulting to JSON, along with ?theme= and ?width=. It writes a 400
+// response and returns false for malformed parameters. The response is marked as
+// varying by Accept either way.
+func quoteRenderingFor(w http.ResponseWriter, r *http.Request) (quoteRendering, bool) {
+	w.Header().Add("Vary", "Accept")
+	params := r.URL.Query()
+	rendering := quoteRendering{format: QuoteRenderJSON, theme: QuoteThemes[DefaultQuoteTheme], width: DefaultQuoteCardWidth}
+
+	if format := params.Get("format"); format != "" {
+		i := slices.IndexFunc(quoteRenderTypes, func(t struct{ mediaType, format string }) bool { return t.format == format })
+		if i < 0 {
+			response.Error(w, r, http.StatusBadRequest, response.CodeInvalidParameter,
+				"Query parameter 'format' must be json, text, html, svg or markdown")
+			return quoteRendering{}, false
+		}
+		rendering.format = format
+	} else {
+		rendering.format = negotiateQuoteFormat(r.Header.Values("Accept"))
+	}
+
+	if name := params.Get("theme"); name != "" {
+		theme, ok := QuoteThemes[name]
+		if !ok {
+			response.Error(w, r, http.StatusBadRequest, response.CodeInvalidParameter, "Query parameter 'theme' must be light, dark or sepia")
+			return quoteRendering{}, false
+		}
+		rendering.theme = theme
+	}
+	if raw := params.Get("width"); raw != "" {
+		width, err := strconv.Atoi(raw)
+		if err != nil || width < MinQuoteCardWidth || width > MaxQuoteCardWidth {
+			response.Error(w, r, http.StatusBadRequest, response.CodeInvalidParameter,
+				fmt.Sprintf("Query parameter 'width' must be between %d and %d", MinQuoteCardWidth, MaxQuoteCardWidth))
+			return quoteRendering{}, false
+		}
+		rendering.width = width
+	}
+	return rendering, true
+}
+
+// negotiateQuoteFormat returns the rendering format for the client's most preferred
+// supported media type, or JSON when none is supported
+func negotiateQuoteFormat(accept []string) string {
+	ranges := rankByQuality(accept, func(mediaType string) string {
+		mediaType = strings.ToLower(mediaType)
+		if !strings.Contains(mediaType, "/") {
+			return ""
+		}
+		return mediaType
+	})
+	for _, mediaType := range ranges {
+		if format, ok := quoteRenderWildcards[mediaType]; ok {
+			return format
+		}
+		for _, t := range quoteRenderTypes {
+			if t.mediaType == mediaType {
+				return t.format
+			}
+		}
+	}
+	return QuoteRenderJSON
+}
+
+// writeQuote writes q rendered as requested
+func writeQuote(w http.ResponseWriter, r *http.Request, rendering quoteRendering, q data.Quote) {
+	var body, contentType string
+	switch rendering.format {
+	case QuoteRenderText:
+		body, contentType = renderQuoteText(q), "text/plain; charset=utf-8"
+	case QuoteRenderHTML:
+		body, contentType = renderQuoteHTML(q, rendering.theme), "text/html; charset=utf-8"
+	case QuoteRenderSVG:
+		body, contentType = renderQuoteSVG(q, rendering.theme, rendering.width), "image/svg+xml"
+	case QuoteRenderMarkdown:
+		body, contentType = renderQuoteMarkdown(q), "text/markdown; charset=utf-8"
+	default:
+		response.JSON(w, r, http.StatusOK, q)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	if _, err := w.Write([]byte(body)); err != nil {
+		slog.ErrorContext(r.Context(), "Error writing quote response", "format", rendering.format, "error", err)
+	}
+}
+
+// quoteLanguage returns the language of the quote's text
+func quoteLanguage(q data.Quote) string {
+	return q.Languages()[0]
+}
+
+// renderQuoteText renders the quote for terminals, wrapped with the author below it
+func renderQuoteText(q data.Quote) string {
+	var b strings.Builder
+	for _, line := range wrapText(`"`+q.Text+`"`, textQuoteWidth) {
+		b.WriteString(line + "\n")
+	}
+	b.WriteString("    — " + q.Author + "\n")
+	return b.String()
+}
+
+// renderQuoteHTML renders the quote as a self-contained HTML snippet with inline
+// styles, so it can be embedded in any page
+func renderQuoteHTML(q data.Quote, theme QuoteTheme) string {
+	text := strings.ReplaceAll(html.EscapeString(q.Text), "\n", "<br>")
+	return fmt.Sprintf(`<figure class="quote" lang="%s" style="margin:0;padding:16px 20px;background:%s;color:%s;border-left:4px solid %s;border-radius:6px;font-family:Georgia,serif">
+  <blockquote style="margin:0;font-size:1.15em;line-height:1.4">%s</blockquote>
+  <figcaption style="margin-top:8px;color:%s">— %s</figcaption>
+</figure>
+`, html.EscapeString(quoteLanguage(q)), theme.Background, theme.Text, theme.Accent, text, theme.Accent, html.EscapeString(q.Author))
+}
+
+// renderQuoteSVG renders the quote as an SVG card width pixels wide, wrapping the
+// text to fit and growing as tall as needed
+func renderQuoteSVG(q data.Quote, theme QuoteTheme, width int) string {
+	maxChars := int(float64(width-2*cardPadding) / (cardFontSize * cardCharWidth))
+	lines := wrapText("“"+q.Text+"”", maxChars)
+	textTop := cardPadding + cardFontSize
+	authorY := textTop + len(lines)*cardLineHeight + cardAuthorFontSize
+	height := authorY + cardPadding
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" role="img" aria-label="%s" xml:lang="%s">`+"\n",
+		width, height, width, height, html.EscapeString(q.Text+" — "+q.Author), html.EscapeString(quoteLanguage(q)))
+	fmt.Fprintf(&b, "  <title>%s</title>\n", html.EscapeString(q.Text+" — "+q.Author))
+	fmt.Fprintf(&b, `  <rect width="%d" height="%d" rx="12" fill="%s"/>`+"\n", width, height, theme.Background)
+	fmt.Fprintf(&b, `  <rect x="12" y="%d" width="4" height="%d" rx="2" fill="%s"/>`+"\n", cardPadding/2, height-cardPadding, theme.Accent)
+	fmt.Fprintf(&b, `  <text font-family="Georgia, serif" font-size="%d" fill="%s">`+"\n", cardFontSize, theme.Text)
+	for i, line := range lines {
+		fmt.Fprintf(&b, `    <tspan x="%d" y="%d">%s</tspan>`+"\n", cardPadding, textTop+i*cardLineHeight, html.EscapeString(line))
+	}
+	b.WriteString("  </text>\n")
+	fmt.Fprintf(&b, `  <text x="%d" y="%d" text-anchor="end" font-family="Georgia, serif" font-size="%d" fill="%s">— %s</text>`+"\n",
+		width-cardPadding, authorY, cardAuthorFontSize, theme.Accent, html.EscapeString(q.Author))
+	b.WriteString("</svg>\n")
+	return b.String()
+}
+
+// markdownEscaper escapes characters with meaning in inline Markdown
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`,
+	"<", `\<`, ">", `\>`, "|", `\|`, "~", `\~`,
+)
+
+// renderQuoteMarkdown renders the quote as a Markdown blockquote with the author in italics
+func renderQuoteMarkdown(q data.Quote) string {
+	var b strings.Builder
+	for _, line := range strings.Split(q.Text, "\n") {
+		line = markdownEscaper.Replace(line)
+		// Keep lines from starting a heading or a list inside the quote
+		if line != "" && strings.ContainsRune("#-+", rune(line[0])) {
+			line = `\` + line
+		} else if digits := len(line) - len(strings.TrimLeft(line, "0123456789")); digits > 0 &&
+			digits < len(line) && (line[digits] == '.' || line[digits] == ')') {
+			line = line[:digits] + `\` + line[digits:]
+		}
+		b.WriteString("> " + line + "\n")
+	}
+	b.WriteString(">\n> — *" + markdownEscaper.Replace(q.Author) + "*\n")
+	return b.String()
+}
+
+// wrapText breaks text into lines of at most width characters at spaces, keeping
+// its line breaks. Words longer than width are split.
+func wrapText(text string, width int) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			for utf8.RuneCountInString(word) > width {
+				if line != "" {
+					lines = append(lines, line)
+					line = ""
+				}
+				runes := []rune(word)
+				lines = append(lines, string(runes[:width]))
+				word = string(runes[width:])
+			}
+			switch {
+			case line == "":
+				line = word
+			case utf8.RuneCountInString(line)+1+utf8.RuneCountInString(word) <= width:
+				line += " " + word
+			default:
+				lines = append(lines, line)
+				line = word
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
@@ -0,0 +1,225 @@
+package routes
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jorge2751/GoAPI/internal/api/data"
+	"github.com/jorge2751/GoAPI/internal/api/response"
+)
+
+// Voter identification
+const (
+	// VoterCookie carries the signed anonymous voter ID given to clients without an API token
+	VoterCookie = "voter_id"
+	// maxVoterNameLength caps the names API tokens vote as
+	maxVoterNameLength = 64
+	// voterCookieMaxAge is how long an anonymous voter ID is remembered
+	voterCookieMaxAge = 365 * 24 * time.Hour
+)
+
+// VoteRequest is the body of a vote: 1 up, -1 down, 0 to withdraw the vote
+type VoteRequest struct {
+	Vote *int `json:"vote"`
+}
+
+// validVoterName reports whether name can name an API client voter
+func validVoterName(name string) bool {
+	if name == "" || len(name) > maxVoterNameLength {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseVoterTokens reads API client voters from a comma-separated list of
+// name:token pairs, such as "my-app:3f9c...,bot:a41e...", returning the tokens
+// mapped to the names they vote as
+func ParseVoterTokens(list string) (map[string]string, error) {
+	tokens := make(map[string]string)
+	for _, pair := range strings.Split(list, ",") {
+		name, token, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok || !validVoterName(name) || token == "" {
+			return nil, fmt.Errorf("voter token %q must be name:token, with a name of 1 to %d letters, digits, '-', '_' or '.'", pair, maxVoterNameLength)
+		}
+		if _, dup := tokens[token]; dup {
+			return nil, fmt.Errorf("voter token for %q is also used by another voter", name)
+		}
+		tokens[token] = name
+	}
+	return tokens, nil
+}
+
+// signVoterID returns the cookie value for an anonymous voter ID: the ID and its HMAC
+func (api *QuoteAPI) signVoterID(id string) string {
+	mac := hmac.New(sha256.New, api.voterKey)
+	mac.Write([]byte(id))
+	return id + "." + hex.EncodeToString(mac.Sum(nil))
+}
+
+// voterFromCookie returns the anonymous voter ID in a voter_id cookie this API signed
+func (api *QuoteAPI) voterFromCookie(r *http.Request) (string, bool) {
+	cookie, err := r.Cookie(VoterCookie)
+	if err != nil {
+		return "", false
+	}
+	id, _, ok := strings.Cut(cookie.Value, ".")
+	if !ok || !hmac.Equal([]byte(cookie.Value), []byte(api.signVoterID(id))) {
+		return "", false
+	}
+	return id, true
+}
+
+// voterID identifies the voter making the request: the API client named by a bearer
+// token in VoterTokens, or the anonymous visitor holding a voter_id cookie. Clients
+// with neither are given a new cookie. Votes and favorites set a voter's standing, so
+// with existing set only known voters are accepted: a client sending no cookie gets
+// one with a 401 and must send it back, which keeps every cookieless request from
+// counting as a new voter. It writes an error response and returns false otherwise.
+func (api *QuoteAPI) voterID(w http.ResponseWriter, r *http.Request, existing bool) (string, bool) {
+	if token, ok := bearerToken(r); ok {
+		for known, name := range api.VoterTokens {
+			if tokenEqual(token, known) {
+				return "client-" + name, true
+			}
+		}
+		writeUnauthorized(w, r, "Unknown API token")
+		return "", false
+	}
+	if id, ok := api.voterFromCookie(r); ok {
+		return id, true
+	}
+
+	id := "anon-" + randomHex(16)
+	http.SetCookie(w, &http.Cookie{
+		Name:     VoterCookie,
+		Value:    api.signVoterID(id),
+		Path:     "/quotes",
+		MaxAge:   int(voterCookieMaxAge.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	if existing {
+		writeUnauthorized(w, r, "Send the "+VoterCookie+" cookie set by this response, or an API token, to vote")
+		return "", false
+	}
+	return id, true
+}
+
+// VoteHandler records the requesting voter's vote on the quote named by the {id}
+// path value and returns the quote's rating
+func (api *QuoteAPI) VoteHandler(w http.ResponseWriter, r *http.Request) {
+	var req VoteRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxQuoteBody))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil || req.Vote == nil {
+		response.Error(w, r, http.StatusBadRequest, response.CodeInvalidParameter, "Request body must be a JSON object with 'vote' set to 1, -1 or 0")
+		return
+	}
+	voter, ok := api.voterID(w, r, true)
+	if !ok {
+		return
+	}
+
+	rating, err := api.Quotes.Vote(r.PathValue("id"), voter, *req.Vote)
+	if errors.Is(err, data.ErrInvalidVote) {
+		response.Error(w, r, http.StatusBadRequest, response.CodeInvalidParameter, "Field 'vote' must be 1, -1 or 0")
+		return
+	}
+	if err != nil {
+		writeQuoteError(w, r, err)
+		return
+	}
+	response.JSON(w, r, http.StatusOK, rating)
+}
+
+// RatingHandler returns the rating of the quote named by the {id} path value,
+// including the requesting voter's own vote
+func (api *QuoteAPI) RatingHandler(w http.ResponseWriter, r *http.Request) {
+	voter, ok := api.voterID(w, r, false)
+	if !ok {
+		return
+	}
+
+	rating, err := api.Quotes.Rating(r.PathValue("id"), voter)
+	if err != nil {
+		writeQuoteError(w, r, err)
+		return
+	}
+	response.JSON(w, r, http.StatusOK, rating)
+}
+
+// FavoriteHandler marks the quote named by the {id} path value as a favorite of the
+// requesting voter
+func (api *QuoteAPI) FavoriteHandler(w http.ResponseWriter, r *http.Request) {
+	api.setFavorite(w, r, true)
+}
+
+// UnfavoriteHandler removes the quote named by the {id} path value from the
+// requesting voter's favorites
+func (api *QuoteAPI) UnfavoriteHandler(w http.ResponseWriter, r *http.Request) {
+	api.setFavorite(w, r, false)
+}
+
+func (api *QuoteAPI) setFavorite(w http.ResponseWriter, r *http.Request, favorite bool) {
+	voter, ok := api.voterID(w, r, true)
+	if !ok {
+		return
+	}
+
+	rating, err := api.Quotes.SetFavorite(r.PathValue("id"), voter, favorite)
+	if err != nil {
+		writeQuoteError(w, r, err)
+		return
+	}
+	response.JSON(w, r, http.StatusOK, rating)
+}
+
+// FavoritesHandler returns the requesting voter's favorite quotes
+func (api *QuoteAPI) FavoritesHandler(w http.ResponseWriter, r *http.Request) {
+	voter, ok := api.voterID(w, r, false)
+	if !ok {
+		return
+	}
+
+	favorites, err := api.Quotes.Favorites(voter)
+	if err != nil {
+		writeQuoteError(w, r, err)
+		return
+	}
+	response.JSON(w, r, http.StatusOK, favorites)
+}
+
+// TopHandler returns the highest-rated quotes with their ratings; ?limit= sets how many
+func (api *QuoteAPI) TopHandler(w http.ResponseWriter, r *http.Request) {
+	limit := data.DefaultTopQuotes
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		var err error
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > data.MaxTopQuotes {
+			response.Error(w, r, http.StatusBadRequest, response.CodeInvalidParameter,
+				"Query parameter 'limit' must be between 1 and "+strconv.Itoa(data.MaxTopQuotes))
+			return
+		}
+	}
+
+	top, err := api.Quotes.Top(limit)
+	if err != nil {
+		writeQuoteError(w, r, err)
+		return
+	}
+	response.JSON(w, r, http.StatusOK, top)
+}
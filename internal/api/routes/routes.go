@@ -1,8 +1,12 @@
 package routes
 
 import (
-	"encoding/json"
 	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/jorge2751/GoAPI/internal/api/middleware"
+	"github.com/jorge2751/GoAPI/internal/api/response"
 )
 
 // Response represents the API response structure
@@ -12,27 +16,177 @@ type Response struct {
 
 // HelloWorldHandler returns a simple hello world JSON response
 func HelloWorldHandler(w http.ResponseWriter, r *http.Request) {
-	// Set content type
-	w.Header().Set("Content-Type", "application/json")
-
 	// Create response
-	response := Response{
+	hello := Response{
 		Message: "Hello World from Go API!",
 	}
 
 	// Encode and send response
-	err := json.NewEncoder(w).Encode(response)
-	if err != nil {
-		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
-		return
-	}
+	response.JSON(w, r, http.StatusOK, hello)
+}
+
+// route is a single method-qualified endpoint
+type route struct {
+	method  string
+	path    string
+	handler http.HandlerFunc
 }
 
-// RegisterRoutes sets up all API routes with the given mux
-func RegisterRoutes(mux *http.ServeMux, middleware func(http.HandlerFunc) http.HandlerFunc, weatherService *WeatherService) {
+// Services are the long-lived dependencies the routes serve from. They are created
+// once at startup and shared by every request.
+type Services struct {
+	Quotes        *QuoteAPI
+	Art           *ArtAPI
+	Weather       *WeatherService
+	Subscriptions *SubscriptionManager
+	Streamer      *WeatherStreamer
+	// Debug registers the /debug routes, which expose internal state without
+	// authentication and so are off by default
+	Debug bool
+}
+
+// RegisterRoutes sets up all API routes with the given mux.
+// Every route is wrapped with chain; routes that need extra middleware derive
+// their own chain with chain.Use.
+func RegisterRoutes(mux *http.ServeMux, chain middleware.Chain, services Services) {
 	// Register routes with middleware
-	mux.HandleFunc("/hello_world", middleware(HelloWorldHandler))
-	mux.HandleFunc("/quotes/random", middleware(RandomQuoteHandler))
-	mux.HandleFunc("/art", middleware(ArtHandler))
-	mux.HandleFunc("/weather", middleware(weatherService.WeatherHandler))
+	handle(mux, chain, []route{
+		{http.MethodGet, "/hello_world", HelloWorldHandler},
+		{http.MethodGet, "/quotes/random", services.Quotes.RandomHandler},
+		{http.MethodGet, "/quotes", services.Quotes.ListHandler},
+		{http.MethodGet, "/quotes/today", services.Quotes.TodayHandler},
+		{http.MethodPost, "/quotes/import", services.Quotes.ImportHandler},
+		{http.MethodGet, "/quotes/export", services.Quotes.ExportHandler},
+		{http.MethodGet, "/quotes/top", services.Quotes.TopHandler},
+		{http.MethodGet, "/quotes/favorites", services.Quotes.FavoritesHandler},
+		{http.MethodPost, "/quotes", services.Quotes.CreateHandler},
+		{http.MethodGet, "/quotes/{id}", services.Quotes.GetHandler},
+		{http.MethodPut, "/quotes/{id}", services.Quotes.UpdateHandler},
+		{http.MethodDelete, "/quotes/{id}", services.Quotes.DeleteHandler},
+		{http.MethodGet, "/quotes/{id}/vote", services.Quotes.RatingHandler},
+		{http.MethodPut, "/quotes/{id}/vote", services.Quotes.VoteHandler},
+		{http.MethodPut, "/quotes/{id}/favorite", services.Quotes.FavoriteHandler},
+		{http.MethodDelete, "/quotes/{id}/favorite", services.Quotes.UnfavoriteHandler},
+		{http.MethodGet, "/art", services.Art.ListHandler},
+		{http.MethodGet, "/art/random", services.Art.RandomHandler},
+		{http.MethodGet, "/art/{id}", services.Art.GetHandler},
+		{http.MethodGet, "/weather", services.Weather.WeatherHandler},
+		{http.MethodPost, "/weather/batch", services.Weather.BatchHandler},
+		{http.MethodGet, "/weather/forecast", services.Weather.ForecastHandler},
+		{http.MethodGet, "/weather/history", services.Weather.HistoryHandler},
+		{http.MethodGet, "/weather/astronomy", services.Weather.AstronomyHandler},
+		{http.MethodGet, "/weather/stream", services.Streamer.StreamHandler},
+		{http.MethodPost, "/weather/subscriptions", services.Subscriptions.CreateHandler},
+		{http.MethodGet, "/weather/subscriptions/{id}", services.Subscriptions.GetHandler},
+		{http.MethodDelete, "/weather/subscriptions/{id}", services.Subscriptions.DeleteHandler},
+	})
+
+	if services.Debug {
+		handle(mux, chain, []route{
+			{http.MethodGet, "/debug/weather", services.Weather.DebugHandler},
+		})
+	}
+}
+
+// handle registers each route under a "METHOD /path" pattern and answers OPTIONS for
+// every path with the methods it supports. ServeMux serves HEAD through the GET handler
+// and replies 405 with an Allow header for any other method.
+func handle(mux *http.ServeMux, chain middleware.Chain, routes []route) {
+	allowed := make(map[string][]string)
+	var paths []string
+
+	for _, rt := range routes {
+		mux.Handle(rt.method+" "+rt.path, chain.ThenFunc(rt.handler))
+
+		if _, seen := allowed[rt.path]; !seen {
+			paths = append(paths, rt.path)
+		}
+		allowed[rt.path] = append(allowed[rt.path], rt.method)
+	}
+
+	for _, path := range paths {
+		mux.Handle(http.MethodOptions+" "+path, chain.Then(optionsHandler(allowHeader(allowed[path]))))
+	}
+}
+
+// allowHeader builds the Allow header value for a path served with the given methods
+func allowHeader(methods []string) string {
+	all := append([]string{http.MethodOptions}, methods...)
+	if slices.Contains(methods, http.MethodGet) {
+		all = append(all, http.MethodHead)
+	}
+	slices.Sort(all)
+	return strings.Join(slices.Compact(all), ", ")
+}
+
+// optionsHandler answers OPTIONS requests with the allowed methods and no body
+func optionsHandler(allow string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Allow", allow)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// routeMethods are the methods checked when building the Allow header of a 405;
+// HEAD and OPTIONS are added by allowHeader
+var routeMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// FallbackHandler serves requests through mux, replacing net/http's plain-text
+// 404 and 405 replies for unrouted requests with the JSON error envelope.
+// Unrouted requests are wrapped with chain, as RegisterRoutes wraps routed ones,
+// so every response is logged and recovered.
+//
+// A fixed path such as /quotes/random is its own route even though wildcard routes
+// like PUT /quotes/{id} also match it, so PUT /quotes/random is a 405 rather than a
+// lookup of the quote "random". The route a path belongs to is the one its OPTIONS
+// request reaches, which keeps 405 and OPTIONS Allow headers the same.
+func FallbackHandler(mux *http.ServeMux, chain middleware.Chain) http.Handler {
+	fallback := chain.ThenFunc(func(w http.ResponseWriter, r *http.Request) {
+		if allow := allowedMethods(mux, r); allow != "" {
+			w.Header().Set("Allow", allow)
+			response.Error(w, r, http.StatusMethodNotAllowed, response.CodeMethodNotAllowed,
+				"Method "+r.Method+" is not allowed for "+r.URL.Path)
+			return
+		}
+		response.Error(w, r, http.StatusNotFound, response.CodeNotFound,
+			"No route for "+r.URL.Path)
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := routePath(mux, r, r.Method)
+		if owner := routePath(mux, r, http.MethodOptions); path != "" && (owner == "" || path == owner) {
+			mux.ServeHTTP(w, r)
+			return
+		}
+		fallback.ServeHTTP(w, r)
+	})
+}
+
+// allowedMethods builds the Allow header for r's path from the methods routed on the
+// same path as its OPTIONS request, or on any path when there is no OPTIONS route.
+// It returns "" when no method is routed.
+func allowedMethods(mux *http.ServeMux, r *http.Request) string {
+	owner := routePath(mux, r, http.MethodOptions)
+	var methods []string
+	for _, method := range routeMethods {
+		if path := routePath(mux, r, method); path != "" && (owner == "" || path == owner) {
+			methods = append(methods, method)
+		}
+	}
+	if len(methods) == 0 {
+		return ""
+	}
+	return allowHeader(methods)
+}
+
+// routePath returns the path of the pattern mux would route r to with the given
+// method, or "" when nothing matches
+func routePath(mux *http.ServeMux, r *http.Request, method string) string {
+	probe := *r
+	probe.Method = method
+	_, pattern := mux.Handler(&probe)
+	if _, path, ok := strings.Cut(pattern, " "); ok {
+		return path
+	}
+	return pattern
 }
@@ -1,110 +1,428 @@
 package routes
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"io"
+	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
+	"sync/atomic"
 	"time"
+
+	"github.com/jorge2751/GoAPI/internal/api/response"
+)
+
+// Default cache settings used by NewWeatherService
+const (
+	DefaultWeatherCacheTTL        = 5 * time.Minute
+	DefaultWeatherCacheStale      = 10 * time.Minute
+	DefaultWeatherCacheMaxEntries = 1000
 )
 
+// revalidateTimeout bounds background refreshes of stale cache entries
+const revalidateTimeout = 15 * time.Second
+
 // WeatherService holds dependencies for the weather handler
 type WeatherService struct {
-	APIKey     string
-	HTTPClient *http.Client
-	BaseURL    string
+	// Providers are tried in order: the first is the primary and the rest are
+	// used as failover when the ones before them fail
+	Providers []WeatherProvider
+
+	// Cache holds recent responses; nil disables caching
+	Cache *WeatherCache
+
+	flights          flightGroup[CurrentWeather]
+	upstreamRequests atomic.Int64
+	failovers        atomic.Int64
 }
 
-// NewWeatherService creates a new WeatherService instance
+// NewWeatherService creates a new WeatherService instance backed by WeatherAPI
 func NewWeatherService(apiKey string) *WeatherService {
+	return NewWeatherServiceWithProviders(NewWeatherAPIProvider(apiKey))
+}
+
+// NewWeatherServiceWithProviders creates a WeatherService using the given providers in failover order
+func NewWeatherServiceWithProviders(providers ...WeatherProvider) *WeatherService {
 	return &WeatherService{
-		APIKey:     apiKey,
-		HTTPClient: &http.Client{Timeout: 10 * time.Second},
-		BaseURL:    "http://api.weatherapi.com/v1",
+		Providers: providers,
+		Cache:     NewWeatherCache(DefaultWeatherCacheTTL, DefaultWeatherCacheStale, DefaultWeatherCacheMaxEntries),
+	}
+}
+
+// CloseIdleConnections closes any idle keep-alive connections to the providers' APIs.
+// It is meant to be registered as a server shutdown hook.
+func (s *WeatherService) CloseIdleConnections() {
+	for _, provider := range s.Providers {
+		if closer, ok := provider.(interface{ CloseIdleConnections() }); ok {
+			closer.CloseIdleConnections()
+		}
 	}
 }
 
-// WeatherAPIResponse defines the structure for the relevant parts of the WeatherAPI response
-type WeatherAPIResponse struct {
-	Location struct {
-		Name    string `json:"name"`
-		Region  string `json:"region"`
-		Country string `json:"country"`
-	} `json:"location"`
-	Current struct {
-		TempF     float64 `json:"temp_f"`
-		Condition struct {
-			Text string `json:"text"`
-		} `json:"condition"`
-	} `json:"current"`
+// WeatherStats reports counters about upstream traffic
+type WeatherStats struct {
+	// UpstreamRequests is the number of lookups sent to the providers
+	UpstreamRequests int64 `json:"upstream_requests"`
+	// Coalesced is the number of lookups that shared another lookup's upstream call
+	Coalesced int64 `json:"coalesced"`
+	// Failovers is the number of times a lookup fell back to the next provider
+	Failovers int64 `json:"failovers"`
 }
 
-// WeatherHandler fetches weather data for a given city
+// Stats returns a snapshot of the service's counters
+func (s *WeatherService) Stats() WeatherStats {
+	return WeatherStats{
+		UpstreamRequests: s.upstreamRequests.Load(),
+		Coalesced:        s.flights.joined.Load(),
+		Failovers:        s.failovers.Load(),
+	}
+}
+
+// CurrentWeather is the provider-neutral current weather for a location.
+// It carries every measurement in both metric and imperial units; handlers
+// turn it into a CurrentWeatherReport in the units the client asked for.
+type CurrentWeather struct {
+	Location WeatherLocation   `json:"location"`
+	Current  WeatherConditions `json:"current"`
+	// Provider names the provider that supplied the data
+	Provider string `json:"provider"`
+}
+
+// WeatherLocation identifies where the weather applies
+type WeatherLocation struct {
+	Name      string  `json:"name"`
+	Region    string  `json:"region"`
+	Country   string  `json:"country"`
+	Lat       float64 `json:"lat"`
+	Lon       float64 `json:"lon"`
+	Timezone  string  `json:"timezone"`
+	LocalTime string  `json:"local_time"` // "2006-01-02 15:04" in the location's timezone
+}
+
+// WeatherConditions are the observed conditions at a location
+type WeatherConditions struct {
+	TempC      float64 `json:"temp_c"`
+	TempF      float64 `json:"temp_f"`
+	FeelsLikeC float64 `json:"feels_like_c"`
+	FeelsLikeF float64 `json:"feels_like_f"`
+	Condition  string  `json:"condition"`
+	Humidity   int     `json:"humidity"` // percent
+	WindKPH    float64 `json:"wind_kph"`
+	WindMPH    float64 `json:"wind_mph"`
+	WindDegree int     `json:"wind_degree"`
+	WindDir    string  `json:"wind_dir"` // 16-point compass direction
+	PressureMB float64 `json:"pressure_mb"`
+	PressureIN float64 `json:"pressure_in"`
+	UV         float64 `json:"uv"`
+	VisKM      float64 `json:"vis_km"`
+	VisMiles   float64 `json:"vis_miles"`
+}
+
+// CurrentWeatherReport is the /weather response body, with measurements in one unit system
+type CurrentWeatherReport struct {
+	Location WeatherLocation  `json:"location"`
+	Current  ConditionsReport `json:"current"`
+	Units    UnitLabels       `json:"units"`
+	Provider string           `json:"provider"`
+}
+
+// ConditionsReport holds the current conditions in the units named by UnitLabels
+type ConditionsReport struct {
+	Temperature   float64 `json:"temperature"`
+	FeelsLike     float64 `json:"feels_like"`
+	Condition     string  `json:"condition"`
+	Humidity      int     `json:"humidity"`
+	WindSpeed     float64 `json:"wind_speed"`
+	WindDegree    int     `json:"wind_degree"`
+	WindDirection string  `json:"wind_direction"`
+	Pressure      float64 `json:"pressure"`
+	UV            float64 `json:"uv"`
+	Visibility    float64 `json:"visibility"`
+}
+
+// Report converts the weather to a report in the given units
+func (c CurrentWeather) Report(units Units) CurrentWeatherReport {
+	cur := c.Current
+	conditions := ConditionsReport{
+		Condition:     cur.Condition,
+		Humidity:      cur.Humidity,
+		WindDegree:    cur.WindDegree,
+		WindDirection: cur.WindDir,
+		UV:            cur.UV,
+	}
+	if units == UnitsMetric {
+		conditions.Temperature = cur.TempC
+		conditions.FeelsLike = cur.FeelsLikeC
+		conditions.WindSpeed = cur.WindKPH
+		conditions.Pressure = cur.PressureMB
+		conditions.Visibility = cur.VisKM
+	} else {
+		conditions.Temperature = cur.TempF
+		conditions.FeelsLike = cur.FeelsLikeF
+		conditions.WindSpeed = cur.WindMPH
+		conditions.Pressure = cur.PressureIN
+		conditions.Visibility = cur.VisMiles
+	}
+
+	return CurrentWeatherReport{
+		Location: c.Location,
+		Current:  conditions,
+		Units:    units.labels(),
+		Provider: c.Provider,
+	}
+}
+
+// cacheResult describes where a weather response came from
+type cacheResult struct {
+	state     cacheState
+	fetchedAt time.Time
+}
+
+// WeatherHandler fetches weather data for a location given as ?city=, ?lat=&lon=,
+// ?postal_code= or ?ip= (an address, or "auto" for the client's own).
+// ?units=metric|imperial selects the measurement system (default imperial).
 func (s *WeatherService) WeatherHandler(w http.ResponseWriter, r *http.Request) {
-	// Get city from query parameters
-	city := r.URL.Query().Get("city")
-	if city == "" {
-		http.Error(w, "Query parameter 'city' is required", http.StatusBadRequest)
+	// Get location from query parameters
+	loc, ok := requireLocation(w, r)
+	if !ok {
 		return
 	}
 
-	// Use API key from the service struct
-	if s.APIKey == "" {
-		http.Error(w, "WeatherAPI key not configured in service", http.StatusInternalServerError)
-		fmt.Println("Error: WeatherAPI key not configured in WeatherService.") // Log for server admin
+	units, ok := parseUnits(r.URL.Query().Get("units"))
+	if !ok {
+		response.Error(w, r, http.StatusBadRequest, response.CodeInvalidParameter, "Query parameter 'units' must be 'metric' or 'imperial'")
 		return
 	}
 
-	// Construct WeatherAPI URL using BaseURL
-	apiURL := fmt.Sprintf("%s/current.json?key=%s&q=%s&aqi=no", s.BaseURL, s.APIKey, city)
-
-	// Make GET request using the service's HTTP client
-	req, err := http.NewRequest("GET", apiURL, nil)
+	weatherData, result, err := s.currentWeather(r.Context(), loc)
 	if err != nil {
-		http.Error(w, "Failed to create weather API request", http.StatusInternalServerError)
-		fmt.Printf("Error creating weather request: %v\n", err)
+		s.writeError(w, r, err)
 		return
 	}
 
-	resp, err := s.HTTPClient.Do(req)
-	if err != nil {
-		http.Error(w, "Failed to fetch weather data", http.StatusInternalServerError)
-		fmt.Printf("Error fetching weather data: %v\n", err) // Log error
-		return
+	// Tell clients how fresh the data is
+	s.setCacheHeaders(w, result, loc)
+
+	// Encode and send response
+	response.JSON(w, r, http.StatusOK, weatherData.Report(units))
+}
+
+// currentWeather returns the current weather for loc, serving from the cache when possible.
+// Stale entries are returned immediately while a background request refreshes them.
+func (s *WeatherService) currentWeather(ctx context.Context, loc LocationQuery) (CurrentWeather, cacheResult, error) {
+	if s.Cache == nil {
+		weatherData, err := s.fetchShared(ctx, loc)
+		return weatherData, cacheResult{state: cacheMiss, fetchedAt: time.Now()}, err
 	}
-	defer resp.Body.Close()
 
-	// Check response status
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body) // Read body for more info if possible
-		errorMsg := fmt.Sprintf("WeatherAPI request failed with status %d: %s", resp.StatusCode, string(bodyBytes))
-		http.Error(w, errorMsg, http.StatusInternalServerError)
-		fmt.Println(errorMsg) // Log error
-		return
+	key := loc.key()
+	entry, state := s.Cache.get(key)
+	switch state {
+	case cacheFresh:
+		return entry.value, cacheResult{state: state, fetchedAt: entry.fetchedAt}, nil
+	case cacheStale:
+		if s.Cache.startRefresh(key) {
+			// Keep the request's values (e.g. request ID) but not its cancellation
+			go s.revalidate(context.WithoutCancel(ctx), key, loc)
+		}
+		return entry.value, cacheResult{state: state, fetchedAt: entry.fetchedAt}, nil
 	}
 
-	// Read response body
-	body, err := io.ReadAll(resp.Body)
+	weatherData, err := s.fetchShared(ctx, loc)
 	if err != nil {
-		http.Error(w, "Failed to read weather data response", http.StatusInternalServerError)
-		fmt.Printf("Error reading weather data response: %v\n", err) // Log error
-		return
+		return CurrentWeather{}, cacheResult{}, err
 	}
+	entry = s.Cache.set(key, weatherData)
+	return weatherData, cacheResult{state: cacheMiss, fetchedAt: entry.fetchedAt}, nil
+}
 
-	// Parse JSON response
-	var weatherData WeatherAPIResponse
-	err = json.Unmarshal(body, &weatherData)
+// revalidate refreshes a stale cache entry in the background
+func (s *WeatherService) revalidate(ctx context.Context, key string, loc LocationQuery) {
+	ctx, cancel := context.WithTimeout(ctx, revalidateTimeout)
+	defer cancel()
+
+	weatherData, err := s.fetchShared(ctx, loc)
 	if err != nil {
-		http.Error(w, "Failed to parse weather data", http.StatusInternalServerError)
-		fmt.Printf("Error parsing weather data JSON: %v\n", err) // Log error
+		s.Cache.endRefresh(key)
+		slog.WarnContext(ctx, "Error revalidating cached weather data", "location", loc.String(), "error", err)
 		return
 	}
+	s.Cache.set(key, weatherData)
+}
 
-	// Set content type and encode response
-	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(weatherData)
-	if err != nil {
-		// Don't use http.Error here as headers might have been written
-		fmt.Printf("Error encoding weather response: %v\n", err)
+// fetchShared fetches the current weather for loc, sharing one upstream call between
+// concurrent lookups of the same location
+func (s *WeatherService) fetchShared(ctx context.Context, loc LocationQuery) (CurrentWeather, error) {
+	weatherData, _, err := s.flights.do(ctx, loc.key(), func(ctx context.Context) (CurrentWeather, error) {
+		s.upstreamRequests.Add(1)
+		return s.fetchCurrent(ctx, loc)
+	})
+	return weatherData, err
+}
+
+// fetchCurrent asks each provider in turn for the current weather until one succeeds
+func (s *WeatherService) fetchCurrent(ctx context.Context, loc LocationQuery) (CurrentWeather, error) {
+	return withFailover(ctx, s, func(provider WeatherProvider) (CurrentWeather, error) {
+		return provider.Current(ctx, loc)
+	})
+}
+
+// withFailover calls fetch with each provider in order until one succeeds.
+// Errors that another provider cannot fix, such as an unknown location or a
+// cancelled request, are returned immediately.
+func withFailover[T any](ctx context.Context, s *WeatherService, fetch func(WeatherProvider) (T, error)) (T, error) {
+	var zero T
+	if len(s.Providers) == 0 {
+		return zero, errors.New("no weather providers configured")
+	}
+
+	var err error
+	for i, provider := range s.Providers {
+		if i > 0 {
+			s.failovers.Add(1)
+			slog.WarnContext(ctx, "Weather provider failed, trying next",
+				"failed_provider", s.Providers[i-1].Name(), "next_provider", provider.Name(), "error", err)
+		}
+
+		var result T
+		result, err = fetch(provider)
+		if err == nil {
+			return result, nil
+		}
+		if errors.Is(err, errLocationNotFound) || ctx.Err() != nil {
+			return zero, err
+		}
+	}
+	return zero, err
+}
+
+// writeError maps an error from the weather lookup to an error response
+func (s *WeatherService) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, errCircuitOpen) {
+		if wait := s.breakerRetryAfter(); wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		}
+	}
+
+	status, body := lookupError(r.Context(), err)
+	response.Error(w, r, status, body.Code, body.Message)
+}
+
+// lookupError maps an error from the weather lookup to a status and error body,
+// logging the errors a server admin needs to know about
+func lookupError(ctx context.Context, err error) (int, response.ErrorBody) {
+	var upstreamErr *upstreamError
+
+	switch {
+	case errors.Is(err, errCircuitOpen):
+		return http.StatusServiceUnavailable, response.ErrorBody{Code: response.CodeUpstreamUnavailable, Message: "Weather service is temporarily unavailable, try again later"}
+	case errors.Is(err, errAPIKeyMissing):
+		slog.ErrorContext(ctx, "WeatherAPI key not configured in WeatherService") // Log for server admin
+		return http.StatusInternalServerError, response.ErrorBody{Code: response.CodeNotConfigured, Message: err.Error()}
+	case errors.Is(err, errLocationNotFound):
+		return http.StatusNotFound, response.ErrorBody{Code: response.CodeNotFound, Message: "Location not found"}
+	case errors.Is(err, errLocationUnsupported):
+		return http.StatusBadRequest, response.ErrorBody{Code: response.CodeInvalidParameter, Message: "No configured weather provider supports this kind of location"}
+	case errors.Is(err, errUpstreamRejected):
+		return http.StatusBadRequest, response.ErrorBody{Code: response.CodeInvalidParameter, Message: "The weather provider rejected the location"}
+	case errors.Is(err, errUpstreamQuota):
+		slog.WarnContext(ctx, "Weather provider quota exceeded", "error", err)
+		return http.StatusTooManyRequests, response.ErrorBody{Code: response.CodeRateLimited, Message: "Weather lookups are rate limited, try again later"}
+	case errors.Is(err, errUpstreamAuth):
+		slog.ErrorContext(ctx, "Weather provider rejected the API key, check WEATHERAPI_KEY", "error", err) // Log for server admin
+		return http.StatusBadGateway, response.ErrorBody{Code: response.CodeUpstreamFailure, Message: "Failed to fetch weather data"}
+	case errors.As(err, &upstreamErr):
+		// err rather than upstreamErr is logged: providers wrap it to redact secrets
+		slog.ErrorContext(ctx, "Weather provider request failed", "provider", upstreamErr.Provider, "status", upstreamErr.StatusCode, "error", err) // Log error
+		return http.StatusBadGateway, response.ErrorBody{Code: response.CodeUpstreamFailure,
+			Message: fmt.Sprintf("Weather provider request failed with status %d", upstreamErr.StatusCode)}
+	default:
+		slog.ErrorContext(ctx, "Error fetching weather data", "error", err) // Log error
+		return http.StatusBadGateway, response.ErrorBody{Code: response.CodeUpstreamFailure, Message: "Failed to fetch weather data"}
+	}
+}
+
+// breakerRetryAfter returns the shortest wait until any provider's breaker allows a trial request
+func (s *WeatherService) breakerRetryAfter() time.Duration {
+	var wait time.Duration
+	found := false
+	for _, provider := range s.Providers {
+		p, ok := provider.(interface{ Status() UpstreamStatus })
+		if !ok {
+			continue
+		}
+		status := p.Status()
+		if status.Breaker == nil || status.Breaker.RetryAt == nil {
+			continue
+		}
+		until := max(time.Until(*status.Breaker.RetryAt), 0)
+		if !found || until < wait {
+			wait = until
+			found = true
+		}
+	}
+	return wait
+}
+
+// setCacheHeaders sets Cache-Control, Age and X-Cache from the cache result. IP
+// lookups may only be cached by the client: with ip=auto the location comes from
+// the client's address, which shared caches do not key on.
+func (s *WeatherService) setCacheHeaders(w http.ResponseWriter, result cacheResult, loc LocationQuery) {
+	if s.Cache == nil {
+		w.Header().Set("Cache-Control", "no-cache")
+		return
+	}
+
+	age := time.Since(result.fetchedAt)
+	if age < 0 {
+		age = 0
+	}
+	maxAge := s.Cache.TTL - age
+	if maxAge < 0 {
+		maxAge = 0
+	}
+
+	scope := "public"
+	if loc.Kind == LocationIP {
+		scope = "private"
 	}
+	w.Header().Set("Cache-Control", fmt.Sprintf("%s, max-age=%d, stale-while-revalidate=%d",
+		scope, int(maxAge.Seconds()), int(s.Cache.StaleWhileRevalidate.Seconds())))
+	w.Header().Set("Age", strconv.Itoa(int(age.Seconds())))
+	w.Header().Set("X-Cache", result.state.String())
+}
+
+// providerDebugInfo describes one provider on the debug endpoint
+type providerDebugInfo struct {
+	Name string `json:"name"`
+	UpstreamStatus
+}
+
+// weatherDebugInfo is the body of the weather debug endpoint
+type weatherDebugInfo struct {
+	Providers    []providerDebugInfo `json:"providers"`
+	Stats        WeatherStats        `json:"stats"`
+	CacheEntries int                 `json:"cache_entries"`
+}
+
+// DebugHandler reports each provider's circuit breaker state and the upstream counters
+func (s *WeatherService) DebugHandler(w http.ResponseWriter, r *http.Request) {
+	info := weatherDebugInfo{
+		Providers: make([]providerDebugInfo, 0, len(s.Providers)),
+		Stats:     s.Stats(),
+	}
+	for _, provider := range s.Providers {
+		providerInfo := providerDebugInfo{Name: provider.Name()}
+		if p, ok := provider.(interface{ Status() UpstreamStatus }); ok {
+			providerInfo.UpstreamStatus = p.Status()
+		}
+		info.Providers = append(info.Providers, providerInfo)
+	}
+	if s.Cache != nil {
+		info.CacheEntries = s.Cache.Len()
+	}
+
+	response.JSON(w, r, http.StatusOK, info)
 }
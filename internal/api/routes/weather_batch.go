@@ -0,0 +1,135 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/jorge2751/GoAPI/internal/api/response"
+)
+
+// Limits for batch weather lookups
+const (
+	// MaxWeatherBatchSize is the most locations one batch request may contain
+	MaxWeatherBatchSize = 20
+	// DefaultWeatherBatchConcurrency is how many locations of a batch are fetched at once
+	DefaultWeatherBatchConcurrency = 4
+	// maxWeatherBatchBody bounds the size of a batch request body
+	maxWeatherBatchBody = 64 << 10
+)
+
+// WeatherBatchRequest is the body of POST /weather/batch
+type WeatherBatchRequest struct {
+	Locations []LocationRequest `json:"locations"`
+	// Units selects the measurement system of every result (default imperial)
+	Units string `json:"units,omitempty"`
+}
+
+// WeatherBatchResult is the outcome of one location of a batch, in request order.
+// Exactly one of Data and Error is set.
+type WeatherBatchResult struct {
+	Index    int                   `json:"index"`
+	Location string                `json:"location,omitempty"`
+	Status   int                   `json:"status"`
+	Data     *CurrentWeatherReport `json:"data,omitempty"`
+	Error    *response.ErrorBody   `json:"error,omitempty"`
+}
+
+// WeatherBatchResponse is the response body of POST /weather/batch
+type WeatherBatchResponse struct {
+	Results   []WeatherBatchResult `json:"results"`
+	Succeeded int                  `json:"succeeded"`
+	Failed    int                  `json:"failed"`
+}
+
+// BatchHandler looks up the current weather for up to MaxWeatherBatchSize locations.
+// Lookups run concurrently, at most DefaultWeatherBatchConcurrency at a time, and
+// share the cache with /weather. A failed location does not fail the batch: each
+// result carries its own status and error.
+func (s *WeatherService) BatchHandler(w http.ResponseWriter, r *http.Request) {
+	var req WeatherBatchRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxWeatherBatchBody))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		response.Error(w, r, http.StatusBadRequest, response.CodeInvalidParameter, "Request body must be a JSON object with a 'locations' array")
+		return
+	}
+
+	switch n := len(req.Locations); {
+	case n == 0:
+		response.Error(w, r, http.StatusBadRequest, response.CodeMissingParameter, "Field 'locations' must contain at least one location")
+		return
+	case n > MaxWeatherBatchSize:
+		response.Error(w, r, http.StatusBadRequest, response.CodeInvalidParameter,
+			"Field 'locations' may contain at most "+strconv.Itoa(MaxWeatherBatchSize)+" locations")
+		return
+	}
+
+	units, ok := parseUnits(req.Units)
+	if !ok {
+		response.Error(w, r, http.StatusBadRequest, response.CodeInvalidParameter, "Field 'units' must be 'metric' or 'imperial'")
+		return
+	}
+
+	results := make([]WeatherBatchResult, len(req.Locations))
+	sem := make(chan struct{}, DefaultWeatherBatchConcurrency)
+	var wg sync.WaitGroup
+
+	for i, locReq := range req.Locations {
+		results[i].Index = i
+
+		loc, err := locReq.resolve(r)
+		if err != nil {
+			code, message := describeLocationError(err)
+			if err == errNoLocation {
+				message = "Location must have 'city', 'lat' and 'lon', 'postal_code' or 'ip'"
+			}
+			results[i].Status = http.StatusBadRequest
+			results[i].Error = &response.ErrorBody{Code: code, Message: message}
+			continue
+		}
+		results[i].Location = loc.String()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			// Bound the number of lookups in flight
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-r.Context().Done():
+				results[i].Status, results[i].Error = lookupErrorBody(r, r.Context().Err())
+				return
+			}
+
+			weatherData, _, err := s.currentWeather(r.Context(), loc)
+			if err != nil {
+				results[i].Status, results[i].Error = lookupErrorBody(r, err)
+				return
+			}
+			report := weatherData.Report(units)
+			results[i].Status = http.StatusOK
+			results[i].Data = &report
+		}()
+	}
+	wg.Wait()
+
+	resp := WeatherBatchResponse{Results: results}
+	for _, result := range results {
+		if result.Error != nil {
+			resp.Failed++
+		} else {
+			resp.Succeeded++
+		}
+	}
+
+	response.JSON(w, r, http.StatusOK, resp)
+}
+
+// lookupErrorBody is lookupError returning the body by pointer, as batch results hold it
+func lookupErrorBody(r *http.Request, err error) (int, *response.ErrorBody) {
+	status, body := lookupError(r.Context(), err)
+	return status, &body
+}
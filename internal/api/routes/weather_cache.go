@@ -0,0 +1,153 @@
+package routes
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cacheState describes how fresh a cached entry is
+type cacheState int
+
+const (
+	cacheMiss cacheState = iota
+	cacheFresh
+	cacheStale
+)
+
+// String returns the value used for the X-Cache response header
+func (cs cacheState) String() string {
+	switch cs {
+	case cacheFresh:
+		return "HIT"
+	case cacheStale:
+		return "STALE"
+	default:
+		return "MISS"
+	}
+}
+
+// WeatherCache is an in-memory LRU cache of weather responses keyed by normalized city.
+// Entries are fresh for TTL, then served stale for up to StaleWhileRevalidate while a
+// background refresh runs. It is safe for concurrent use.
+type WeatherCache struct {
+	TTL                  time.Duration
+	StaleWhileRevalidate time.Duration
+	MaxEntries           int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // front is most recently used
+	now     func() time.Time
+}
+
+// cacheEntry is a cached weather response
+type cacheEntry struct {
+	key        string
+	value      CurrentWeather
+	fetchedAt  time.Time
+	refreshing bool
+}
+
+// NewWeatherCache creates an empty cache. maxEntries <= 0 means unbounded.
+func NewWeatherCache(ttl, staleWhileRevalidate time.Duration, maxEntries int) *WeatherCache {
+	return &WeatherCache{
+		TTL:                  ttl,
+		StaleWhileRevalidate: staleWhileRevalidate,
+		MaxEntries:           maxEntries,
+		entries:              make(map[string]*list.Element),
+		order:                list.New(),
+		now:                  time.Now,
+	}
+}
+
+// normalizeCity builds the cache key for a city: lower case with collapsed whitespace
+func normalizeCity(city string) string {
+	return strings.ToLower(strings.Join(strings.Fields(city), " "))
+}
+
+// Len returns the number of cached entries
+func (c *WeatherCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// get returns the entry for key and how fresh it is. Expired entries are removed.
+func (c *WeatherCache) get(key string) (cacheEntry, cacheState) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return cacheEntry{}, cacheMiss
+	}
+
+	entry := elem.Value.(*cacheEntry)
+	age := c.now().Sub(entry.fetchedAt)
+	switch {
+	case age < c.TTL:
+		c.order.MoveToFront(elem)
+		return *entry, cacheFresh
+	case age < c.TTL+c.StaleWhileRevalidate:
+		c.order.MoveToFront(elem)
+		return *entry, cacheStale
+	default:
+		c.removeElement(elem)
+		return cacheEntry{}, cacheMiss
+	}
+}
+
+// set stores value under key, evicting the least recently used entry when full
+func (c *WeatherCache) set(key string, value CurrentWeather) cacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &cacheEntry{key: key, value: value, fetchedAt: c.now()}
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return *entry
+	}
+
+	c.entries[key] = c.order.PushFront(entry)
+	for c.MaxEntries > 0 && c.order.Len() > c.MaxEntries {
+		c.removeElement(c.order.Back())
+	}
+	return *entry
+}
+
+// startRefresh marks key as being revalidated. It returns false if a refresh is
+// already running or the entry is gone, so only one refresh runs per key.
+func (c *WeatherCache) startRefresh(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if entry.refreshing {
+		return false
+	}
+	entry.refreshing = true
+	return true
+}
+
+// endRefresh clears the refreshing mark after a failed revalidation
+func (c *WeatherCache) endRefresh(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		elem.Value.(*cacheEntry).refreshing = false
+	}
+}
+
+// removeElement deletes elem from the cache; the caller must hold c.mu
+func (c *WeatherCache) removeElement(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*cacheEntry).key)
+}
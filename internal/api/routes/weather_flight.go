@@ -0,0 +1,65 @@
+package routes
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// flightGroup deduplicates concurrent calls that share a key, so only one of them
+// does the work and the rest wait for its result. The zero value is ready to use.
+type flightGroup[V any] struct {
+	mu     sync.Mutex
+	calls  map[string]*flightCall[V]
+	joined atomic.Int64 // callers that waited on another caller's call
+}
+
+// flightCall is an in-progress or completed call
+type flightCall[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+}
+
+// do runs fn once for all concurrent callers with the same key. The shared call runs
+// detached from any single caller's cancellation, while each caller stops waiting when
+// its own ctx is done. shared reports whether the result came from another caller's call.
+func (g *flightGroup[V]) do(ctx context.Context, key string, fn func(context.Context) (V, error)) (value V, shared bool, err error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall[V])
+	}
+	if call, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		g.joined.Add(1)
+		select {
+		case <-call.done:
+			return call.value, true, call.err
+		case <-ctx.Done():
+			var zero V
+			return zero, true, ctx.Err()
+		}
+	}
+
+	call := &flightCall[V]{done: make(chan struct{})}
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	go func() {
+		// Other callers may still be waiting after this one gives up
+		call.value, call.err = fn(context.WithoutCancel(ctx))
+
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(call.done)
+	}()
+
+	select {
+	case <-call.done:
+		return call.value, false, call.err
+	case <-ctx.Done():
+		var zero V
+		return zero, false, ctx.Err()
+	}
+}
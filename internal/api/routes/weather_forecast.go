@@ -0,0 +1,179 @@
+package routes
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jorge2751/GoAPI/internal/api/response"
+)
+
+// Limits for the forecast and history endpoints
+const (
+	DefaultForecastDays = 3
+	MaxForecastDays     = 14
+	// MaxHistoryAge is how far back /weather/history accepts dates
+	MaxHistoryAge = 365 * 24 * time.Hour
+)
+
+// dateLayout is the format of date query parameters and dates in responses
+const dateLayout = "2006-01-02"
+
+// clockLayout is the format of times of day (sunrise, sunset, ...) in responses
+const clockLayout = "15:04"
+
+// localTimeLayout is the format of a location's local date and time in responses
+const localTimeLayout = "2006-01-02 15:04"
+
+// DailyWeather summarizes the weather for one day
+type DailyWeather struct {
+	Date          string  `json:"date"`
+	MaxTempC      float64 `json:"max_temp_c"`
+	MaxTempF      float64 `json:"max_temp_f"`
+	MinTempC      float64 `json:"min_temp_c"`
+	MinTempF      float64 `json:"min_temp_f"`
+	TotalPrecipMM float64 `json:"total_precip_mm"`
+	// ChanceOfRain is a percentage; it is omitted for past days
+	ChanceOfRain *int   `json:"chance_of_rain,omitempty"`
+	Condition    string `json:"condition"`
+}
+
+// WeatherForecast is the provider-neutral daily forecast for a location
+type WeatherForecast struct {
+	Location WeatherLocation `json:"location"`
+	Days     []DailyWeather  `json:"days"`
+	Provider string          `json:"provider"`
+}
+
+// WeatherHistory is the provider-neutral observed weather for a past day
+type WeatherHistory struct {
+	Location WeatherLocation `json:"location"`
+	Day      DailyWeather    `json:"day"`
+	Provider string          `json:"provider"`
+}
+
+// WeatherAstronomy holds sun and moon times for a location and day.
+// Times are local to the location in 24-hour "15:04" format; moon data is
+// omitted by providers that do not supply it.
+type WeatherAstronomy struct {
+	Location  WeatherLocation `json:"location"`
+	Date      string          `json:"date"`
+	Sunrise   string          `json:"sunrise"`
+	Sunset    string          `json:"sunset"`
+	Moonrise  string          `json:"moonrise,omitempty"`
+	Moonset   string          `json:"moonset,omitempty"`
+	MoonPhase string          `json:"moon_phase,omitempty"`
+	Provider  string          `json:"provider"`
+}
+
+// ForecastHandler returns a daily forecast for the requested location covering ?days= days (default 3)
+func (s *WeatherService) ForecastHandler(w http.ResponseWriter, r *http.Request) {
+	loc, ok := requireLocation(w, r)
+	if !ok {
+		return
+	}
+
+	days := DefaultForecastDays
+	if raw := r.URL.Query().Get("days"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > MaxForecastDays {
+			response.Error(w, r, http.StatusBadRequest, response.CodeInvalidParameter,
+				"Query parameter 'days' must be a whole number between 1 and "+strconv.Itoa(MaxForecastDays))
+			return
+		}
+		days = parsed
+	}
+
+	forecast, err := withFailover(r.Context(), s, func(provider WeatherProvider) (WeatherForecast, error) {
+		return provider.Forecast(r.Context(), loc, days)
+	})
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	response.JSON(w, r, http.StatusOK, forecast)
+}
+
+// HistoryHandler returns the observed weather for the requested location on a past ?date= (YYYY-MM-DD)
+func (s *WeatherService) HistoryHandler(w http.ResponseWriter, r *http.Request) {
+	loc, ok := requireLocation(w, r)
+	if !ok {
+		return
+	}
+
+	raw := r.URL.Query().Get("date")
+	if raw == "" {
+		response.Error(w, r, http.StatusBadRequest, response.CodeMissingParameter, "Query parameter 'date' is required")
+		return
+	}
+	date, err := time.Parse(dateLayout, raw)
+	if err != nil {
+		response.Error(w, r, http.StatusBadRequest, response.CodeInvalidParameter, "Query parameter 'date' must use the YYYY-MM-DD format")
+		return
+	}
+	today := today()
+	if date.After(today) || today.Sub(date) > MaxHistoryAge {
+		response.Error(w, r, http.StatusBadRequest, response.CodeInvalidParameter,
+			"Query parameter 'date' must be within the last year and not in the future")
+		return
+	}
+
+	history, err := withFailover(r.Context(), s, func(provider WeatherProvider) (WeatherHistory, error) {
+		return provider.History(r.Context(), loc, date)
+	})
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	response.JSON(w, r, http.StatusOK, history)
+}
+
+// AstronomyHandler returns sunrise, sunset and moon data for the requested location on ?date= (default today)
+func (s *WeatherService) AstronomyHandler(w http.ResponseWriter, r *http.Request) {
+	loc, ok := requireLocation(w, r)
+	if !ok {
+		return
+	}
+
+	date := today()
+	if raw := r.URL.Query().Get("date"); raw != "" {
+		parsed, err := time.Parse(dateLayout, raw)
+		if err != nil {
+			response.Error(w, r, http.StatusBadRequest, response.CodeInvalidParameter, "Query parameter 'date' must use the YYYY-MM-DD format")
+			return
+		}
+		date = parsed
+	}
+
+	astronomy, err := withFailover(r.Context(), s, func(provider WeatherProvider) (WeatherAstronomy, error) {
+		return provider.Astronomy(r.Context(), loc, date)
+	})
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	response.JSON(w, r, http.StatusOK, astronomy)
+}
+
+// today returns the current UTC date at midnight
+func today() time.Time {
+	return time.Now().UTC().Truncate(24 * time.Hour)
+}
+
+// reformatClock converts a time of day from layout to the response clock format.
+// Values that do not parse (such as "No moonrise") become "".
+func reformatClock(value, layout string) string {
+	return reformatTime(value, layout, clockLayout)
+}
+
+// reformatTime converts a time value from one layout to another, returning "" if it does not parse
+func reformatTime(value, from, to string) string {
+	parsed, err := time.Parse(from, value)
+	if err != nil {
+		return ""
+	}
+	return parsed.Format(to)
+}
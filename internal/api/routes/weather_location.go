@@ -0,0 +1,249 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/jorge2751/GoAPI/internal/api/response"
+)
+
+// LocationKind is the way a weather lookup identifies its location
+type LocationKind string
+
+// Supported location lookups
+const (
+	LocationCity        LocationKind = "city"
+	LocationCoordinates LocationKind = "coordinates"
+	LocationPostalCode  LocationKind = "postal_code"
+	LocationIP          LocationKind = "ip"
+)
+
+// autoIP is the ip parameter value that selects the client's own address
+const autoIP = "auto"
+
+// Length limits for free-text locations, in characters
+const (
+	MaxCityLength       = 100
+	MaxPostalCodeLength = 16
+)
+
+// LocationQuery identifies the location of a weather lookup.
+// Only the fields that belong to Kind are set.
+type LocationQuery struct {
+	Kind       LocationKind
+	City       string
+	Lat, Lon   float64
+	PostalCode string
+	IP         string
+}
+
+// cityQuery returns a LocationQuery for a city name
+func cityQuery(city string) LocationQuery {
+	return LocationQuery{Kind: LocationCity, City: city}
+}
+
+// String renders the location the way WeatherAPI's q parameter expects it:
+// a city name, "lat,lon", a postal code or an IP address
+func (q LocationQuery) String() string {
+	switch q.Kind {
+	case LocationCoordinates:
+		return formatCoordinate(q.Lat) + "," + formatCoordinate(q.Lon)
+	case LocationPostalCode:
+		return q.PostalCode
+	case LocationIP:
+		return q.IP
+	default:
+		return q.City
+	}
+}
+
+// key returns the cache and coalescing key for the location. City lookups
+// keep their normalized name so existing entries stay valid; other kinds
+// are prefixed so they cannot collide with a city called e.g. "10001".
+func (q LocationQuery) key() string {
+	if q.Kind == LocationCity {
+		return normalizeCity(q.City)
+	}
+	return string(q.Kind) + ":" + normalizeCity(q.String())
+}
+
+// formatCoordinate formats a latitude or longitude with at most 4 decimals (about 11 m)
+func formatCoordinate(v float64) string {
+	return strconv.FormatFloat(roundTo(v, 4), 'f', -1, 64)
+}
+
+// LocationRequest is a location as supplied by a client, either in the query
+// string of a weather endpoint or as an element of a batch request. Exactly one
+// of City, Lat and Lon together, PostalCode or IP must be set; IP "auto" uses
+// the client's address.
+type LocationRequest struct {
+	City       string   `json:"city,omitempty"`
+	Lat        *float64 `json:"lat,omitempty"`
+	Lon        *float64 `json:"lon,omitempty"`
+	PostalCode string   `json:"postal_code,omitempty"`
+	IP         string   `json:"ip,omitempty"`
+}
+
+// locationError describes why a location could not be parsed
+type locationError struct {
+	code    string
+	message string
+}
+
+func (e *locationError) Error() string {
+	return e.message
+}
+
+// errNoLocation is returned when a request names no location at all
+var errNoLocation = &locationError{
+	code:    response.CodeMissingParameter,
+	message: "Query parameter 'city' is required (or 'lat' and 'lon', 'postal_code' or 'ip')",
+}
+
+// invalidLocation returns a locationError for a malformed location
+func invalidLocation(format string, args ...any) error {
+	return &locationError{code: response.CodeInvalidParameter, message: fmt.Sprintf(format, args...)}
+}
+
+// locationFromValues reads the location parameters of a weather endpoint's query string
+func locationFromValues(values url.Values) (LocationRequest, error) {
+	req := LocationRequest{
+		City:       strings.TrimSpace(values.Get("city")),
+		PostalCode: strings.TrimSpace(values.Get("postal_code")),
+		IP:         strings.TrimSpace(values.Get("ip")),
+	}
+	for _, param := range []struct {
+		name string
+		dest **float64
+	}{{"lat", &req.Lat}, {"lon", &req.Lon}} {
+		raw := values.Get(param.name)
+		if raw == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return LocationRequest{}, invalidLocation("Query parameter '%s' must be a number", param.name)
+		}
+		*param.dest = &v
+	}
+	return req, nil
+}
+
+// resolve validates the request and turns it into a LocationQuery. r supplies
+// the client address for IP "auto".
+func (lr LocationRequest) resolve(r *http.Request) (LocationQuery, error) {
+	given := 0
+	for _, set := range []bool{lr.City != "", lr.Lat != nil || lr.Lon != nil, lr.PostalCode != "", lr.IP != ""} {
+		if set {
+			given++
+		}
+	}
+	switch {
+	case given == 0:
+		return LocationQuery{}, errNoLocation
+	case given > 1:
+		return LocationQuery{}, invalidLocation("Only one of 'city', 'lat'/'lon', 'postal_code' or 'ip' may be given")
+	}
+
+	switch {
+	case lr.City != "":
+		if err := validateText("city", lr.City, MaxCityLength, isCityRune); err != nil {
+			return LocationQuery{}, err
+		}
+		return cityQuery(lr.City), nil
+	case lr.PostalCode != "":
+		if err := validateText("postal_code", lr.PostalCode, MaxPostalCodeLength, isPostalCodeRune); err != nil {
+			return LocationQuery{}, err
+		}
+		return LocationQuery{Kind: LocationPostalCode, PostalCode: lr.PostalCode}, nil
+	case lr.IP != "":
+		ip := lr.IP
+		if strings.EqualFold(ip, autoIP) {
+			ip = clientIP(r)
+		}
+		if net.ParseIP(ip) == nil {
+			return LocationQuery{}, invalidLocation("Parameter 'ip' must be an IP address or 'auto'")
+		}
+		return LocationQuery{Kind: LocationIP, IP: ip}, nil
+	}
+
+	if lr.Lat == nil || lr.Lon == nil {
+		return LocationQuery{}, invalidLocation("Parameters 'lat' and 'lon' must be given together")
+	}
+	// NaN fails every comparison, so it must be rejected explicitly
+	if math.IsNaN(*lr.Lat) || math.IsNaN(*lr.Lon) || *lr.Lat < -90 || *lr.Lat > 90 || *lr.Lon < -180 || *lr.Lon > 180 {
+		return LocationQuery{}, invalidLocation("Parameter 'lat' must be within [-90, 90] and 'lon' within [-180, 180]")
+	}
+	return LocationQuery{Kind: LocationCoordinates, Lat: *lr.Lat, Lon: *lr.Lon}, nil
+}
+
+// validateText checks a free-text location parameter's length and characters
+func validateText(param, value string, maxLen int, allowed func(rune) bool) error {
+	if utf8.RuneCountInString(value) > maxLen {
+		return invalidLocation("Parameter '%s' must be at most %d characters", param, maxLen)
+	}
+	for _, r := range value {
+		if !allowed(r) {
+			return invalidLocation("Parameter '%s' contains an invalid character %q", param, r)
+		}
+	}
+	return nil
+}
+
+// isCityRune reports whether r may appear in a city name, such as
+// "Saint-Étienne", "N'Djamena" or "Washington, D.C."
+func isCityRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsMark(r) || unicode.IsDigit(r) || r == ' ' || strings.ContainsRune(".,'-()", r)
+}
+
+// isPostalCodeRune reports whether r may appear in a postal code, such as "SW1A 1AA" or "10001-1234"
+func isPostalCodeRune(r rune) bool {
+	return r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == ' ' || r == '-')
+}
+
+// clientIP returns the address of the client that sent r: the first address in
+// X-Forwarded-For when a proxy set it, otherwise the connection's remote address
+func clientIP(r *http.Request) string {
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		first, _, _ := strings.Cut(forwarded, ",")
+		return strings.TrimSpace(first)
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// requireLocation reads the location from the query string, writing a 400 if it is missing or invalid
+func requireLocation(w http.ResponseWriter, r *http.Request) (LocationQuery, bool) {
+	req, err := locationFromValues(r.URL.Query())
+	if err == nil {
+		var loc LocationQuery
+		if loc, err = req.resolve(r); err == nil {
+			return loc, true
+		}
+	}
+
+	code, message := describeLocationError(err)
+	response.Error(w, r, http.StatusBadRequest, code, message)
+	return LocationQuery{}, false
+}
+
+// describeLocationError returns the error code and message for a location that
+// failed to resolve
+func describeLocationError(err error) (code, message string) {
+	var locErr *locationError
+	if errors.As(err, &locErr) {
+		return locErr.code, locErr.message
+	}
+	return response.CodeInvalidParameter, err.Error()
+}
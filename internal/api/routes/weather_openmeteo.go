@@ -0,0 +1,353 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Default Open-Meteo endpoints
+const (
+	DefaultOpenMeteoURL          = "https://api.open-meteo.com/v1"
+	DefaultOpenMeteoGeocodingURL = "https://geocoding-api.open-meteo.com/v1"
+	DefaultOpenMeteoArchiveURL   = "https://archive-api.open-meteo.com/v1"
+)
+
+// openMeteoClock is the format Open-Meteo uses for local times such as sunrise and sunset
+const openMeteoClock = "2006-01-02T15:04"
+
+// OpenMeteoProvider fetches weather from Open-Meteo (open-meteo.com), which needs no API key.
+// Cities are resolved to coordinates with the Open-Meteo geocoding API first.
+type OpenMeteoProvider struct {
+	BaseURL      string
+	GeocodingURL string
+	ArchiveURL   string
+	*Upstream
+}
+
+// NewOpenMeteoProvider creates an Open-Meteo provider with default settings
+func NewOpenMeteoProvider() *OpenMeteoProvider {
+	return &OpenMeteoProvider{
+		BaseURL:      DefaultOpenMeteoURL,
+		GeocodingURL: DefaultOpenMeteoGeocodingURL,
+		ArchiveURL:   DefaultOpenMeteoArchiveURL,
+		Upstream:     NewUpstream(),
+	}
+}
+
+// Name returns the provider name
+func (p *OpenMeteoProvider) Name() string {
+	return ProviderOpenMeteo
+}
+
+// openMeteoPlace is a geocoding search result
+type openMeteoPlace struct {
+	Name      string  `json:"name"`
+	Admin1    string  `json:"admin1"`
+	Country   string  `json:"country"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Timezone  string  `json:"timezone"`
+}
+
+// openMeteoCurrentVariables lists the current conditions requested from the forecast API
+const openMeteoCurrentVariables = "temperature_2m,apparent_temperature,relative_humidity_2m,weather_code," +
+	"wind_speed_10m,wind_direction_10m,pressure_msl,uv_index,visibility"
+
+// openMeteoCurrentResponse is the part of the forecast response used for current conditions.
+// Open-Meteo reports metric units: °C, km/h, hPa and visibility in meters.
+type openMeteoCurrentResponse struct {
+	Current struct {
+		Time                string  `json:"time"`
+		Temperature         float64 `json:"temperature_2m"`
+		ApparentTemperature float64 `json:"apparent_temperature"`
+		RelativeHumidity    int     `json:"relative_humidity_2m"`
+		WeatherCode         int     `json:"weather_code"`
+		WindSpeed           float64 `json:"wind_speed_10m"`
+		WindDirection       int     `json:"wind_direction_10m"`
+		PressureMSL         float64 `json:"pressure_msl"`
+		UVIndex             float64 `json:"uv_index"`
+		Visibility          float64 `json:"visibility"`
+	} `json:"current"`
+}
+
+// toLocation converts the geocoding result to the provider-neutral model
+func (pl openMeteoPlace) toLocation() WeatherLocation {
+	return WeatherLocation{
+		Name:     pl.Name,
+		Region:   pl.Admin1,
+		Country:  pl.Country,
+		Lat:      pl.Latitude,
+		Lon:      pl.Longitude,
+		Timezone: pl.Timezone,
+	}
+}
+
+// coordinates returns the query parameters locating pl for the forecast and archive APIs
+func (pl openMeteoPlace) coordinates() url.Values {
+	query := url.Values{}
+	query.Set("latitude", fmt.Sprint(pl.Latitude))
+	query.Set("longitude", fmt.Sprint(pl.Longitude))
+	query.Set("timezone", "auto")
+	return query
+}
+
+// geocode resolves a city name or postal code to the best matching place
+func (p *OpenMeteoProvider) geocode(ctx context.Context, city string) (openMeteoPlace, error) {
+	query := url.Values{}
+	query.Set("name", city)
+	query.Set("count", "1")
+	query.Set("format", "json")
+
+	var result struct {
+		Results []openMeteoPlace `json:"results"`
+	}
+	if err := p.get(ctx, p.GeocodingURL+"/search?"+query.Encode(), &result); err != nil {
+		return openMeteoPlace{}, err
+	}
+	if len(result.Results) == 0 {
+		return openMeteoPlace{}, errLocationNotFound
+	}
+	return result.Results[0], nil
+}
+
+// get fetches apiURL from Open-Meteo and decodes the response into v.
+// Open-Meteo reports bad requests as 400 with a reason, which classifyStatus maps.
+func (p *OpenMeteoProvider) get(ctx context.Context, apiURL string, v any) error {
+	return classifyStatus(getJSON(ctx, p.Upstream, "Open-Meteo", apiURL, v))
+}
+
+// locate resolves a location to a place. Coordinates are used as they are and
+// postal codes are looked up by the geocoding API; IP lookups are not supported.
+func (p *OpenMeteoProvider) locate(ctx context.Context, loc LocationQuery) (openMeteoPlace, error) {
+	switch loc.Kind {
+	case LocationCoordinates:
+		return openMeteoPlace{Name: loc.String(), Latitude: loc.Lat, Longitude: loc.Lon}, nil
+	case LocationIP:
+		return openMeteoPlace{}, errLocationUnsupported
+	default:
+		return p.geocode(ctx, loc.String())
+	}
+}
+
+// Current requests the current weather for loc from Open-Meteo
+func (p *OpenMeteoProvider) Current(ctx context.Context, loc LocationQuery) (CurrentWeather, error) {
+	place, err := p.locate(ctx, loc)
+	if err != nil {
+		return CurrentWeather{}, err
+	}
+
+	query := place.coordinates()
+	query.Set("current", openMeteoCurrentVariables)
+
+	var forecast openMeteoCurrentResponse
+	if err := p.get(ctx, p.BaseURL+"/forecast?"+query.Encode(), &forecast); err != nil {
+		return CurrentWeather{}, err
+	}
+
+	current := forecast.Current
+	visibilityKM := roundTo(current.Visibility/1000, 1)
+	location := place.toLocation()
+	// With timezone=auto the observation time is already local to the place
+	location.LocalTime = reformatTime(current.Time, openMeteoClock, localTimeLayout)
+
+	return CurrentWeather{
+		Location: location,
+		Current: WeatherConditions{
+			TempC:      current.Temperature,
+			TempF:      celsiusToFahrenheit(current.Temperature),
+			FeelsLikeC: current.ApparentTemperature,
+			FeelsLikeF: celsiusToFahrenheit(current.ApparentTemperature),
+			Condition:  wmoCondition(current.WeatherCode),
+			Humidity:   current.RelativeHumidity,
+			WindKPH:    current.WindSpeed,
+			WindMPH:    kilometersToMiles(current.WindSpeed),
+			WindDegree: current.WindDirection,
+			WindDir:    compassDirection(current.WindDirection),
+			PressureMB: current.PressureMSL,
+			PressureIN: hectopascalsToInches(current.PressureMSL),
+			UV:         current.UVIndex,
+			VisKM:      visibilityKM,
+			VisMiles:   kilometersToMiles(visibilityKM),
+		},
+		Provider: p.Name(),
+	}, nil
+}
+
+// openMeteoDailyResponse is the daily block of Open-Meteo forecast and archive responses.
+// Each field is a column with one value per day.
+type openMeteoDailyResponse struct {
+	Daily struct {
+		Time                        []string  `json:"time"`
+		WeatherCode                 []int     `json:"weather_code"`
+		TemperatureMax              []float64 `json:"temperature_2m_max"`
+		TemperatureMin              []float64 `json:"temperature_2m_min"`
+		PrecipitationSum            []float64 `json:"precipitation_sum"`
+		PrecipitationProbabilityMax []int     `json:"precipitation_probability_max"`
+		Sunrise                     []string  `json:"sunrise"`
+		Sunset                      []string  `json:"sunset"`
+	} `json:"daily"`
+}
+
+// days converts the daily columns to the provider-neutral model
+func (r openMeteoDailyResponse) days() []DailyWeather {
+	d := r.Daily
+	days := make([]DailyWeather, 0, len(d.Time))
+	for i, date := range d.Time {
+		maxC, minC := at(d.TemperatureMax, i), at(d.TemperatureMin, i)
+		day := DailyWeather{
+			Date:          date,
+			MaxTempC:      maxC,
+			MaxTempF:      celsiusToFahrenheit(maxC),
+			MinTempC:      minC,
+			MinTempF:      celsiusToFahrenheit(minC),
+			TotalPrecipMM: at(d.PrecipitationSum, i),
+			Condition:     wmoCondition(at(d.WeatherCode, i)),
+		}
+		if i < len(d.PrecipitationProbabilityMax) {
+			chance := d.PrecipitationProbabilityMax[i]
+			day.ChanceOfRain = &chance
+		}
+		days = append(days, day)
+	}
+	return days
+}
+
+// openMeteoDailySummary lists the daily variables used for forecasts and history
+const openMeteoDailySummary = "weather_code,temperature_2m_max,temperature_2m_min,precipitation_sum"
+
+// Forecast requests a daily forecast for loc from Open-Meteo
+func (p *OpenMeteoProvider) Forecast(ctx context.Context, loc LocationQuery, days int) (WeatherForecast, error) {
+	place, err := p.locate(ctx, loc)
+	if err != nil {
+		return WeatherForecast{}, err
+	}
+
+	query := place.coordinates()
+	query.Set("daily", openMeteoDailySummary+",precipitation_probability_max")
+	query.Set("forecast_days", strconv.Itoa(days))
+
+	var forecast openMeteoDailyResponse
+	if err := p.get(ctx, p.BaseURL+"/forecast?"+query.Encode(), &forecast); err != nil {
+		return WeatherForecast{}, err
+	}
+
+	return WeatherForecast{
+		Location: place.toLocation(),
+		Days:     forecast.days(),
+		Provider: p.Name(),
+	}, nil
+}
+
+// History requests the observed weather for loc on date from the Open-Meteo archive
+func (p *OpenMeteoProvider) History(ctx context.Context, loc LocationQuery, date time.Time) (WeatherHistory, error) {
+	place, err := p.locate(ctx, loc)
+	if err != nil {
+		return WeatherHistory{}, err
+	}
+
+	query := place.coordinates()
+	query.Set("daily", openMeteoDailySummary)
+	query.Set("start_date", date.Format(dateLayout))
+	query.Set("end_date", date.Format(dateLayout))
+
+	var archive openMeteoDailyResponse
+	if err := p.get(ctx, p.ArchiveURL+"/archive?"+query.Encode(), &archive); err != nil {
+		return WeatherHistory{}, err
+	}
+
+	days := archive.days()
+	if len(days) == 0 {
+		return WeatherHistory{}, fmt.Errorf("Open-Meteo returned no history for %s", date.Format(dateLayout))
+	}
+
+	return WeatherHistory{
+		Location: place.toLocation(),
+		Day:      days[0],
+		Provider: p.Name(),
+	}, nil
+}
+
+// Astronomy requests sunrise and sunset for city on date from Open-Meteo.
+// Open-Meteo has no moon data, so those fields are left empty.
+func (p *OpenMeteoProvider) Astronomy(ctx context.Context, loc LocationQuery, date time.Time) (WeatherAstronomy, error) {
+	place, err := p.locate(ctx, loc)
+	if err != nil {
+		return WeatherAstronomy{}, err
+	}
+
+	query := place.coordinates()
+	query.Set("daily", "sunrise,sunset")
+	query.Set("start_date", date.Format(dateLayout))
+	query.Set("end_date", date.Format(dateLayout))
+
+	var forecast openMeteoDailyResponse
+	if err := p.get(ctx, p.BaseURL+"/forecast?"+query.Encode(), &forecast); err != nil {
+		return WeatherAstronomy{}, err
+	}
+
+	return WeatherAstronomy{
+		Location: place.toLocation(),
+		Date:     date.Format(dateLayout),
+		Sunrise:  reformatClock(at(forecast.Daily.Sunrise, 0), openMeteoClock),
+		Sunset:   reformatClock(at(forecast.Daily.Sunset, 0), openMeteoClock),
+		Provider: p.Name(),
+	}, nil
+}
+
+// at returns values[i], or the zero value when the column is shorter than expected
+func at[T any](values []T, i int) T {
+	if i < len(values) {
+		return values[i]
+	}
+	var zero T
+	return zero
+}
+
+// wmoCondition describes a WMO weather interpretation code as used by Open-Meteo
+func wmoCondition(code int) string {
+	switch code {
+	case 0:
+		return "Clear sky"
+	case 1:
+		return "Mainly clear"
+	case 2:
+		return "Partly cloudy"
+	case 3:
+		return "Overcast"
+	case 45, 48:
+		return "Fog"
+	case 51, 53, 55:
+		return "Drizzle"
+	case 56, 57:
+		return "Freezing drizzle"
+	case 61:
+		return "Light rain"
+	case 63:
+		return "Moderate rain"
+	case 65:
+		return "Heavy rain"
+	case 66, 67:
+		return "Freezing rain"
+	case 71:
+		return "Light snow"
+	case 73:
+		return "Moderate snow"
+	case 75:
+		return "Heavy snow"
+	case 77:
+		return "Snow grains"
+	case 80, 81, 82:
+		return "Rain showers"
+	case 85, 86:
+		return "Snow showers"
+	case 95:
+		return "Thunderstorm"
+	case 96, 99:
+		return "Thunderstorm with hail"
+	default:
+		return "Unknown"
+	}
+}
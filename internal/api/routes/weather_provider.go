@@ -0,0 +1,458 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Provider names accepted by NewWeatherProvider
+const (
+	ProviderWeatherAPI = "weatherapi"
+	ProviderOpenMeteo  = "openmeteo"
+)
+
+// DefaultWeatherAPIURL is the base URL of the WeatherAPI service
+const DefaultWeatherAPIURL = "https://api.weatherapi.com/v1"
+
+// WeatherProvider fetches weather data from one upstream API and converts it
+// to the provider-neutral models
+type WeatherProvider interface {
+	// Name identifies the provider in responses, logs and the debug endpoint
+	Name() string
+	// Current returns the current weather for a location
+	Current(ctx context.Context, loc LocationQuery) (CurrentWeather, error)
+	// Forecast returns a daily forecast for a location starting today
+	Forecast(ctx context.Context, loc LocationQuery, days int) (WeatherForecast, error)
+	// History returns the observed weather for a location on a past date
+	History(ctx context.Context, loc LocationQuery, date time.Time) (WeatherHistory, error)
+	// Astronomy returns sun and moon times for a location on a date
+	Astronomy(ctx context.Context, loc LocationQuery, date time.Time) (WeatherAstronomy, error)
+}
+
+// errAPIKeyMissing is returned when a provider that needs an API key has none
+var errAPIKeyMissing = errors.New("WeatherAPI key not configured in service")
+
+// errLocationNotFound is returned when the provider does not know the requested location
+var errLocationNotFound = errors.New("location not found")
+
+// errLocationUnsupported is returned by providers that cannot look up a kind of location
+var errLocationUnsupported = errors.New("location lookup not supported by provider")
+
+// Errors providers map upstream error responses to, so handlers can answer with
+// a matching status instead of echoing the upstream's reply
+var (
+	// errUpstreamRejected means the provider refused the request as invalid
+	errUpstreamRejected = errors.New("weather provider rejected the request")
+	// errUpstreamQuota means our request quota or rate limit at the provider is used up
+	errUpstreamQuota = errors.New("weather provider quota exceeded")
+	// errUpstreamAuth means the provider refused our API key
+	errUpstreamAuth = errors.New("weather provider rejected the API key")
+)
+
+// maxUpstreamErrorBody bounds how much of an upstream error body is kept for logs
+const maxUpstreamErrorBody = 512
+
+// upstreamError is returned when a provider's API answers with an unexpected status.
+// Body is only meant for logs; it is never sent to clients.
+type upstreamError struct {
+	Provider   string
+	StatusCode int
+	Body       string
+}
+
+func (e *upstreamError) Error() string {
+	return fmt.Sprintf("%s request failed with status %d: %s", e.Provider, e.StatusCode, e.Body)
+}
+
+// NewWeatherProvider creates a provider by name that sends its requests through upstream.
+// apiKey is only used by providers that need one.
+func NewWeatherProvider(name, apiKey string, upstream *Upstream) (WeatherProvider, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case ProviderWeatherAPI:
+		provider := NewWeatherAPIProvider(apiKey)
+		provider.Upstream = upstream
+		return provider, nil
+	case ProviderOpenMeteo:
+		provider := NewOpenMeteoProvider()
+		provider.Upstream = upstream
+		return provider, nil
+	default:
+		return nil, fmt.Errorf("unknown weather provider %q", name)
+	}
+}
+
+// classifyStatus wraps an *upstreamError with the sentinel matching its status, for
+// responses that carry no more specific provider error code
+func classifyStatus(err error) error {
+	var upstreamErr *upstreamError
+	if !errors.As(err, &upstreamErr) {
+		return err
+	}
+
+	switch status := upstreamErr.StatusCode; {
+	case status == http.StatusTooManyRequests:
+		return fmt.Errorf("%w: %w", errUpstreamQuota, err)
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return fmt.Errorf("%w: %w", errUpstreamAuth, err)
+	case status >= 400 && status < 500:
+		return fmt.Errorf("%w: %w", errUpstreamRejected, err)
+	}
+	return err
+}
+
+// redactedText stands in for secrets removed from error messages
+const redactedText = "[REDACTED]"
+
+// redactString removes secret, raw or URL-encoded, from s
+func redactString(s, secret string) string {
+	if secret == "" {
+		return s
+	}
+	s = strings.ReplaceAll(s, secret, redactedText)
+	return strings.ReplaceAll(s, url.QueryEscape(secret), redactedText)
+}
+
+// redactedError hides a secret, such as an API key in a request URL, from the
+// message of the error it wraps. errors.Is and errors.As still see the original.
+type redactedError struct {
+	err    error
+	secret string
+}
+
+func (e *redactedError) Error() string {
+	return redactString(e.err.Error(), e.secret)
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
+// redact wraps err so that secret never appears in its message
+func redact(err error, secret string) error {
+	if err == nil || secret == "" {
+		return err
+	}
+	return &redactedError{err: err, secret: secret}
+}
+
+// getJSON fetches apiURL through upstream and decodes a 200 response into v.
+// Non-200 responses are returned as *upstreamError tagged with provider.
+func getJSON(ctx context.Context, upstream *Upstream, provider, apiURL string, v any) error {
+	resp, err := upstream.Get(ctx, apiURL)
+	if err != nil {
+		return fmt.Errorf("fetching weather data: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Check response status
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(io.LimitReader(resp.Body, maxUpstreamErrorBody)) // Read body for the logs if possible
+		return &upstreamError{Provider: provider, StatusCode: resp.StatusCode, Body: string(bodyBytes)}
+	}
+
+	// Read response body
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("reading weather data response: %w", err)
+	}
+
+	// Parse JSON response
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("parsing weather data JSON: %w", err)
+	}
+	return nil
+}
+
+// WeatherAPIProvider fetches weather from WeatherAPI (weatherapi.com)
+type WeatherAPIProvider struct {
+	APIKey  string
+	BaseURL string
+	*Upstream
+}
+
+// NewWeatherAPIProvider creates a WeatherAPI provider with default settings
+func NewWeatherAPIProvider(apiKey string) *WeatherAPIProvider {
+	return &WeatherAPIProvider{
+		APIKey:   apiKey,
+		BaseURL:  DefaultWeatherAPIURL,
+		Upstream: NewUpstream(),
+	}
+}
+
+// Name returns the provider name
+func (p *WeatherAPIProvider) Name() string {
+	return ProviderWeatherAPI
+}
+
+// WeatherAPI error codes that map to our own errors, see https://www.weatherapi.com/docs/#intro-error-codes
+const (
+	weatherAPIKeyNotProvided = 1002
+	weatherAPINoLocation     = 1006
+	weatherAPIKeyInvalid     = 2006
+	weatherAPIQuotaExceeded  = 2007
+	weatherAPIKeyDisabled    = 2008
+	weatherAPINoAccess       = 2009
+)
+
+// get requests endpoint (such as "current.json") with params from WeatherAPI and
+// decodes the response into v. The API key is added here, and removed again from
+// any error so it cannot reach logs or clients.
+func (p *WeatherAPIProvider) get(ctx context.Context, endpoint string, params url.Values, v any) error {
+	params.Set("key", p.APIKey)
+	apiURL := strings.TrimSuffix(p.BaseURL, "/") + "/" + endpoint + "?" + params.Encode()
+
+	err := getJSON(ctx, p.Upstream, "WeatherAPI", apiURL, v)
+	return redact(p.mapError(err), p.APIKey)
+}
+
+// mapError maps a WeatherAPI error response to our own errors using its error code
+func (p *WeatherAPIProvider) mapError(err error) error {
+	var upstreamErr *upstreamError
+	if !errors.As(err, &upstreamErr) {
+		return err
+	}
+	upstreamErr.Body = redactString(upstreamErr.Body, p.APIKey)
+
+	var body struct {
+		Error struct {
+			Code int `json:"code"`
+		} `json:"error"`
+	}
+	_ = json.Unmarshal([]byte(upstreamErr.Body), &body) // Fall back to the status on unexpected bodies
+
+	switch body.Error.Code {
+	case weatherAPINoLocation:
+		return fmt.Errorf("%w: %w", errLocationNotFound, err)
+	case weatherAPIQuotaExceeded:
+		return fmt.Errorf("%w: %w", errUpstreamQuota, err)
+	case weatherAPIKeyNotProvided, weatherAPIKeyInvalid, weatherAPIKeyDisabled, weatherAPINoAccess:
+		return fmt.Errorf("%w: %w", errUpstreamAuth, err)
+	}
+	return classifyStatus(err)
+}
+
+// weatherAPILocation is the location block of every WeatherAPI response
+type weatherAPILocation struct {
+	Name      string  `json:"name"`
+	Region    string  `json:"region"`
+	Country   string  `json:"country"`
+	Lat       float64 `json:"lat"`
+	Lon       float64 `json:"lon"`
+	TzID      string  `json:"tz_id"`
+	LocalTime string  `json:"localtime"`
+}
+
+// weatherAPILocalTime is the format of WeatherAPI's localtime field ("2024-05-01 9:05")
+const weatherAPILocalTime = "2006-01-02 15:04"
+
+// toLocation converts the WeatherAPI location to the provider-neutral model
+func (l weatherAPILocation) toLocation() WeatherLocation {
+	return WeatherLocation{
+		Name:      l.Name,
+		Region:    l.Region,
+		Country:   l.Country,
+		Lat:       l.Lat,
+		Lon:       l.Lon,
+		Timezone:  l.TzID,
+		LocalTime: reformatTime(l.LocalTime, weatherAPILocalTime, localTimeLayout),
+	}
+}
+
+// WeatherAPIResponse defines the structure for the relevant parts of the WeatherAPI response
+type WeatherAPIResponse struct {
+	Location weatherAPILocation `json:"location"`
+	Current  struct {
+		TempC      float64 `json:"temp_c"`
+		TempF      float64 `json:"temp_f"`
+		FeelsLikeC float64 `json:"feelslike_c"`
+		FeelsLikeF float64 `json:"feelslike_f"`
+		Condition  struct {
+			Text string `json:"text"`
+		} `json:"condition"`
+		Humidity   int     `json:"humidity"`
+		WindKPH    float64 `json:"wind_kph"`
+		WindMPH    float64 `json:"wind_mph"`
+		WindDegree int     `json:"wind_degree"`
+		WindDir    string  `json:"wind_dir"`
+		PressureMB float64 `json:"pressure_mb"`
+		PressureIN float64 `json:"pressure_in"`
+		UV         float64 `json:"uv"`
+		VisKM      float64 `json:"vis_km"`
+		VisMiles   float64 `json:"vis_miles"`
+	} `json:"current"`
+}
+
+// Current requests the current weather for loc from WeatherAPI
+func (p *WeatherAPIProvider) Current(ctx context.Context, loc LocationQuery) (CurrentWeather, error) {
+	// Use API key from the provider struct
+	if p.APIKey == "" {
+		return CurrentWeather{}, errAPIKeyMissing
+	}
+
+	params := url.Values{"q": {loc.String()}, "aqi": {"no"}}
+
+	var apiResponse WeatherAPIResponse
+	if err := p.get(ctx, "current.json", params, &apiResponse); err != nil {
+		return CurrentWeather{}, err
+	}
+
+	current := apiResponse.Current
+	return CurrentWeather{
+		Location: apiResponse.Location.toLocation(),
+		Current: WeatherConditions{
+			TempC:      current.TempC,
+			TempF:      current.TempF,
+			FeelsLikeC: current.FeelsLikeC,
+			FeelsLikeF: current.FeelsLikeF,
+			Condition:  current.Condition.Text,
+			Humidity:   current.Humidity,
+			WindKPH:    current.WindKPH,
+			WindMPH:    current.WindMPH,
+			WindDegree: current.WindDegree,
+			WindDir:    current.WindDir,
+			PressureMB: current.PressureMB,
+			PressureIN: current.PressureIN,
+			UV:         current.UV,
+			VisKM:      current.VisKM,
+			VisMiles:   current.VisMiles,
+		},
+		Provider: p.Name(),
+	}, nil
+}
+
+// weatherAPIAstro is the astronomy block of WeatherAPI forecast, history and astronomy responses
+type weatherAPIAstro struct {
+	Sunrise   string `json:"sunrise"`
+	Sunset    string `json:"sunset"`
+	Moonrise  string `json:"moonrise"`
+	Moonset   string `json:"moonset"`
+	MoonPhase string `json:"moon_phase"`
+}
+
+// weatherAPIClock is the format WeatherAPI uses for times of day
+const weatherAPIClock = "03:04 PM"
+
+// weatherAPIForecastResponse is the relevant part of WeatherAPI forecast and history responses
+type weatherAPIForecastResponse struct {
+	Location weatherAPILocation `json:"location"`
+	Forecast struct {
+		ForecastDay []struct {
+			Date string `json:"date"`
+			Day  struct {
+				MaxTempC          float64 `json:"maxtemp_c"`
+				MaxTempF          float64 `json:"maxtemp_f"`
+				MinTempC          float64 `json:"mintemp_c"`
+				MinTempF          float64 `json:"mintemp_f"`
+				TotalPrecipMM     float64 `json:"totalprecip_mm"`
+				DailyChanceOfRain *int    `json:"daily_chance_of_rain"`
+				Condition         struct {
+					Text string `json:"text"`
+				} `json:"condition"`
+			} `json:"day"`
+		} `json:"forecastday"`
+	} `json:"forecast"`
+}
+
+// days converts the forecast days to the provider-neutral model
+func (r weatherAPIForecastResponse) days() []DailyWeather {
+	days := make([]DailyWeather, 0, len(r.Forecast.ForecastDay))
+	for _, fd := range r.Forecast.ForecastDay {
+		days = append(days, DailyWeather{
+			Date:          fd.Date,
+			MaxTempC:      fd.Day.MaxTempC,
+			MaxTempF:      fd.Day.MaxTempF,
+			MinTempC:      fd.Day.MinTempC,
+			MinTempF:      fd.Day.MinTempF,
+			TotalPrecipMM: fd.Day.TotalPrecipMM,
+			ChanceOfRain:  fd.Day.DailyChanceOfRain,
+			Condition:     fd.Day.Condition.Text,
+		})
+	}
+	return days
+}
+
+// Forecast requests a daily forecast for loc from WeatherAPI
+func (p *WeatherAPIProvider) Forecast(ctx context.Context, loc LocationQuery, days int) (WeatherForecast, error) {
+	if p.APIKey == "" {
+		return WeatherForecast{}, errAPIKeyMissing
+	}
+
+	params := url.Values{"q": {loc.String()}, "days": {strconv.Itoa(days)}, "aqi": {"no"}, "alerts": {"no"}}
+
+	var apiResponse weatherAPIForecastResponse
+	if err := p.get(ctx, "forecast.json", params, &apiResponse); err != nil {
+		return WeatherForecast{}, err
+	}
+
+	return WeatherForecast{
+		Location: apiResponse.Location.toLocation(),
+		Days:     apiResponse.days(),
+		Provider: p.Name(),
+	}, nil
+}
+
+// History requests the observed weather for loc on date from WeatherAPI
+func (p *WeatherAPIProvider) History(ctx context.Context, loc LocationQuery, date time.Time) (WeatherHistory, error) {
+	if p.APIKey == "" {
+		return WeatherHistory{}, errAPIKeyMissing
+	}
+
+	params := url.Values{"q": {loc.String()}, "dt": {date.Format(dateLayout)}}
+
+	var apiResponse weatherAPIForecastResponse
+	if err := p.get(ctx, "history.json", params, &apiResponse); err != nil {
+		return WeatherHistory{}, err
+	}
+
+	days := apiResponse.days()
+	if len(days) == 0 {
+		return WeatherHistory{}, fmt.Errorf("WeatherAPI returned no history for %s", date.Format(dateLayout))
+	}
+	// Chance of rain only makes sense for forecasts
+	days[0].ChanceOfRain = nil
+
+	return WeatherHistory{
+		Location: apiResponse.Location.toLocation(),
+		Day:      days[0],
+		Provider: p.Name(),
+	}, nil
+}
+
+// Astronomy requests sun and moon times for loc on date from WeatherAPI
+func (p *WeatherAPIProvider) Astronomy(ctx context.Context, loc LocationQuery, date time.Time) (WeatherAstronomy, error) {
+	if p.APIKey == "" {
+		return WeatherAstronomy{}, errAPIKeyMissing
+	}
+
+	params := url.Values{"q": {loc.String()}, "dt": {date.Format(dateLayout)}}
+
+	var apiResponse struct {
+		Location  weatherAPILocation `json:"location"`
+		Astronomy struct {
+			Astro weatherAPIAstro `json:"astro"`
+		} `json:"astronomy"`
+	}
+	if err := p.get(ctx, "astronomy.json", params, &apiResponse); err != nil {
+		return WeatherAstronomy{}, err
+	}
+
+	astro := apiResponse.Astronomy.Astro
+	return WeatherAstronomy{
+		Location:  apiResponse.Location.toLocation(),
+		Date:      date.Format(dateLayout),
+		Sunrise:   reformatClock(astro.Sunrise, weatherAPIClock),
+		Sunset:    reformatClock(astro.Sunset, weatherAPIClock),
+		Moonrise:  reformatClock(astro.Moonrise, weatherAPIClock),
+		Moonset:   reformatClock(astro.Moonset, weatherAPIClock),
+		MoonPhase: astro.MoonPhase,
+		Provider:  p.Name(),
+	}, nil
+}
@@ -0,0 +1,368 @@
+package routes
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jorge2751/GoAPI/internal/api/response"
+)
+
+// Default stream settings
+const (
+	// DefaultStreamInterval is how often a streamed location is re-read. Reads go
+	// through the weather cache, so at most one upstream call is made per cache TTL.
+	DefaultStreamInterval = 30 * time.Second
+	// DefaultStreamHeartbeat is how often a comment is sent on idle streams so
+	// proxies and clients do not time the connection out
+	DefaultStreamHeartbeat = 15 * time.Second
+	// DefaultStreamMaxLocations bounds how many locations are streamed at once,
+	// each of which has its own poller
+	DefaultStreamMaxLocations = 100
+	// DefaultStreamMaxSubscribers bounds how many streams are open at once
+	DefaultStreamMaxSubscribers = 1000
+	// streamRetry is the reconnection delay suggested to clients, in milliseconds
+	streamRetry = 5000
+)
+
+// Reasons a stream cannot be opened
+var (
+	errStreamClosed = errors.New("weather streamer is closed")
+	errStreamLimit  = errors.New("weather stream limit reached")
+)
+
+// streamUpdate is the latest state of a streamed location
+type streamUpdate struct {
+	// id identifies the conditions; it only changes when they do
+	id      string
+	weather CurrentWeather
+	// failure is set instead of weather when the lookup failed, and holds the
+	// error body sent to clients
+	failure *response.ErrorBody
+}
+
+// streamTopic is one location watched by a shared poller on behalf of its subscribers
+type streamTopic struct {
+	loc         LocationQuery
+	cancel      context.CancelFunc
+	subscribers map[chan streamUpdate]struct{}
+	latest      *streamUpdate
+}
+
+// WeatherStreamer pushes current weather changes to Server-Sent Events clients.
+// Each location has one poller shared by all of its subscribers; it starts with
+// the first subscriber and stops when the last one leaves.
+type WeatherStreamer struct {
+	Weather *WeatherService
+	// Interval between reads of each streamed location
+	Interval time.Duration
+	// Heartbeat is the interval of keep-alive comments
+	Heartbeat time.Duration
+	// MaxLocations bounds how many locations are streamed at once; new locations
+	// are refused beyond it, while existing ones still accept subscribers
+	MaxLocations int
+	// MaxSubscribers bounds how many streams are open at once
+	MaxSubscribers int
+
+	mu          sync.Mutex
+	topics      map[string]*streamTopic
+	subscribers int
+	done        chan struct{}
+	closed      bool
+}
+
+// NewWeatherStreamer creates a WeatherStreamer that reads the weather through weather
+func NewWeatherStreamer(weather *WeatherService) *WeatherStreamer {
+	return &WeatherStreamer{
+		Weather:        weather,
+		Interval:       DefaultStreamInterval,
+		Heartbeat:      DefaultStreamHeartbeat,
+		MaxLocations:   DefaultStreamMaxLocations,
+		MaxSubscribers: DefaultStreamMaxSubscribers,
+		topics:         make(map[string]*streamTopic),
+		done:           make(chan struct{}),
+	}
+}
+
+// Close ends every open stream and stops the pollers. It is meant to be
+// registered as a server shutdown hook, since http.Server.Shutdown waits for
+// streaming handlers that would otherwise never return.
+func (st *WeatherStreamer) Close() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.closed {
+		return
+	}
+	st.closed = true
+	close(st.done)
+	for key, topic := range st.topics {
+		topic.cancel()
+		delete(st.topics, key)
+	}
+	st.subscribers = 0
+}
+
+// Subscribers returns the number of open streams
+func (st *WeatherStreamer) Subscribers() int {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	return st.subscribers
+}
+
+// maxLocations returns the location limit in effect
+func (st *WeatherStreamer) maxLocations() int {
+	if st.MaxLocations > 0 {
+		return st.MaxLocations
+	}
+	return DefaultStreamMaxLocations
+}
+
+// maxSubscribers returns the subscriber limit in effect
+func (st *WeatherStreamer) maxSubscribers() int {
+	if st.MaxSubscribers > 0 {
+		return st.MaxSubscribers
+	}
+	return DefaultStreamMaxSubscribers
+}
+
+// subscribe registers a subscriber for loc, starting the location's poller if needed.
+// The channel holds at most the latest update; it receives the current state at once
+// when one is known. It fails with errStreamClosed after Close and with errStreamLimit
+// when MaxSubscribers or MaxLocations is reached.
+func (st *WeatherStreamer) subscribe(loc LocationQuery) (chan streamUpdate, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.closed {
+		return nil, errStreamClosed
+	}
+	if st.subscribers >= st.maxSubscribers() {
+		return nil, errStreamLimit
+	}
+
+	key := loc.key()
+	topic, ok := st.topics[key]
+	if !ok {
+		if len(st.topics) >= st.maxLocations() {
+			return nil, errStreamLimit
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		topic = &streamTopic{loc: loc, cancel: cancel, subscribers: make(map[chan streamUpdate]struct{})}
+		st.topics[key] = topic
+		go st.poll(ctx, key, topic)
+	}
+
+	ch := make(chan streamUpdate, 1)
+	topic.subscribers[ch] = struct{}{}
+	st.subscribers++
+	if topic.latest != nil {
+		ch <- *topic.latest
+	}
+	return ch, nil
+}
+
+// unsubscribe removes a subscriber, stopping the poller when it was the last one
+func (st *WeatherStreamer) unsubscribe(loc LocationQuery, ch chan streamUpdate) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	key := loc.key()
+	topic, ok := st.topics[key]
+	if !ok {
+		return
+	}
+	if _, subscribed := topic.subscribers[ch]; !subscribed {
+		return
+	}
+	delete(topic.subscribers, ch)
+	st.subscribers--
+	if len(topic.subscribers) == 0 {
+		topic.cancel()
+		delete(st.topics, key)
+	}
+}
+
+// poll reads the topic's location every Interval and publishes changes until ctx is cancelled
+func (st *WeatherStreamer) poll(ctx context.Context, key string, topic *streamTopic) {
+	interval := st.Interval
+	if interval <= 0 {
+		interval = DefaultStreamInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		weatherData, _, err := st.Weather.currentWeather(ctx, topic.loc)
+		if ctx.Err() != nil {
+			return
+		}
+
+		update := streamUpdate{weather: weatherData}
+		if err == nil {
+			update.id = conditionsID(weatherData)
+		} else {
+			slog.WarnContext(ctx, "Error reading streamed weather", "location", topic.loc.String(), "error", err)
+			_, body := lookupError(ctx, err)
+			update.failure = &body
+		}
+		st.publish(key, topic, update)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// publish sends an update to every subscriber of the topic if it differs from the
+// latest one. Failed lookups are only published while nothing better is known, and
+// a repeated failure is only published again when its error body changes.
+func (st *WeatherStreamer) publish(key string, topic *streamTopic, update streamUpdate) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.topics[key] != topic {
+		return // Stopped while the weather was read
+	}
+	if latest := topic.latest; latest != nil {
+		if update.failure != nil && latest.failure == nil {
+			return // Keep streaming the last good data
+		}
+		if update.failure == nil && latest.failure == nil && update.id == latest.id {
+			return // Unchanged
+		}
+		if update.failure != nil && latest.failure != nil && *update.failure == *latest.failure {
+			return // Still failing the same way
+		}
+	}
+	topic.latest = &update
+
+	for ch := range topic.subscribers {
+		// Replace an update the subscriber has not picked up yet: only the latest matters
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- update
+	}
+}
+
+// conditionsID derives an event ID from the current conditions, so it only
+// changes when they do and stays valid for Last-Event-ID across reconnects
+func conditionsID(weatherData CurrentWeather) string {
+	data, _ := json.Marshal(struct {
+		Provider string
+		Current  WeatherConditions
+	}{weatherData.Provider, weatherData.Current})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// StreamHandler keeps a Server-Sent Events connection open for the requested
+// location and sends a "weather" event with the current weather report whenever
+// the conditions change. ?units= selects the units as for /weather. A client
+// reconnecting with Last-Event-ID does not receive the state it already has.
+// Comment lines are sent every Heartbeat to keep idle connections open.
+// New streams beyond MaxSubscribers or MaxLocations are refused with 503.
+func (st *WeatherStreamer) StreamHandler(w http.ResponseWriter, r *http.Request) {
+	loc, ok := requireLocation(w, r)
+	if !ok {
+		return
+	}
+	units, ok := parseUnits(r.URL.Query().Get("units"))
+	if !ok {
+		response.Error(w, r, http.StatusBadRequest, response.CodeInvalidParameter, "Query parameter 'units' must be 'metric' or 'imperial'")
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	// The stream outlives the server's write timeout
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		response.Error(w, r, http.StatusInternalServerError, response.CodeInternal, "Streaming is not supported")
+		return
+	}
+
+	updates, err := st.subscribe(loc)
+	if errors.Is(err, errStreamLimit) {
+		w.Header().Set("Retry-After", strconv.Itoa(streamRetry/1000))
+		response.Error(w, r, http.StatusServiceUnavailable, response.CodeLimitReached, "Too many weather streams are open, try again later")
+		return
+	}
+	if err != nil {
+		response.Error(w, r, http.StatusServiceUnavailable, response.CodeUpstreamUnavailable, "Server is shutting down")
+		return
+	}
+	defer st.unsubscribe(loc, updates)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // Disable proxy buffering (nginx)
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", streamRetry)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	lastID := r.Header.Get("Last-Event-ID")
+	heartbeat := st.Heartbeat
+	if heartbeat <= 0 {
+		heartbeat = DefaultStreamHeartbeat
+	}
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-st.done:
+			return
+		case <-ticker.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case update := <-updates:
+			if update.failure == nil && update.id == lastID {
+				continue // The client already has this state
+			}
+			if err := writeStreamUpdate(w, update, units); err != nil {
+				slog.ErrorContext(r.Context(), "Error encoding stream event", "error", err)
+				return
+			}
+			lastID = update.id
+		}
+
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// writeStreamUpdate writes an update as an SSE "weather" event, or an "error"
+// event with the error body when the lookup failed
+func writeStreamUpdate(w http.ResponseWriter, update streamUpdate, units Units) error {
+	if update.failure != nil {
+		data, err := json.Marshal(update.failure)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "event: error\ndata: %s\n\n", data)
+		return err
+	}
+
+	data, err := json.Marshal(update.weather.Report(units))
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: weather\ndata: %s\n\n", update.id, data)
+	return err
+}
@@ -0,0 +1,409 @@
+package routes
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jorge2751/GoAPI/internal/api/response"
+)
+
+// Subscription settings
+const (
+	// DefaultSubscriptionInterval is how often watched locations are checked.
+	// Checking more often than the weather cache TTL only re-reads the cache.
+	DefaultSubscriptionInterval = 5 * time.Minute
+	// MaxSubscriptions bounds how many subscriptions the service keeps
+	MaxSubscriptions = 1000
+	// maxSubscriptionBody bounds the size of a subscription request body
+	maxSubscriptionBody = 16 << 10
+)
+
+// Rule types a subscription can watch for
+const (
+	// RuleTemperatureAbove fires when the temperature rises above the threshold
+	RuleTemperatureAbove = "temperature_above"
+	// RuleTemperatureBelow fires when the temperature drops below the threshold
+	RuleTemperatureBelow = "temperature_below"
+	// RuleConditionChange fires whenever the condition text changes, e.g. "Sunny" to "Light rain"
+	RuleConditionChange = "condition_change"
+)
+
+// SubscriptionRule is the condition a subscription watches for
+type SubscriptionRule struct {
+	Type string `json:"type"`
+	// Threshold is required by the temperature rules, in Units
+	Threshold *float64 `json:"threshold,omitempty"`
+	// Units of Threshold and of the weather in payloads (default imperial)
+	Units Units `json:"units"`
+}
+
+// validate checks the rule and fills in its default units.
+// It returns a message for the client when the rule is invalid.
+func (r *SubscriptionRule) validate() (string, bool) {
+	switch r.Type {
+	case RuleTemperatureAbove, RuleTemperatureBelow:
+		if r.Threshold == nil {
+			return "Field 'rule.threshold' is required for " + r.Type + " rules", false
+		}
+	case RuleConditionChange:
+		if r.Threshold != nil {
+			return "Field 'rule.threshold' is not used by condition_change rules", false
+		}
+	default:
+		return fmt.Sprintf("Field 'rule.type' must be %s, %s or %s", RuleTemperatureAbove, RuleTemperatureBelow, RuleConditionChange), false
+	}
+
+	units, ok := parseUnits(string(r.Units))
+	if !ok {
+		return "Field 'rule.units' must be 'metric' or 'imperial'", false
+	}
+	r.Units = units
+	return "", true
+}
+
+// matches reports whether a temperature rule holds for the report
+func (r SubscriptionRule) matches(report CurrentWeatherReport) bool {
+	switch r.Type {
+	case RuleTemperatureAbove:
+		return report.Current.Temperature > *r.Threshold
+	case RuleTemperatureBelow:
+		return report.Current.Temperature < *r.Threshold
+	}
+	return false
+}
+
+// Subscription asks for a webhook to be called when a rule starts to hold at a location
+type Subscription struct {
+	ID         string           `json:"id"`
+	Location   string           `json:"location"`
+	Rule       SubscriptionRule `json:"rule"`
+	WebhookURL string           `json:"webhook_url"`
+	// Secret signs the webhook payloads; it is only returned when the subscription is created
+	Secret       string          `json:"secret,omitempty"`
+	CreatedAt    time.Time       `json:"created_at"`
+	LastDelivery *DeliveryStatus `json:"last_delivery,omitempty"`
+
+	query LocationQuery
+	// Rule state from the previous check, used to fire on changes only
+	checked       bool
+	matched       bool
+	lastCondition string
+}
+
+// public returns a copy of the subscription safe to return: without its secret
+func (sub *Subscription) public() Subscription {
+	c := *sub
+	c.Secret = ""
+	if sub.LastDelivery != nil {
+		delivery := *sub.LastDelivery
+		c.LastDelivery = &delivery
+	}
+	return c
+}
+
+// SubscriptionRequest is the body of POST /weather/subscriptions. The location
+// uses the same fields as the weather endpoints' query parameters.
+type SubscriptionRequest struct {
+	LocationRequest
+	Rule       SubscriptionRule `json:"rule"`
+	WebhookURL string           `json:"webhook_url"`
+}
+
+// WebhookEvent is the JSON payload POSTed to a subscription's webhook
+type WebhookEvent struct {
+	ID             string `json:"id"`
+	Type           string `json:"type"`
+	SubscriptionID string `json:"subscription_id"`
+	Location       string `json:"location"`
+	// PreviousCondition is set for condition_change events
+	PreviousCondition string               `json:"previous_condition,omitempty"`
+	Weather           CurrentWeatherReport `json:"weather"`
+	TriggeredAt       time.Time            `json:"triggered_at"`
+}
+
+// SubscriptionManager stores weather subscriptions and checks them in the background
+type SubscriptionManager struct {
+	Weather *WeatherService
+	Webhook *WebhookSender
+	// Interval between checks of every subscription
+	Interval time.Duration
+
+	mu            sync.Mutex
+	subscriptions map[string]*Subscription
+}
+
+// NewSubscriptionManager creates a SubscriptionManager that reads the weather through weather
+func NewSubscriptionManager(weather *WeatherService) *SubscriptionManager {
+	return &SubscriptionManager{
+		Weather:       weather,
+		Webhook:       NewWebhookSender(),
+		Interval:      DefaultSubscriptionInterval,
+		subscriptions: make(map[string]*Subscription),
+	}
+}
+
+// randomHex returns n random bytes, hex encoded
+func randomHex(n int) string {
+	b := make([]byte, n)
+	// crypto/rand.Read never returns an error
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validWebhookURL returns a message for the client when raw is not an absolute
+// http or https URL that the webhook sender may call. Hostnames are checked again
+// once resolved, when each delivery connects.
+func (m *SubscriptionManager) validWebhookURL(raw string) (string, bool) {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return "Field 'webhook_url' must be an absolute http or https URL", false
+	}
+	if m.Webhook.AllowPrivateNetworks {
+		return "", true
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	ip := net.ParseIP(host)
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") || (ip != nil && blockedWebhookIP(ip)) {
+		return "Field 'webhook_url' must not point to a loopback, private or link-local address", false
+	}
+	return "", true
+}
+
+// CreateHandler registers a subscription and returns it with its signing secret
+func (m *SubscriptionManager) CreateHandler(w http.ResponseWriter, r *http.Request) {
+	var req SubscriptionRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSubscriptionBody))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		response.Error(w, r, http.StatusBadRequest, response.CodeInvalidParameter, "Request body must be a JSON subscription object")
+		return
+	}
+
+	loc, err := req.LocationRequest.resolve(r)
+	if err != nil {
+		code, message := describeLocationError(err)
+		response.Error(w, r, http.StatusBadRequest, code, message)
+		return
+	}
+	if message, ok := req.Rule.validate(); !ok {
+		response.Error(w, r, http.StatusBadRequest, response.CodeInvalidParameter, message)
+		return
+	}
+	if message, ok := m.validWebhookURL(req.WebhookURL); !ok {
+		response.Error(w, r, http.StatusBadRequest, response.CodeInvalidParameter, message)
+		return
+	}
+
+	sub := &Subscription{
+		ID:         randomHex(8),
+		Location:   loc.String(),
+		Rule:       req.Rule,
+		WebhookURL: req.WebhookURL,
+		Secret:     randomHex(32),
+		CreatedAt:  time.Now().UTC(),
+		query:      loc,
+	}
+
+	m.mu.Lock()
+	if len(m.subscriptions) >= MaxSubscriptions {
+		m.mu.Unlock()
+		response.Error(w, r, http.StatusConflict, response.CodeLimitReached,
+			"At most "+strconv.Itoa(MaxSubscriptions)+" subscriptions can be registered")
+		return
+	}
+	m.subscriptions[sub.ID] = sub
+	created := *sub
+	m.mu.Unlock()
+
+	w.Header().Set("Location", "/weather/subscriptions/"+sub.ID)
+	response.JSON(w, r, http.StatusCreated, created)
+}
+
+// owned returns a copy of the subscription named by the {id} path value, without
+// its secret, when the request proves ownership by sending the secret as a bearer
+// token. Otherwise it writes a 401, or a 404 that does not reveal whether the
+// subscription exists, and returns false.
+func (m *SubscriptionManager) owned(w http.ResponseWriter, r *http.Request) (Subscription, bool) {
+	token, ok := bearerToken(r)
+	if !ok {
+		writeUnauthorized(w, r, "Send the subscription secret as 'Authorization: Bearer <secret>'")
+		return Subscription{}, false
+	}
+
+	m.mu.Lock()
+	sub, ok := m.subscriptions[r.PathValue("id")]
+	var found Subscription
+	if ok {
+		ok = tokenEqual(token, sub.Secret)
+		found = sub.public()
+	}
+	m.mu.Unlock()
+
+	if !ok {
+		response.Error(w, r, http.StatusNotFound, response.CodeNotFound, "Subscription not found")
+		return Subscription{}, false
+	}
+	return found, true
+}
+
+// GetHandler returns the subscription named by the {id} path value, without its
+// secret. The secret must be sent as a bearer token.
+func (m *SubscriptionManager) GetHandler(w http.ResponseWriter, r *http.Request) {
+	sub, ok := m.owned(w, r)
+	if !ok {
+		return
+	}
+	response.JSON(w, r, http.StatusOK, sub)
+}
+
+// DeleteHandler removes the subscription named by the {id} path value. The secret
+// must be sent as a bearer token.
+func (m *SubscriptionManager) DeleteHandler(w http.ResponseWriter, r *http.Request) {
+	sub, ok := m.owned(w, r)
+	if !ok {
+		return
+	}
+	m.mu.Lock()
+	delete(m.subscriptions, sub.ID)
+	m.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Run checks the subscriptions every Interval until ctx is cancelled.
+// A zero Interval disables background checks.
+func (m *SubscriptionManager) Run(ctx context.Context) {
+	if m.Interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(m.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.Poll(ctx)
+		}
+	}
+}
+
+// pendingEvent is a webhook delivery produced by a check
+type pendingEvent struct {
+	sub   *Subscription
+	event WebhookEvent
+}
+
+// Poll checks every subscription once and delivers the resulting webhooks,
+// returning when all deliveries have finished. Locations watched by several
+// subscriptions are looked up once, and lookups go through the weather cache.
+func (m *SubscriptionManager) Poll(ctx context.Context) {
+	// Group subscriptions by location
+	m.mu.Lock()
+	byLocation := make(map[string][]*Subscription)
+	queries := make(map[string]LocationQuery)
+	for _, sub := range m.subscriptions {
+		key := sub.query.key()
+		byLocation[key] = append(byLocation[key], sub)
+		queries[key] = sub.query
+	}
+	m.mu.Unlock()
+
+	var events []pendingEvent
+	for key, subs := range byLocation {
+		weatherData, _, err := m.Weather.currentWeather(ctx, queries[key])
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			slog.WarnContext(ctx, "Error checking weather subscriptions", "location", queries[key].String(), "error", err)
+			continue
+		}
+
+		m.mu.Lock()
+		for _, sub := range subs {
+			if _, ok := m.subscriptions[sub.ID]; !ok {
+				continue // Deleted while the weather was fetched
+			}
+			if event, fire := sub.check(weatherData); fire {
+				events = append(events, pendingEvent{sub: sub, event: event})
+			}
+		}
+		m.mu.Unlock()
+	}
+
+	var wg sync.WaitGroup
+	for _, pending := range events {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.deliver(ctx, pending)
+		}()
+	}
+	wg.Wait()
+}
+
+// check evaluates the rule against new weather data and updates the rule state.
+// Callers must hold the manager's lock.
+func (sub *Subscription) check(weatherData CurrentWeather) (WebhookEvent, bool) {
+	report := weatherData.Report(sub.Rule.Units)
+	event := WebhookEvent{
+		ID:             randomHex(16),
+		Type:           sub.Rule.Type,
+		SubscriptionID: sub.ID,
+		Location:       sub.Location,
+		Weather:        report,
+		TriggeredAt:    time.Now().UTC(),
+	}
+
+	firstCheck := !sub.checked
+	sub.checked = true
+
+	if sub.Rule.Type == RuleConditionChange {
+		// The first check only records the condition to compare against
+		previous := sub.lastCondition
+		sub.lastCondition = report.Current.Condition
+		if firstCheck || previous == report.Current.Condition {
+			return WebhookEvent{}, false
+		}
+		event.PreviousCondition = previous
+		return event, true
+	}
+
+	// Temperature rules fire when the rule starts to hold, not on every check while it does
+	matched := sub.Rule.matches(report)
+	fire := matched && !sub.matched
+	sub.matched = matched
+	return event, fire
+}
+
+// deliver sends one event to its subscription's webhook and records the outcome
+func (m *SubscriptionManager) deliver(ctx context.Context, pending pendingEvent) {
+	body, err := json.Marshal(pending.event)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error encoding webhook event", "error", err)
+		return
+	}
+
+	status := m.Webhook.Send(ctx, pending.sub.WebhookURL, pending.sub.Secret, pending.event.ID, body)
+	if status.Error != "" {
+		slog.WarnContext(ctx, "Webhook delivery failed", "subscription_id", pending.sub.ID,
+			"event_id", status.EventID, "attempts", status.Attempts, "error", status.Error)
+	}
+
+	m.mu.Lock()
+	pending.sub.LastDelivery = &status
+	m.mu.Unlock()
+}
@@ -0,0 +1,85 @@
+package routes
+
+import (
+	"math"
+	"strings"
+)
+
+// Units selects the measurement system of a weather report
+type Units string
+
+// Supported unit systems
+const (
+	UnitsMetric   Units = "metric"
+	UnitsImperial Units = "imperial"
+)
+
+// DefaultUnits is used when a request does not ask for a unit system
+const DefaultUnits = UnitsImperial
+
+// parseUnits reads a units query parameter; "" selects DefaultUnits
+func parseUnits(raw string) (Units, bool) {
+	switch Units(strings.ToLower(raw)) {
+	case "":
+		return DefaultUnits, true
+	case UnitsMetric:
+		return UnitsMetric, true
+	case UnitsImperial:
+		return UnitsImperial, true
+	default:
+		return "", false
+	}
+}
+
+// UnitLabels names the unit of each measurement in a report
+type UnitLabels struct {
+	System      Units  `json:"system"`
+	Temperature string `json:"temperature"`
+	Speed       string `json:"speed"`
+	Pressure    string `json:"pressure"`
+	Visibility  string `json:"visibility"`
+}
+
+// labels returns the unit names for the system
+func (u Units) labels() UnitLabels {
+	if u == UnitsMetric {
+		return UnitLabels{System: u, Temperature: "C", Speed: "km/h", Pressure: "hPa", Visibility: "km"}
+	}
+	return UnitLabels{System: u, Temperature: "F", Speed: "mph", Pressure: "inHg", Visibility: "mi"}
+}
+
+// Conversion factors from metric to imperial units
+const (
+	milesPerKilometer      = 0.621371
+	inchesHgPerHectopascal = 0.02953
+)
+
+// roundTo rounds v to the given number of decimal places
+func roundTo(v float64, places int) float64 {
+	scale := math.Pow(10, float64(places))
+	return math.Round(v*scale) / scale
+}
+
+// celsiusToFahrenheit converts a temperature, rounded to one decimal like WeatherAPI reports it
+func celsiusToFahrenheit(c float64) float64 {
+	return roundTo(c*9/5+32, 1)
+}
+
+// kilometersToMiles converts a distance or speed, rounded to one decimal
+func kilometersToMiles(km float64) float64 {
+	return roundTo(km*milesPerKilometer, 1)
+}
+
+// hectopascalsToInches converts a pressure to inches of mercury, rounded to two decimals
+func hectopascalsToInches(hpa float64) float64 {
+	return roundTo(hpa*inchesHgPerHectopascal, 2)
+}
+
+// compassPoints are the 16 wind directions, clockwise from north
+var compassPoints = []string{"N", "NNE", "NE", "ENE", "E", "ESE", "SE", "SSE", "S", "SSW", "SW", "WSW", "W", "WNW", "NW", "NNW"}
+
+// compassDirection converts a bearing in degrees to a 16-point compass direction
+func compassDirection(degrees int) string {
+	index := int(math.Round(float64(((degrees%360)+360)%360)/22.5)) % len(compassPoints)
+	return compassPoints[index]
+}
@@ -0,0 +1,293 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Default resilience settings used by NewWeatherService
+const (
+	DefaultWeatherRetryAttempts   = 3
+	DefaultWeatherRetryBaseDelay  = 100 * time.Millisecond
+	DefaultWeatherRetryMaxDelay   = 2 * time.Second
+	DefaultWeatherBreakerFailures = 5
+	DefaultWeatherBreakerCooldown = 30 * time.Second
+)
+
+// errCircuitOpen is returned while the circuit breaker rejects upstream calls
+var errCircuitOpen = errors.New("weather upstream is temporarily unavailable")
+
+// RetryPolicy controls how failed upstream requests are retried.
+// Delays grow exponentially from BaseDelay up to MaxDelay with full jitter.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// backoff returns the jittered delay before the given retry (1 for the first retry)
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	ceiling := p.BaseDelay << (retry - 1)
+	if ceiling > p.MaxDelay || ceiling <= 0 {
+		ceiling = p.MaxDelay
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int64N(int64(ceiling) + 1))
+}
+
+// Circuit breaker states
+const (
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half_open"
+)
+
+// CircuitBreaker stops calling the upstream after FailureThreshold consecutive failures.
+// Once Cooldown has passed it lets a single trial request through; success closes the
+// circuit again and failure re-opens it. It is safe for concurrent use.
+type CircuitBreaker struct {
+	FailureThreshold int
+	Cooldown         time.Duration
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	trial    bool // a half-open trial request is in flight
+	now      func() time.Time
+}
+
+// BreakerSnapshot is the externally visible state of a CircuitBreaker
+type BreakerSnapshot struct {
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+	RetryAt             *time.Time `json:"retry_at,omitempty"`
+}
+
+// NewCircuitBreaker creates a closed circuit breaker
+func NewCircuitBreaker(failureThreshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		FailureThreshold: failureThreshold,
+		Cooldown:         cooldown,
+		state:            breakerClosed,
+		now:              time.Now,
+	}
+}
+
+// Snapshot returns the current breaker state
+func (b *CircuitBreaker) Snapshot() BreakerSnapshot {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	snapshot := BreakerSnapshot{State: b.state, ConsecutiveFailures: b.failures}
+	if b.state != breakerClosed {
+		openedAt := b.openedAt
+		retryAt := b.openedAt.Add(b.Cooldown)
+		snapshot.OpenedAt = &openedAt
+		snapshot.RetryAt = &retryAt
+	}
+	return snapshot
+}
+
+// retryAfter returns how long until the breaker lets a trial request through
+func (b *CircuitBreaker) retryAfter() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	wait := b.openedAt.Add(b.Cooldown).Sub(b.now())
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+// allow reports whether a request may be sent, returning errCircuitOpen if not
+func (b *CircuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if b.now().Sub(b.openedAt) < b.Cooldown {
+			return errCircuitOpen
+		}
+		b.state = breakerHalfOpen
+		b.trial = true
+		return nil
+	case breakerHalfOpen:
+		if b.trial {
+			return errCircuitOpen
+		}
+		b.trial = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// record updates the breaker with the outcome of an allowed request
+func (b *CircuitBreaker) record(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+	if success {
+		b.state = breakerClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.FailureThreshold {
+		b.state = breakerOpen
+		b.openedAt = b.now()
+	}
+}
+
+// release ends an allowed request without recording an outcome
+func (b *CircuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+}
+
+// retryable reports whether a response status is worth retrying
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0), true
+	}
+	return 0, false
+}
+
+// Upstream sends GET requests to a weather provider's API, retrying timeouts,
+// network errors, 5xx and 429 responses and guarding the API with a circuit breaker.
+// Providers embed it so each API gets its own retry settings and breaker.
+type Upstream struct {
+	HTTPClient *http.Client
+	// Retry controls retries of failed requests
+	Retry RetryPolicy
+	// Breaker stops calling a failing API; nil disables it
+	Breaker *CircuitBreaker
+
+	retries atomic.Int64
+}
+
+// UpstreamStatus is the externally visible state of an Upstream
+type UpstreamStatus struct {
+	Breaker *BreakerSnapshot `json:"circuit_breaker,omitempty"`
+	Retries int64            `json:"retries"`
+}
+
+// NewUpstream creates an Upstream with the default client, retry policy and breaker
+func NewUpstream() *Upstream {
+	return &Upstream{
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+		Retry: RetryPolicy{
+			MaxAttempts: DefaultWeatherRetryAttempts,
+			BaseDelay:   DefaultWeatherRetryBaseDelay,
+			MaxDelay:    DefaultWeatherRetryMaxDelay,
+		},
+		Breaker: NewCircuitBreaker(DefaultWeatherBreakerFailures, DefaultWeatherBreakerCooldown),
+	}
+}
+
+// Status returns the breaker state and retry count
+func (u *Upstream) Status() UpstreamStatus {
+	status := UpstreamStatus{Retries: u.retries.Load()}
+	if u.Breaker != nil {
+		snapshot := u.Breaker.Snapshot()
+		status.Breaker = &snapshot
+	}
+	return status
+}
+
+// CloseIdleConnections closes idle keep-alive connections to the API
+func (u *Upstream) CloseIdleConnections() {
+	u.HTTPClient.CloseIdleConnections()
+}
+
+// Get sends a GET request to apiURL through the circuit breaker, retrying failures
+// with jittered exponential backoff. The caller must close the returned response body.
+func (u *Upstream) Get(ctx context.Context, apiURL string) (*http.Response, error) {
+	if u.Breaker != nil {
+		if err := u.Breaker.allow(); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := u.getWithRetry(ctx, apiURL)
+
+	if u.Breaker != nil {
+		switch {
+		case err != nil && ctx.Err() != nil:
+			// The caller gave up; that says nothing about the upstream
+			u.Breaker.release()
+		case err != nil:
+			u.Breaker.record(false)
+		default:
+			u.Breaker.record(resp.StatusCode < http.StatusInternalServerError)
+		}
+	}
+	return resp, err
+}
+
+// getWithRetry performs the request, retrying according to u.Retry
+func (u *Upstream) getWithRetry(ctx context.Context, apiURL string) (*http.Response, error) {
+	attempts := max(u.Retry.MaxAttempts, 1)
+
+	for attempt := 1; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := u.HTTPClient.Do(req)
+		if attempt == attempts || ctx.Err() != nil {
+			return resp, err
+		}
+		if err == nil && !retryable(resp.StatusCode) {
+			return resp, nil
+		}
+
+		delay := u.Retry.backoff(attempt)
+		if err == nil {
+			// Honor the upstream's own hint, but never wait longer than our policy allows
+			if hint, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+				if hint > u.Retry.MaxDelay {
+					return resp, nil
+				}
+				delay = hint
+			}
+			resp.Body.Close()
+		}
+
+		u.retries.Add(1)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// Default webhook delivery settings
+const (
+	DefaultWebhookAttempts  = 4
+	DefaultWebhookBaseDelay = 500 * time.Millisecond
+	DefaultWebhookMaxDelay  = 10 * time.Second
+	DefaultWebhookTimeout   = 10 * time.Second
+)
+
+// Headers sent with every webhook delivery
+const (
+	// WebhookSignatureHeader carries "sha256=" and the hex HMAC-SHA256 of
+	// "<timestamp>.<body>" keyed with the subscription's secret
+	WebhookSignatureHeader = "X-Webhook-Signature"
+	// WebhookTimestampHeader carries the Unix time the delivery was signed at
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	// WebhookEventHeader carries the event ID, which stays the same across retries
+	WebhookEventHeader = "X-Webhook-Event"
+)
+
+// ErrWebhookAddressBlocked is returned when a webhook would connect to a loopback,
+// private, link-local, unspecified or other special-purpose address
+var ErrWebhookAddressBlocked = errors.New("webhook address is not publicly routable")
+
+// blockedWebhookNets lists the special-purpose ranges net.IP has no predicate for:
+// "this network", carrier-grade NAT, IETF protocol assignments and benchmarking
+var blockedWebhookNets = parseCIDRs("0.0.0.0/8", "100.64.0.0/10", "192.0.0.0/24", "198.18.0.0/15")
+
+// parseCIDRs parses a fixed list of CIDR ranges, panicking on a malformed one
+func parseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets[i] = n
+	}
+	return nets
+}
+
+// blockedWebhookIP reports whether ip is an internal address webhooks may not reach
+func blockedWebhookIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return true
+	}
+	for _, n := range blockedWebhookNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// SignWebhook returns the signature header value for a webhook body sent at timestamp.
+// Receivers recompute it with their subscription secret and compare with hmac.Equal.
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// WebhookSender POSTs signed JSON payloads to webhook URLs, retrying network
+// errors, 5xx and 429 responses with jittered backoff
+type WebhookSender struct {
+	HTTPClient *http.Client
+	Retry      RetryPolicy
+	// AllowPrivateNetworks lets webhooks reach loopback, private and link-local
+	// addresses. Anyone can register a webhook, so it is off by default to keep
+	// clients from making the server call internal hosts.
+	AllowPrivateNetworks bool
+}
+
+// NewWebhookSender creates a WebhookSender with the default retry policy and a
+// client that refuses redirects and, unless AllowPrivateNetworks is set, checks
+// every address it connects to with AllowedAddress
+func NewWebhookSender() *WebhookSender {
+	ws := &WebhookSender{
+		Retry: RetryPolicy{
+			MaxAttempts: DefaultWebhookAttempts,
+			BaseDelay:   DefaultWebhookBaseDelay,
+			MaxDelay:    DefaultWebhookMaxDelay,
+		},
+	}
+
+	// The check runs on the resolved address at connect time, so a hostname
+	// cannot pass validation and then resolve to an internal host
+	dialer := &net.Dialer{
+		Timeout: DefaultWebhookTimeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if !ws.AllowedAddress(net.ParseIP(host)) {
+				return fmt.Errorf("%w: %s", ErrWebhookAddressBlocked, host)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// A proxy would make the dialer check the proxy's address instead of the webhook's
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	ws.HTTPClient = &http.Client{
+		Timeout:   DefaultWebhookTimeout,
+		Transport: transport,
+		// A redirect could point an allowed host at an internal one
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return ws
+}
+
+// AllowedAddress reports whether webhooks may connect to ip
+func (ws *WebhookSender) AllowedAddress(ip net.IP) bool {
+	return ip != nil && (ws.AllowPrivateNetworks || !blockedWebhookIP(ip))
+}
+
+// DeliveryStatus describes the latest delivery to a subscription's webhook
+type DeliveryStatus struct {
+	EventID    string    `json:"event_id"`
+	At         time.Time `json:"at"`
+	Attempts   int       `json:"attempts"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Send delivers body to webhookURL. Each attempt is signed afresh so the
+// timestamp stays current; the event ID header lets receivers drop duplicates.
+func (ws *WebhookSender) Send(ctx context.Context, webhookURL, secret, eventID string, body []byte) DeliveryStatus {
+	attempts := max(ws.Retry.MaxAttempts, 1)
+	status := DeliveryStatus{EventID: eventID}
+
+	for attempt := 1; ; attempt++ {
+		status.At = time.Now().UTC()
+		status.Attempts = attempt
+		status.StatusCode, status.Error = 0, ""
+
+		code, err := ws.post(ctx, webhookURL, secret, eventID, body)
+		switch {
+		case err != nil:
+			status.Error = err.Error()
+		default:
+			status.StatusCode = code
+			if code < 200 || code > 299 {
+				status.Error = "webhook responded with status " + strconv.Itoa(code)
+			}
+		}
+
+		if status.Error == "" || attempt == attempts || ctx.Err() != nil {
+			return status
+		}
+		if err == nil && !retryable(code) {
+			return status
+		}
+		// A blocked address stays blocked, so retrying cannot help
+		if errors.Is(err, ErrWebhookAddressBlocked) {
+			return status
+		}
+
+		timer := time.NewTimer(ws.Retry.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return status
+		case <-timer.C:
+		}
+	}
+}
+
+// post makes one signed delivery attempt and returns the response status
+func (ws *WebhookSender) post(ctx context.Context, webhookURL, secret, eventID string, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, eventID)
+	req.Header.Set(WebhookTimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(secret, timestamp, body))
+
+	resp, err := ws.HTTPClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	// Drain a little of the body so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
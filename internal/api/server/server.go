@@ -0,0 +1,121 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Config holds the settings used to build the HTTP server
+type Config struct {
+	Port              string
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	ShutdownTimeout   time.Duration
+}
+
+// DefaultConfig returns the configuration used when no environment overrides are set
+func DefaultConfig() Config {
+	return Config{
+		Port:              "8080",
+		ReadTimeout:       15 * time.Second,
+		ReadHeaderTimeout: 5 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       60 * time.Second,
+		ShutdownTimeout:   20 * time.Second,
+	}
+}
+
+// LoadConfig builds a Config from environment variables, falling back to the defaults.
+// Durations use Go duration syntax, e.g. "15s" or "1m30s".
+func LoadConfig(getenv func(string) string) (Config, error) {
+	cfg := DefaultConfig()
+
+	if port := getenv("PORT"); port != "" {
+		cfg.Port = port
+	}
+
+	durations := []struct {
+		key string
+		dst *time.Duration
+	}{
+		{"READ_TIMEOUT", &cfg.ReadTimeout},
+		{"READ_HEADER_TIMEOUT", &cfg.ReadHeaderTimeout},
+		{"WRITE_TIMEOUT", &cfg.WriteTimeout},
+		{"IDLE_TIMEOUT", &cfg.IdleTimeout},
+		{"SHUTDOWN_TIMEOUT", &cfg.ShutdownTimeout},
+	}
+	for _, d := range durations {
+		value := getenv(d.key)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid %s %q: %w", d.key, value, err)
+		}
+		if parsed < 0 {
+			return Config{}, fmt.Errorf("invalid %s %q: must not be negative", d.key, value)
+		}
+		*d.dst = parsed
+	}
+
+	return cfg, nil
+}
+
+// New creates an http.Server for the given handler using the configured timeouts
+func New(cfg Config, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              ":" + cfg.Port,
+		Handler:           handler,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+}
+
+// ListenAndServe listens on srv.Addr and serves until ctx is cancelled
+func ListenAndServe(ctx context.Context, srv *http.Server, grace time.Duration) error {
+	ln, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		return err
+	}
+	return Serve(ctx, srv, ln, grace)
+}
+
+// Serve accepts connections on ln until ctx is cancelled, then shuts the server down,
+// giving in-flight requests up to grace to finish. Hooks added with
+// srv.RegisterOnShutdown run as soon as shutdown begins.
+func Serve(ctx context.Context, srv *http.Server, ln net.Listener, grace time.Duration) error {
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.Serve(ln)
+	}()
+
+	select {
+	case err := <-serveErr:
+		// The server stopped on its own, which only happens on failure
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		// Grace period expired; drop whatever is still open
+		srv.Close()
+		return fmt.Errorf("graceful shutdown did not complete: %w", err)
+	}
+
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
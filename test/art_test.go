@@ -1,26 +1,24 @@
 package test
 
 import (
+	"encoding/json"
+	"math/rand/v2"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
 	"testing"
+	"testing/fstest"
 
+	"github.com/jorge2751/GoAPI/internal/api/data"
+	"github.com/jorge2751/GoAPI/internal/api/response"
 	"github.com/jorge2751/GoAPI/internal/api/routes"
 )
 
 func TestArtHandler(t *testing.T) {
-	// Create a request to pass to our handler
-	req, err := http.NewRequest("GET", "/art", nil)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	// Create a ResponseRecorder to record the response
-	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(routes.ArtHandler)
-
-	// Call the handler with our request and response recorder
-	handler.ServeHTTP(rr, req)
+	router := newTestRouter(routes.Services{Art: routes.NewArtAPI(data.NewArtService())})
+	rr := serve(router, "GET", "/art/m-pattern", "")
 
 	// Check the status code
 	if status := rr.Code; status != http.StatusOK {
@@ -47,3 +45,110 @@ func TestArtHandler(t *testing.T) {
 			rr.Body.String()[0:7], expectedStart)
 	}
 }
+
+func TestArtGallery(t *testing.T) {
+	router := newTestRouter(routes.Services{Art: routes.NewArtAPI(data.NewArtService())})
+
+	t.Run("List", func(t *testing.T) {
+		w := serve(router, "GET", "/art", "")
+		var body response.Envelope[[]data.Art]
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("Failed to parse response body: %v", err)
+		}
+		if len(body.Data) < 3 {
+			t.Fatalf("Expected several pieces; got %+v", body.Data)
+		}
+		for i, art := range body.Data {
+			if art.ID == "" || art.Title == "" || art.Width == 0 || art.Height == 0 || art.Content != "" {
+				t.Errorf("Expected an ID, title and dimensions without content; got %+v", art)
+			}
+			if i > 0 && body.Data[i-1].ID >= art.ID {
+				t.Errorf("Expected pieces sorted by ID; got %s before %s", body.Data[i-1].ID, art.ID)
+			}
+		}
+		want := data.Art{ID: "m-pattern", Title: "M Pattern", Width: 72, Height: 36}
+		if !slices.Contains(body.Data, want) {
+			t.Errorf("Expected %+v in the gallery; got %+v", want, body.Data)
+		}
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		for _, w := range []*httptest.ResponseRecorder{
+			serve(router, "GET", "/art/m-pattern?format=json", ""),
+			serve(router, "GET", "/art/m-pattern", "", "Accept", "application/json"),
+		} {
+			var body response.Envelope[data.Art]
+			json.Unmarshal(w.Body.Bytes(), &body)
+			if body.Data.Title != "M Pattern" || !strings.HasPrefix(body.Data.Content, "MMMM") {
+				t.Errorf("Expected the piece with its content as JSON; got %s", w.Body.String())
+			}
+		}
+		if w := serve(router, "GET", "/art/m-pattern", "", "Accept", "text/html,*/*;q=0.8"); w.Header().Get("Content-Type") != "text/plain; charset=utf-8" {
+			t.Errorf("Expected browsers to get plain text; got %q", w.Header().Get("Content-Type"))
+		}
+		if w := serve(router, "GET", "/art/m-pattern?format=png", ""); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status BadRequest for an unknown format; got %v", w.Code)
+		}
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		w := serve(router, "GET", "/art/mona-lisa", "")
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("Expected status NotFound; got %v", w.Code)
+		}
+		assertErrorCode(t, w.Body.Bytes(), response.CodeNotFound)
+	})
+
+	t.Run("Random", func(t *testing.T) {
+		pieces := data.DefaultArt()
+		newRouter := func() http.Handler {
+			return newTestRouter(routes.Services{Art: routes.NewArtAPI(data.NewArtServiceWithSource(pieces, rand.NewPCG(5, 6)))})
+		}
+		first, second := newRouter(), newRouter()
+		seen := map[string]bool{}
+		for range 20 {
+			a := serve(first, "GET", "/art/random", "", "Accept", "application/json").Body.String()
+			b := serve(second, "GET", "/art/random", "", "Accept", "application/json").Body.String()
+			if a != b {
+				t.Fatalf("Expected equal seeds to pick the same pieces; got %s and %s", a, b)
+			}
+			seen[a] = true
+		}
+		if len(seen) < 2 {
+			t.Errorf("Expected a random sequence to vary; got %d distinct pieces", len(seen))
+		}
+	})
+}
+
+func TestLoadArt(t *testing.T) {
+	gallery := fstest.MapFS{
+		"boat.txt":          {Data: []byte("---\ntitle: A Boat\nartist: Someone\n---\n  |\\\n__|_\\_\n\\____/\n\n")},
+		"birds/two-owl.txt": {Data: []byte("{o,o}\r\n/)_)\r\n \" \"")},
+		"README.md":         {Data: []byte("Not art.")},
+	}
+	pieces, err := data.LoadArt(gallery)
+	if err != nil {
+		t.Fatalf("Failed to load art: %v", err)
+	}
+	want := []data.Art{
+		{ID: "boat", Title: "A Boat", Artist: "Someone", Width: 6, Height: 3, Content: "  |\\\n__|_\\_\n\\____/"},
+		{ID: "two-owl", Title: "Two Owl", Width: 5, Height: 3, Content: "{o,o}\n/)_)\n \" \""},
+	}
+	if !reflect.DeepEqual(pieces, want) {
+		t.Errorf("Expected %+v; got %+v", want, pieces)
+	}
+
+	for name, files := range map[string]fstest.MapFS{
+		"Empty":           {"README.md": {Data: []byte("Not art.")}},
+		"BadName":         {"Boat 2.txt": {Data: []byte("art")}},
+		"ReservedName":    {"random.txt": {Data: []byte("art")}},
+		"Duplicate":       {"boat.txt": {Data: []byte("art")}, "more/boat.txt": {Data: []byte("art")}},
+		"NoContent":       {"boat.txt": {Data: []byte("---\ntitle: Boat\n---\n\n")}},
+		"OpenFrontMatter": {"boat.txt": {Data: []byte("---\ntitle: Boat\n  |\\")}},
+		"UnknownKey":      {"boat.txt": {Data: []byte("---\ncolor: blue\n---\nart")}},
+	} {
+		if _, err := data.LoadArt(files); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jorge2751/GoAPI/internal/api/middleware"
+	"github.com/jorge2751/GoAPI/internal/api/requestid"
+	"github.com/jorge2751/GoAPI/internal/api/response"
+)
+
+// newTestLogger returns a JSON logger that writes into buf
+func newTestLogger(buf *bytes.Buffer) *slog.Logger {
+	return slog.New(requestid.NewLogHandler(slog.NewJSONHandler(buf, nil)))
+}
+
+func TestLoggingMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newTestLogger(&buf)
+
+	var seenID string
+	handler := middleware.NewLoggingMiddleware(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seenID = requestid.FromContext(r.Context())
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("short and stout"))
+	}))
+
+	t.Run("PropagatesRequestID", func(t *testing.T) {
+		buf.Reset()
+		req := httptest.NewRequest("GET", "/teapot", nil)
+		req.Header.Set(requestid.Header, "abc-123")
+		req.Header.Set("User-Agent", "test-agent")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if seenID != "abc-123" {
+			t.Errorf("Expected request ID abc-123 in context; got %q", seenID)
+		}
+		if got := rr.Header().Get(requestid.Header); got != "abc-123" {
+			t.Errorf("Expected X-Request-ID abc-123 on response; got %q", got)
+		}
+
+		var record map[string]any
+		if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+			t.Fatalf("Expected one JSON log line; got %q (%v)", buf.String(), err)
+		}
+
+		expected := map[string]any{
+			"request_id": "abc-123",
+			"method":     "GET",
+			"path":       "/teapot",
+			"status":     float64(http.StatusTeapot),
+			"bytes":      float64(len("short and stout")),
+			"user_agent": "test-agent",
+		}
+		for key, want := range expected {
+			if record[key] != want {
+				t.Errorf("Expected log field %s=%v; got %v", key, want, record[key])
+			}
+		}
+		for _, key := range []string{"remote_addr", "duration_ms"} {
+			if _, ok := record[key]; !ok {
+				t.Errorf("Expected log field %s to be present", key)
+			}
+		}
+	})
+
+	t.Run("GeneratesRequestID", func(t *testing.T) {
+		buf.Reset()
+		req := httptest.NewRequest("GET", "/teapot", nil)
+		req.Header.Set(requestid.Header, "has spaces\n")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		id := rr.Header().Get(requestid.Header)
+		if id == "" || id == "has spaces\n" {
+			t.Errorf("Expected a freshly generated request ID; got %q", id)
+		}
+		if seenID != id {
+			t.Errorf("Context request ID %q does not match response header %q", seenID, id)
+		}
+	})
+}
+
+// tagMiddleware appends name to the X-Trace header so tests can observe ordering
+func tagMiddleware(name string) middleware.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("X-Trace", name)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestChain(t *testing.T) {
+	global := middleware.NewChain(tagMiddleware("first"), tagMiddleware("second"))
+
+	// HandlerFunc-style middleware can be adapted into the chain
+	legacy := middleware.FromHandlerFunc(func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("X-Trace", "legacy")
+			next(w, r)
+		}
+	})
+	perRoute := global.Use(legacy)
+
+	final := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("X-Trace", "handler")
+	}
+
+	t.Run("GlobalOrder", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		global.ThenFunc(final).ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+
+		want := []string{"first", "second", "handler"}
+		got := rr.Header().Values("X-Trace")
+		if len(got) != len(want) {
+			t.Fatalf("Expected trace %v; got %v", want, got)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("Expected trace %v; got %v", want, got)
+				break
+			}
+		}
+	})
+
+	t.Run("PerRouteDoesNotAffectGlobal", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		perRoute.Then(http.HandlerFunc(final)).ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+		if got := rr.Header().Values("X-Trace"); len(got) != 4 || got[2] != "legacy" {
+			t.Errorf("Expected legacy middleware after global ones; got %v", got)
+		}
+
+		rr = httptest.NewRecorder()
+		global.ThenFunc(final).ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+		if got := rr.Header().Values("X-Trace"); len(got) != 3 {
+			t.Errorf("Expected global chain to be unchanged; got %v", got)
+		}
+	})
+}
+
+func TestRecoveryMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	chain := middleware.NewChain(middleware.NewLoggingMiddleware(newTestLogger(&buf)), middleware.RecoveryMiddleware)
+
+	before := middleware.RecoveredPanics()
+
+	handler := chain.ThenFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	req := httptest.NewRequest("GET", "/explode", nil)
+	req.Header.Set(requestid.Header, "panic-req")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status 500; got %v", rr.Code)
+	}
+	if contentType := rr.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Expected JSON error body; got content type %q", contentType)
+	}
+
+	assertErrorCode(t, rr.Body.Bytes(), response.CodeInternal)
+	if !bytes.Contains(rr.Body.Bytes(), []byte(`"request_id":"panic-req"`)) {
+		t.Errorf("Expected request ID in error body; got %s", rr.Body.String())
+	}
+
+	if got := middleware.RecoveredPanics(); got != before+1 {
+		t.Errorf("Expected recovered panic count %d; got %d", before+1, got)
+	}
+
+	// The access log records the 500
+	if !bytes.Contains(buf.Bytes(), []byte(`"status":500`)) {
+		t.Errorf("Expected logged status 500; got %s", buf.String())
+	}
+}
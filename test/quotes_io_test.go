@@ -0,0 +1,392 @@
+package test
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jorge2751/GoAPI/internal/api/data"
+	"github.com/jorge2751/GoAPI/internal/api/response"
+)
+
+// importQuotes posts body to /quotes/import on router and returns the recorder and report
+func importQuotes(t *testing.T, router http.Handler, query, contentType, body string) (*httptest.ResponseRecorder, data.ImportReport) {
+	t.Helper()
+
+	w := serve(router, "POST", "/quotes/import?"+query, body, "Content-Type", contentType)
+
+	var report response.Envelope[data.ImportReport]
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+			t.Fatalf("Failed to parse response body: %v", err)
+		}
+	}
+	return w, report.Data
+}
+
+// withoutIDs returns quotes with their IDs cleared
+func withoutIDs(quotes []data.Quote) []data.Quote {
+	cleared := make([]data.Quote, len(quotes))
+	for i, q := range quotes {
+		q.ID = ""
+		cleared[i] = q
+	}
+	return cleared
+}
+
+func TestQuoteExportRoundTrip(t *testing.T) {
+	source := data.NewQuoteService()
+	// Characters that need quoting or escaping in every format
+	source.Create(data.Quote{Text: "He said: \"Well, then\"\n— and left. # not a comment", Author: "O'Brien, Jr.", Tags: []string{"ünïcode", "edge-case"}})
+	source.Create(data.Quote{Text: "- [not a list]", Author: "~", Tags: nil})
+	original, _ := source.List()
+	router := newQuoteRouter(source)
+
+	tests := []struct {
+		format      string
+		contentType string
+	}{
+		{data.QuoteFormatJSON, "application/json"},
+		{data.QuoteFormatCSV, "text/csv; charset=utf-8"},
+		{data.QuoteFormatYAML, "application/yaml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			w := serve(router, "GET", "/quotes/export?format="+tt.format, "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status OK; got %v: %s", w.Code, w.Body.String())
+			}
+			if got := w.Header().Get("Content-Type"); got != tt.contentType {
+				t.Errorf("Expected Content-Type %q; got %q", tt.contentType, got)
+			}
+			if got := w.Header().Get("Content-Disposition"); got != `attachment; filename="quotes.`+tt.format+`"` {
+				t.Errorf("Unexpected Content-Disposition %q", got)
+			}
+
+			empty := data.NewQuoteServiceWithStore(data.NewMemoryQuoteStore(nil))
+			w, report := importQuotes(t, newQuoteRouter(empty), "", tt.contentType, w.Body.String())
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected the export to import; got %v: %s", w.Code, w.Body.String())
+			}
+			if len(report.Errors) != 0 || len(report.Duplicates) != 0 {
+				t.Errorf("Expected a clean import; got errors %v and duplicates %v", report.Errors, report.Duplicates)
+			}
+			imported, _ := empty.List()
+			if !reflect.DeepEqual(withoutIDs(imported), withoutIDs(original)) {
+				t.Errorf("Round trip changed the quotes:\n got %+v\nwant %+v", imported, original)
+			}
+		})
+	}
+
+	t.Run("DefaultFormat", func(t *testing.T) {
+		w := serve(router, "GET", "/quotes/export", "")
+		var quotes []data.Quote
+		if err := json.Unmarshal(w.Body.Bytes(), &quotes); err != nil || len(quotes) != len(original) {
+			t.Errorf("Expected a JSON array of %d quotes; got %s", len(original), w.Body.String())
+		}
+	})
+
+	t.Run("UnknownFormat", func(t *testing.T) {
+		if w := serve(router, "GET", "/quotes/export?format=xml", ""); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status BadRequest; got %v", w.Code)
+		}
+	})
+}
+
+func TestQuoteImport(t *testing.T) {
+	body := `text,author,tags
+"Life is what happens when you're   busy making other plans.",JOHN LENNON,
+Stay hungry; stay foolish.,Stewart Brand,startup;Life
+Stay hungry;  stay foolish.,stewart brand,
+,Nobody,
+Words.,Someone,bad tag
+`
+
+	t.Run("DryRun", func(t *testing.T) {
+		service := data.NewQuoteService()
+		router := newQuoteRouter(service)
+
+		w, report := importQuotes(t, router, "format=csv&dry_run=true", "", body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status OK; got %v: %s", w.Code, w.Body.String())
+		}
+		if !report.DryRun || report.Rows != 5 {
+			t.Errorf("Expected a dry run over 5 rows; got %+v", report)
+		}
+		if len(report.Created) != 1 || report.Created[0].ID != "" || !reflect.DeepEqual(report.Created[0].Tags, []string{"startup", "life"}) {
+			t.Errorf("Expected one new quote without an ID; got %+v", report.Created)
+		}
+		wantDuplicates := []data.ImportDuplicate{
+			{Row: 1, Text: "Life is what happens when you're   busy making other plans.", Author: "JOHN LENNON", ExistingID: "1"},
+			{Row: 3, Text: "Stay hungry;  stay foolish.", Author: "stewart brand"},
+		}
+		if !reflect.DeepEqual(report.Duplicates, wantDuplicates) {
+			t.Errorf("Expected duplicates %+v; got %+v", wantDuplicates, report.Duplicates)
+		}
+		if len(report.Errors) != 2 || report.Errors[0].Row != 4 || report.Errors[0].Field != "text" ||
+			report.Errors[1].Row != 5 || report.Errors[1].Field != "tags" {
+			t.Errorf("Expected errors for rows 4 (text) and 5 (tags); got %+v", report.Errors)
+		}
+
+		if quotes, _ := service.List(); len(quotes) != 10 {
+			t.Errorf("Expected a dry run to store nothing; got %d quotes", len(quotes))
+		}
+	})
+
+	t.Run("Import", func(t *testing.T) {
+		service := data.NewQuoteService()
+		router := newQuoteRouter(service)
+
+		_, report := importQuotes(t, router, "", "text/csv", body)
+		if report.DryRun || len(report.Created) != 1 || report.Created[0].ID != "11" {
+			t.Errorf("Expected one quote created as ID 11; got %+v", report)
+		}
+		if quotes, _ := service.List(); len(quotes) != 11 {
+			t.Errorf("Expected 11 quotes after the import; got %d", len(quotes))
+		}
+
+		// Importing again only finds duplicates
+		_, report = importQuotes(t, router, "", "text/csv", body)
+		if len(report.Created) != 0 || len(report.Duplicates) != 3 || report.Duplicates[1].ExistingID != "11" {
+			t.Errorf("Expected a repeat import to only find duplicates; got %+v", report)
+		}
+	})
+
+	t.Run("FailedSave", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "store")
+		os.Mkdir(dir, 0o700)
+		store, err := data.NewFileQuoteStore(filepath.Join(dir, "quotes.json"), data.DefaultQuotes())
+		if err != nil {
+			t.Fatalf("Failed to create store: %v", err)
+		}
+		service := data.NewQuoteServiceWithStore(store)
+		// Saving fails once the directory is gone
+		os.RemoveAll(dir)
+
+		csv := "text,author\nFirst.,Someone\nSecond.,Someone\n"
+		if w, _ := importQuotes(t, newQuoteRouter(service), "format=csv", "", csv); w.Code != http.StatusInternalServerError {
+			t.Errorf("Expected status InternalServerError; got %v", w.Code)
+		}
+		if quotes, _ := service.List(); len(quotes) != 10 {
+			t.Errorf("Expected a failed import to store nothing; got %d quotes", len(quotes))
+		}
+	})
+
+	t.Run("HandWrittenYAML", func(t *testing.T) {
+		yaml := `# Quotes to add
+---
+- text: Simplicity is prerequisite for reliability.
+  author: 'Edsger W. Dijkstra'
+  tags:
+    - software
+    - "craft"
+-
+  author: Grace Hopper
+  text: "The most dangerous phrase in the language is \"we've always done it this way.\""
+  tags: []
+  language: en-us
+  translations:
+    es: "La frase más peligrosa del idioma es \"siempre lo hemos hecho así\"."
+    'pt_br': A frase mais perigosa do idioma é "sempre fizemos assim".
+`
+		router := newQuoteRouter(data.NewQuoteService())
+		w, report := importQuotes(t, router, "", "application/x-yaml", yaml)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status OK; got %v: %s", w.Code, w.Body.String())
+		}
+		want := []data.Quote{
+			{ID: "11", Text: "Simplicity is prerequisite for reliability.", Author: "Edsger W. Dijkstra", Tags: []string{"software", "craft"}, Language: "en"},
+			{ID: "12", Text: `The most dangerous phrase in the language is "we've always done it this way."`, Author: "Grace Hopper", Tags: []string{},
+				Language: "en-US", Translations: map[string]string{
+					"es":    `La frase más peligrosa del idioma es "siempre lo hemos hecho así".`,
+					"pt-BR": `A frase mais perigosa do idioma é "sempre fizemos assim".`,
+				}},
+		}
+		if !reflect.DeepEqual(report.Created, want) {
+			t.Errorf("Expected %+v; got %+v", want, report.Created)
+		}
+	})
+
+	t.Run("Malformed", func(t *testing.T) {
+		router := newQuoteRouter(data.NewQuoteService())
+		tests := []struct {
+			name, query, contentType, body, message string
+		}{
+			{"NoFormat", "", "text/plain", "Words.", "format"},
+			{"UnknownFormat", "format=xml", "", "<quotes/>", "format"},
+			{"BadDryRun", "format=json&dry_run=maybe", "", "[]", "dry_run"},
+			{"JSONObject", "", "application/json", `{"text": "Words."}`, "array of quotes"},
+			{"CSVMissingColumn", "format=csv", "", "text\nWords.\n", "missing"},
+			{"CSVRagged", "format=csv", "", "text,author\nWords.\n", "line 2"},
+			{"YAMLUnknownKey", "format=yaml", "", "- text: Words.\n  by: Someone\n", "line 2: unknown key"},
+			{"YAMLBlockScalar", "format=yaml", "", "- text: |\n    Words.\n", "line 1: block scalars"},
+			{"YAMLMapping", "format=yaml", "", "quotes:\n  - text: Words.\n", "line 1"},
+			{"YAMLFlowTranslations", "format=yaml", "", "- text: Words.\n  translations: {es: Palabras.}\n", "line 2: translations"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				w, _ := importQuotes(t, router, tt.query, tt.contentType, tt.body)
+				if w.Code != http.StatusBadRequest {
+					t.Fatalf("Expected status BadRequest; got %v", w.Code)
+				}
+				assertErrorCode(t, w.Body.Bytes(), response.CodeInvalidParameter)
+				if !strings.Contains(w.Body.String(), tt.message) {
+					t.Errorf("Expected the error to mention %q; got %s", tt.message, w.Body.String())
+				}
+			})
+		}
+	})
+}
+
+func TestQuoteYAMLEscapes(t *testing.T) {
+	t.Run("Decode", func(t *testing.T) {
+		yaml := `- text: "a\/b \e\0 \N\_\L\P \x41\u00e9\U0001F600 \"q\" \\ \	tab\ "
+  author: Someone
+  tags: ["a\\", "b, c"]
+`
+		quotes, err := data.DecodeQuotes(strings.NewReader(yaml), data.QuoteFormatYAML)
+		if err != nil {
+			t.Fatalf("Failed to decode YAML escapes: %v", err)
+		}
+		want := "a/b \x1b\x00 \u0085\u00a0\u2028\u2029 Aé😀 \"q\" \\ \ttab "
+		if len(quotes) != 1 || quotes[0].Text != want {
+			t.Errorf("Expected text %q; got %+v", want, quotes)
+		}
+		if len(quotes) == 1 && !reflect.DeepEqual(quotes[0].Tags, []string{"a\\", "b, c"}) {
+			t.Errorf("Expected tags split outside quotes; got %q", quotes[0].Tags)
+		}
+	})
+
+	t.Run("InvalidEscapes", func(t *testing.T) {
+		for _, scalar := range []string{`"\q"`, `"\x4"`, `"\uD800"`, `"\U00110000"`, `"a"b"`, `"open`, `"trailing\"`} {
+			yaml := "- text: " + scalar + "\n  author: Someone\n"
+			if _, err := data.DecodeQuotes(strings.NewReader(yaml), data.QuoteFormatYAML); err == nil {
+				t.Errorf("%s: expected an error", scalar)
+			}
+		}
+	})
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		quotes := []data.Quote{{
+			Text:   "bell\a nul\x00 del\x7f next\u0085 sep\u2028 bom\ufeff \"\\/ tab\t crlf\r\n 😀",
+			Author: "Someone",
+			Tags:   []string{"a\"b", `c\`},
+		}}
+		var buf strings.Builder
+		if err := data.EncodeQuotes(&buf, data.QuoteFormatYAML, quotes); err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := data.DecodeQuotes(strings.NewReader(buf.String()), data.QuoteFormatYAML)
+		if err != nil {
+			t.Fatalf("Failed to decode the export: %v\n%s", err, buf.String())
+		}
+		if !reflect.DeepEqual(decoded, quotes) {
+			t.Errorf("Round trip changed the quotes:\n got %q\nwant %q", decoded, quotes)
+		}
+	})
+
+	t.Run("InvalidUTF8", func(t *testing.T) {
+		var buf strings.Builder
+		if err := data.EncodeQuotes(&buf, data.QuoteFormatYAML, []data.Quote{{Text: "caf\xe9", Author: "Someone"}}); err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := data.DecodeQuotes(strings.NewReader(buf.String()), data.QuoteFormatYAML)
+		if err != nil {
+			t.Fatalf("Failed to decode the export: %v\n%s", err, buf.String())
+		}
+		if len(decoded) != 1 || decoded[0].Text != "caf\uFFFD" {
+			t.Errorf("Expected invalid UTF-8 to be exported as U+FFFD; got %+v", decoded)
+		}
+	})
+}
+
+func TestQuoteCSVFormulas(t *testing.T) {
+	quotes := []data.Quote{{
+		Text:         "=HYPERLINK(\"https://example.com\")",
+		Author:       "@someone",
+		Tags:         []string{"math"},
+		Language:     "en",
+		Translations: map[string]string{"es": "+34 dice", "fr": "'=déjà quoted"},
+	}}
+	var buf strings.Builder
+	if err := data.EncodeQuotes(&buf, data.QuoteFormatCSV, quotes); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(strings.NewReader(buf.String())).ReadAll()
+	if err != nil || len(records) != 2 {
+		t.Fatalf("Expected a header and one record; got %q (%v)", records, err)
+	}
+	want := []string{"", `'=HYPERLINK("https://example.com")`, "'@someone", "math", "en", "'+34 dice", "''=déjà quoted"}
+	if !reflect.DeepEqual(records[1], want) {
+		t.Errorf("Expected formula cells to be escaped as %q; got %q", want, records[1])
+	}
+
+	decoded, err := data.DecodeQuotes(strings.NewReader(buf.String()), data.QuoteFormatCSV)
+	if err != nil {
+		t.Fatalf("Failed to decode the export: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, quotes) {
+		t.Errorf("Round trip changed the quotes:\n got %+v\nwant %+v", decoded, quotes)
+	}
+
+	// A ' that does not guard a formula is kept
+	decoded, err = data.DecodeQuotes(strings.NewReader("text,author\n'Tis true,Someone\n"), data.QuoteFormatCSV)
+	if err != nil || len(decoded) != 1 || decoded[0].Text != "'Tis true" {
+		t.Errorf("Expected a leading ' to be kept; got %+v (%v)", decoded, err)
+	}
+}
+
+func TestQuoteCSVHeaderCase(t *testing.T) {
+	quotes, err := data.DecodeQuotes(strings.NewReader("TEXT,Author,TEXT_es,Text_FR\nWords.,Someone,Palabras.,Mots.\n"), data.QuoteFormatCSV)
+	if err != nil {
+		t.Fatalf("Failed to decode CSV: %v", err)
+	}
+	want := []data.Quote{{Text: "Words.", Author: "Someone", Translations: map[string]string{"es": "Palabras.", "FR": "Mots."}}}
+	if !reflect.DeepEqual(quotes, want) {
+		t.Errorf("Expected %+v; got %+v", want, quotes)
+	}
+}
+
+func TestLoadQuotes(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	quotes, err := data.LoadQuotes(write("quotes.yml", "- text: \" Words. \"\n  author: Someone\n  tags: [Misc]\n"))
+	if err != nil {
+		t.Fatalf("Failed to load quotes: %v", err)
+	}
+	want := []data.Quote{{Text: "Words.", Author: "Someone", Tags: []string{"misc"}, Language: data.DefaultQuoteLanguage}}
+	if !reflect.DeepEqual(quotes, want) {
+		t.Errorf("Expected validated quotes %+v; got %+v", want, quotes)
+	}
+
+	// The loaded quotes replace the built-in ones in a new store
+	service := data.NewQuoteServiceWithStore(data.NewMemoryQuoteStore(quotes))
+	if got, _ := service.Get("1"); got.Text != "Words." {
+		t.Errorf("Expected the loaded quote as ID 1; got %+v", got)
+	}
+
+	for name, content := range map[string]string{
+		"invalid.json": `[{"text": "Words.", "author": ""}]`,
+		"quotes.txt":   "Words. - Someone",
+	} {
+		if _, err := data.LoadQuotes(write(name, content)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if _, err := data.LoadQuotes(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
@@ -0,0 +1,176 @@
+package test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/jorge2751/GoAPI/internal/api/data"
+	"github.com/jorge2751/GoAPI/internal/api/response"
+)
+
+// getLocalizedQuote requests a random quote from router with the given query and
+// Accept-Language header
+func getLocalizedQuote(t *testing.T, router http.Handler, query, acceptLanguage string) (*httptest.ResponseRecorder, data.Quote) {
+	t.Helper()
+
+	w := serve(router, "GET", "/quotes/random?"+query, "", "Accept-Language", acceptLanguage)
+
+	var body response.Envelope[data.Quote]
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("Failed to parse response body: %v", err)
+		}
+	}
+	return w, body.Data
+}
+
+// singleQuoteRouter serves a quote collection holding only q
+func singleQuoteRouter(t *testing.T, q data.Quote) http.Handler {
+	t.Helper()
+
+	q, err := q.Validate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newQuoteRouter(data.NewQuoteServiceWithStore(data.NewMemoryQuoteStore([]data.Quote{q})))
+}
+
+func TestNormalizeLanguage(t *testing.T) {
+	tests := map[string]string{
+		"es":           "es",
+		"EN-us":        "en-US",
+		"pt_br":        "pt-BR",
+		"zh-hant-tw":   "zh-Hant-TW",
+		"es-419":       "es-419",
+		" de ":         "de",
+		"":             "",
+		"e":            "",
+		"english":      "",
+		"en--us":       "",
+		"en-":          "",
+		"12-us":        "",
+		"en-toolongxx": "",
+	}
+	for tag, want := range tests {
+		if got := data.NormalizeLanguage(tag); got != want {
+			t.Errorf("NormalizeLanguage(%q): expected %q; got %q", tag, want, got)
+		}
+	}
+}
+
+func TestRandomQuoteLanguage(t *testing.T) {
+	service := data.NewQuoteService()
+	router := newQuoteRouter(service)
+
+	t.Run("NoPreference", func(t *testing.T) {
+		w, quote := getLocalizedQuote(t, router, "", "")
+		if quote.Language != "en" || quote.Translations["es"] == "" {
+			t.Errorf("Expected the stored quote with its translations; got %+v", quote)
+		}
+		if got := w.Header().Get("Content-Language"); got != "en" {
+			t.Errorf("Expected Content-Language en; got %q", got)
+		}
+		if got := w.Header().Values("Vary"); !slices.Contains(got, "Accept-Language") {
+			t.Errorf("Expected Vary to include Accept-Language; got %v", got)
+		}
+	})
+
+	tests := []struct {
+		name, query, acceptLanguage, want string
+	}{
+		{"Query", "lang=es", "", "es"},
+		{"QueryOverridesHeader", "lang=en", "es", "en"},
+		{"QueryList", "lang=fr,es", "", "es"},
+		{"Header", "", "es", "es"},
+		{"HeaderQuality", "", "fr-CH, fr;q=0.9, es;q=0.8, en;q=0.7", "es"},
+		{"HeaderRegion", "", "es-MX", "es"},
+		{"HeaderRefused", "", "es;q=0, en", "en"},
+		{"HeaderWildcard", "", "fr, *;q=0.5", "en"},
+		{"HeaderMalformed", "", "???, es;q=oops, en;q=0.5", "en"},
+		{"Unavailable", "lang=de", "", "en"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, quote := getLocalizedQuote(t, router, tt.query, tt.acceptLanguage)
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status OK; got %v: %s", w.Code, w.Body.String())
+			}
+			if quote.Language != tt.want || w.Header().Get("Content-Language") != tt.want {
+				t.Errorf("Expected the quote in %s; got %q with Content-Language %q",
+					tt.want, quote.Language, w.Header().Get("Content-Language"))
+			}
+			if quote.Translations != nil {
+				t.Errorf("Expected no other translations; got %v", quote.Translations)
+			}
+			original, _ := service.Get(quote.ID)
+			if tt.want == "es" && quote.Text != original.Translations["es"] {
+				t.Errorf("Expected the Spanish text; got %q", quote.Text)
+			}
+		})
+	}
+
+	t.Run("Fallback", func(t *testing.T) {
+		// A regional quote matches a request for its language
+		router := singleQuoteRouter(t, data.Quote{Text: "Más vale tarde que nunca.", Author: "Refrán", Language: "es-AR"})
+		if _, quote := getLocalizedQuote(t, router, "", "es"); quote.Language != "es-AR" {
+			t.Errorf("Expected es to match es-AR; got %q", quote.Language)
+		}
+
+		// Without a match English is preferred over the quote's own language
+		router = singleQuoteRouter(t, data.Quote{Text: "Más vale tarde que nunca.", Author: "Refrán", Language: "es",
+			Translations: map[string]string{"en": "Better late than never."}})
+		if _, quote := getLocalizedQuote(t, router, "", "de"); quote.Language != "en" || quote.Text != "Better late than never." {
+			t.Errorf("Expected the English translation; got %+v", quote)
+		}
+
+		// And the quote's own language is the last resort
+		router = singleQuoteRouter(t, data.Quote{Text: "Mieux vaut tard que jamais.", Author: "Proverbe", Language: "fr"})
+		if w, quote := getLocalizedQuote(t, router, "", "de"); quote.Language != "fr" || w.Header().Get("Content-Language") != "fr" {
+			t.Errorf("Expected the quote in French; got %+v", quote)
+		}
+	})
+
+	t.Run("InvalidQuery", func(t *testing.T) {
+		w, _ := getLocalizedQuote(t, router, "lang=spanish", "")
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("Expected status BadRequest; got %v", w.Code)
+		}
+		assertErrorCode(t, w.Body.Bytes(), response.CodeInvalidParameter)
+	})
+}
+
+func TestQuoteTranslationValidation(t *testing.T) {
+	service := data.NewQuoteService()
+
+	created, err := service.Create(data.Quote{Text: "Words.", Author: "Someone", Language: "ES_mx",
+		Translations: map[string]string{"EN": " Words in English. "}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Language != "es-MX" || created.Translations["en"] != "Words in English." {
+		t.Errorf("Expected normalized languages and text; got %+v", created)
+	}
+
+	tests := []struct {
+		name  string
+		quote data.Quote
+	}{
+		{"BadLanguage", data.Quote{Language: "spanish"}},
+		{"BadTranslationLanguage", data.Quote{Translations: map[string]string{"english": "Words."}}},
+		{"OwnLanguage", data.Quote{Language: "es", Translations: map[string]string{"ES": "Palabras."}}},
+		{"RepeatedLanguage", data.Quote{Translations: map[string]string{"es": "Palabras.", "ES": "Palabras."}}},
+		{"EmptyTranslation", data.Quote{Translations: map[string]string{"es": "  "}}},
+	}
+	for _, tt := range tests {
+		tt.quote.Text, tt.quote.Author = "Words.", "Someone"
+		_, err := service.Create(tt.quote)
+		var validationErr *data.ValidationError
+		if !errors.As(err, &validationErr) {
+			t.Errorf("%s: expected a validation error; got %v", tt.name, err)
+		}
+	}
+}
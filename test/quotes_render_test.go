@@ -0,0 +1,135 @@
+package test
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/jorge2751/GoAPI/internal/api/data"
+	"github.com/jorge2751/GoAPI/internal/api/response"
+)
+
+func TestQuoteRenderNegotiation(t *testing.T) {
+	router := singleQuoteRouter(t, data.Quote{Text: "Words.", Author: "Someone"})
+
+	tests := []struct {
+		name, query, accept, contentType string
+	}{
+		{"Default", "", "", "application/json"},
+		{"AnyType", "", "*/*", "application/json"},
+		{"Unsupported", "", "application/pdf", "application/json"},
+		{"Text", "", "text/plain", "text/plain; charset=utf-8"},
+		{"TextWildcard", "", "text/*", "text/plain; charset=utf-8"},
+		{"HTML", "", "text/html,application/xhtml+xml,*/*;q=0.8", "text/html; charset=utf-8"},
+		{"SVG", "", "image/svg+xml", "image/svg+xml"},
+		{"Markdown", "", "text/markdown", "text/markdown; charset=utf-8"},
+		{"Quality", "", "text/html;q=0.5, text/markdown", "text/markdown; charset=utf-8"},
+		{"QueryOverridesAccept", "format=text", "text/html", "text/plain; charset=utf-8"},
+		{"QueryJSON", "format=json", "image/svg+xml", "application/json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(router, "GET", "/quotes/random?"+tt.query, "", "Accept", tt.accept)
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status OK; got %v: %s", w.Code, w.Body.String())
+			}
+			if got := w.Header().Get("Content-Type"); got != tt.contentType {
+				t.Errorf("Expected Content-Type %q; got %q", tt.contentType, got)
+			}
+			if vary := w.Header().Values("Vary"); !slices.Contains(vary, "Accept") || !slices.Contains(vary, "Accept-Language") {
+				t.Errorf("Expected Vary to include Accept and Accept-Language; got %v", vary)
+			}
+		})
+	}
+
+	for _, query := range []string{"format=pdf", "theme=neon", "width=10", "width=wide"} {
+		w := serve(router, "GET", "/quotes/random?"+query, "")
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status BadRequest; got %v", query, w.Code)
+			continue
+		}
+		assertErrorCode(t, w.Body.Bytes(), response.CodeInvalidParameter)
+	}
+}
+
+func TestQuoteRenderFormats(t *testing.T) {
+	long := data.Quote{
+		Text:   `Many of life's <failures> are people who did not realize how close they were to success when they gave up & "quit".`,
+		Author: "Thomas A. Edison",
+	}
+	router := singleQuoteRouter(t, long)
+
+	t.Run("Text", func(t *testing.T) {
+		body := serve(router, "GET", "/quotes/random?format=text", "").Body.String()
+		lines := strings.Split(strings.TrimSuffix(body, "\n"), "\n")
+		if len(lines) < 3 || !strings.HasPrefix(lines[0], `"Many of life's <failures>`) || lines[len(lines)-1] != "    — Thomas A. Edison" {
+			t.Errorf("Expected the wrapped quote and its author; got %q", body)
+		}
+		for _, line := range lines {
+			if utf8.RuneCountInString(line) > 72 {
+				t.Errorf("Expected lines of at most 72 characters; got %q", line)
+			}
+		}
+	})
+
+	t.Run("HTML", func(t *testing.T) {
+		body := serve(router, "GET", "/quotes/random?format=html&theme=dark", "").Body.String()
+		for _, want := range []string{`<figure class="quote" lang="en"`, "&lt;failures&gt;", "&amp;", "#0d1117", "— Thomas A. Edison</figcaption>"} {
+			if !strings.Contains(body, want) {
+				t.Errorf("Expected the HTML to contain %q; got %s", want, body)
+			}
+		}
+		if strings.Contains(body, "<failures>") {
+			t.Error("Expected the quote text to be escaped")
+		}
+	})
+
+	t.Run("SVG", func(t *testing.T) {
+		svgLines := func(query string) int {
+			t.Helper()
+			body := serve(router, "GET", "/quotes/random?"+query, "").Body.String()
+			// The card must be well-formed XML
+			decoder := xml.NewDecoder(strings.NewReader(body))
+			for {
+				if _, err := decoder.Token(); err == io.EOF {
+					break
+				} else if err != nil {
+					t.Fatalf("Expected well-formed SVG; got %v in %s", err, body)
+				}
+			}
+			if !strings.Contains(body, `<svg xmlns="http://www.w3.org/2000/svg"`) {
+				t.Errorf("Expected an SVG document; got %s", body)
+			}
+			return strings.Count(body, "<tspan")
+		}
+
+		wide, narrow := svgLines("format=svg&width=1200"), svgLines("format=svg&width=300")
+		if wide < 1 || narrow <= wide {
+			t.Errorf("Expected a narrower card to wrap into more lines; got %d at 1200px and %d at 300px", wide, narrow)
+		}
+		if body := serve(router, "GET", "/quotes/random?format=svg&theme=sepia", "").Body.String(); !strings.Contains(body, `fill="#f4ecd8"`) {
+			t.Errorf("Expected the sepia background; got %s", body)
+		}
+	})
+
+	t.Run("Markdown", func(t *testing.T) {
+		router := singleQuoteRouter(t, data.Quote{Text: "- Not a *list*\n1. Nor [this]", Author: "Some_one"})
+		body := serve(router, "GET", "/quotes/random?format=markdown", "").Body.String()
+		want := "> \\- Not a \\*list\\*\n> 1\\. Nor \\[this\\]\n>\n> — *Some\\_one*\n"
+		if body != want {
+			t.Errorf("Expected Markdown %q; got %q", want, body)
+		}
+	})
+
+	t.Run("Localized", func(t *testing.T) {
+		router := singleQuoteRouter(t, data.Quote{Text: "Words.", Author: "Someone", Translations: map[string]string{"es": "Palabras."}})
+		w := serve(router, "GET", "/quotes/random?format=text&lang=es", "")
+		if w.Header().Get("Content-Language") != "es" || w.Body.String() != "\"Palabras.\"\n    — Someone\n" {
+			t.Errorf("Expected the quote rendered in Spanish; got %q", w.Body.String())
+		}
+	})
+}
@@ -2,10 +2,20 @@ package test
 
 import (
 	"encoding/json"
+	"errors"
+	"math/rand/v2"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/jorge2751/GoAPI/internal/api/data"
+	"github.com/jorge2751/GoAPI/internal/api/response"
 	"github.com/jorge2751/GoAPI/internal/api/routes"
 )
 
@@ -16,9 +26,18 @@ func TestRandomQuoteHandler(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	// Seed the service so the quote is known in advance
+	newService := func() *data.QuoteService {
+		return data.NewQuoteServiceWithSource(data.NewMemoryQuoteStore(data.DefaultQuotes()), rand.NewPCG(1, 2))
+	}
+	expected, err := newService().GetRandomQuote()
+	if err != nil {
+		t.Fatal(err)
+	}
+
 	// Create a ResponseRecorder to record the response
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(routes.RandomQuoteHandler)
+	handler := http.HandlerFunc(routes.NewQuoteAPI(newService()).RandomHandler)
 
 	// Call the handler with our request and response recorder
 	handler.ServeHTTP(rr, req)
@@ -37,21 +56,484 @@ func TestRandomQuoteHandler(t *testing.T) {
 	}
 
 	// Parse the response
-	var response routes.QuoteResponse
-	err = json.NewDecoder(rr.Body).Decode(&response)
+	var body response.Envelope[data.Quote]
+	err = json.NewDecoder(rr.Body).Decode(&body)
 	if err != nil {
 		t.Errorf("Failed to decode response body: %v", err)
 	}
 
 	// Verify the response structure
-	if response.Status != "success" {
+	if body.Status != "success" {
 		t.Errorf("handler returned unexpected status: got %v want %v",
-			response.Status, "success")
+			body.Status, "success")
+	}
+
+	// Verify that we got the seeded quote
+	if body.Data.Text == "" || !reflect.DeepEqual(body.Data, expected) {
+		t.Errorf("handler returned unexpected quote: got %+v want %+v",
+			body.Data, expected)
+	}
+}
+
+func TestRandomQuoteSource(t *testing.T) {
+	newService := func(seed uint64) *data.QuoteService {
+		return data.NewQuoteServiceWithSource(data.NewMemoryQuoteStore(data.DefaultQuotes()), rand.NewPCG(seed, seed))
+	}
+
+	// The same seed gives the same sequence
+	first, second := newService(7), newService(7)
+	seen := make(map[string]bool)
+	for range 20 {
+		a, _ := first.GetRandomQuote()
+		b, _ := second.GetRandomQuote()
+		if a.ID != b.ID {
+			t.Fatalf("Expected equal seeds to pick the same quotes; got %s and %s", a.ID, b.ID)
+		}
+		seen[a.ID] = true
+	}
+	if len(seen) < 2 {
+		t.Errorf("Expected a random sequence to vary; got only %v", seen)
+	}
+
+	// A shared service is safe for concurrent use (run with -race)
+	shared := data.NewQuoteService()
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				if _, err := shared.GetRandomQuote(); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// newQuoteRouter serves the API with service as its quote collection
+func newQuoteRouter(service *data.QuoteService) http.Handler {
+	return newTestRouter(routes.Services{Quotes: routes.NewQuoteAPI(service)})
+}
+
+// decodeQuote parses a quote response envelope
+func decodeQuote(t *testing.T, w *httptest.ResponseRecorder) data.Quote {
+	t.Helper()
+
+	var body response.Envelope[data.Quote]
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to parse response body: %v", err)
+	}
+	return body.Data
+}
+
+func TestQuoteCRUD(t *testing.T) {
+	router := newQuoteRouter(data.NewQuoteService())
+
+	// Seed quotes are numbered from 1
+	w := serve(router, "GET", "/quotes/2", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status OK; got %v: %s", w.Code, w.Body.String())
+	}
+	if quote := decodeQuote(t, w); quote.ID != "2" || quote.Author != "Walt Disney" {
+		t.Errorf("Unexpected seed quote: %+v", quote)
+	}
+
+	w = serve(router, "POST", "/quotes", `{"text": "  Simplicity is prerequisite for reliability. ", "author": "Edsger W. Dijkstra"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status Created; got %v: %s", w.Code, w.Body.String())
+	}
+	created := decodeQuote(t, w)
+	if created.ID != "11" || created.Text != "Simplicity is prerequisite for reliability." {
+		t.Errorf("Unexpected created quote: %+v", created)
+	}
+	if got := w.Header().Get("Location"); got != "/quotes/11" {
+		t.Errorf("Expected Location header /quotes/11; got %q", got)
+	}
+
+	w = serve(router, "PUT", "/quotes/11", `{"text": "Simplicity is a great virtue.", "author": "Edsger W. Dijkstra"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status OK; got %v: %s", w.Code, w.Body.String())
+	}
+	if updated := decodeQuote(t, w); updated.ID != "11" || updated.Text != "Simplicity is a great virtue." {
+		t.Errorf("Unexpected updated quote: %+v", updated)
+	}
+
+	if w = serve(router, "DELETE", "/quotes/11", ""); w.Code != http.StatusNoContent {
+		t.Errorf("Expected status NoContent; got %v", w.Code)
+	}
+	for _, method := range []string{"GET", "DELETE"} {
+		w = serve(router, method, "/quotes/11", "")
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s after delete: expected status NotFound; got %v", method, w.Code)
+		}
+		assertErrorCode(t, w.Body.Bytes(), response.CodeNotFound)
+	}
+	w = serve(router, "PUT", "/quotes/11", `{"text": "Gone", "author": "Nobody"}`)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("PUT after delete: expected status NotFound; got %v", w.Code)
+	}
+
+	// IDs are not reused
+	w = serve(router, "POST", "/quotes", `{"text": "Less is more.", "author": "Ludwig Mies van der Rohe"}`)
+	if created := decodeQuote(t, w); created.ID != "12" {
+		t.Errorf("Expected the next ID to be 12; got %q", created.ID)
+	}
+}
+
+func TestQuoteValidation(t *testing.T) {
+	router := newQuoteRouter(data.NewQuoteService())
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"EmptyText", `{"text": "   ", "author": "Someone"}`},
+		{"MissingAuthor", `{"text": "Words."}`},
+		{"LongText", `{"text": "` + strings.Repeat("a", data.MaxQuoteTextLength+1) + `", "author": "Someone"}`},
+		{"LongAuthor", `{"text": "Words.", "author": "` + strings.Repeat("é", data.MaxQuoteAuthorLength+1) + `"}`},
+		{"UnknownField", `{"text": "Words.", "author": "Someone", "id": "5"}`},
+		{"NotJSON", `text=Words.`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, req := range []struct{ method, path string }{{"POST", "/quotes"}, {"PUT", "/quotes/1"}} {
+				w := serve(router, req.method, req.path, tt.body)
+				if w.Code != http.StatusBadRequest {
+					t.Errorf("%s: expected status BadRequest; got %v: %s", req.method, w.Code, w.Body.String())
+				}
+				assertErrorCode(t, w.Body.Bytes(), response.CodeInvalidParameter)
+			}
+		})
+	}
+
+	// Limits count characters, not bytes
+	body := `{"text": "Words.", "author": "` + strings.Repeat("é", data.MaxQuoteAuthorLength) + `"}`
+	if w := serve(router, "POST", "/quotes", body); w.Code != http.StatusCreated {
+		t.Errorf("Expected an author at the limit to be accepted; got %v: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestFileQuoteStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quotes.json")
+
+	store, err := data.NewQuoteStore(data.QuoteStoreFile, path, data.DefaultQuotes())
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	service := data.NewQuoteServiceWithStore(store)
+	created, err := service.Create(data.Quote{Text: "Stay hungry, stay foolish.", Author: "Stewart Brand"})
+	if err != nil {
+		t.Fatalf("Failed to create quote: %v", err)
+	}
+	if err := service.Delete("1"); err != nil {
+		t.Fatalf("Failed to delete quote: %v", err)
 	}
 
-	// Verify that we got a quote with text and author
-	if response.Data.Text == "" || response.Data.Author == "" {
-		t.Errorf("Quote is missing text or author. Text: %s, Author: %s",
-			response.Data.Text, response.Data.Author)
+	// A reopened store sees the changes and keeps numbering after them
+	reopened, err := data.NewFileQuoteStore(path, nil)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	quotes, _ := reopened.List()
+	if len(quotes) != len(data.DefaultQuotes()) {
+		t.Errorf("Expected %d quotes after reopening; got %d", len(data.DefaultQuotes()), len(quotes))
+	}
+	if got, err := reopened.Get(created.ID); err != nil || !reflect.DeepEqual(got, created) {
+		t.Errorf("Expected %+v after reopening; got %+v (%v)", created, got, err)
+	}
+	if _, err := reopened.Get("1"); !errors.Is(err, data.ErrQuoteNotFound) {
+		t.Errorf("Expected deleted quote to stay deleted; got %v", err)
+	}
+	next, _ := reopened.Create(data.Quote{Text: "Next.", Author: "Someone"})
+	if next.ID != "12" {
+		t.Errorf("Expected the next ID to be 12; got %q", next.ID)
+	}
+
+	t.Run("Corrupt", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "quotes.json")
+		os.WriteFile(path, []byte("{not json"), 0o600)
+		if _, err := data.NewFileQuoteStore(path, data.DefaultQuotes()); err == nil {
+			t.Error("Expected an error for a corrupt store file")
+		}
+	})
+
+	t.Run("UnknownKind", func(t *testing.T) {
+		if _, err := data.NewQuoteStore("sqlite", path, nil); err == nil {
+			t.Error("Expected an error for an unknown store kind")
+		}
+	})
+}
+
+func TestRandomQuoteEmptyStore(t *testing.T) {
+	service := data.NewQuoteServiceWithStore(data.NewMemoryQuoteStore(nil))
+	if _, err := service.GetRandomQuote(); !errors.Is(err, data.ErrQuoteNotFound) {
+		t.Errorf("Expected ErrQuoteNotFound from an empty store; got %v", err)
+	}
+}
+
+// listQuotes requests GET /quotes from router with query and returns the recorder and page
+func listQuotes(t *testing.T, router http.Handler, query string) (*httptest.ResponseRecorder, data.QuotePage) {
+	t.Helper()
+
+	w := serve(router, "GET", "/quotes?"+query, "")
+
+	var body response.Envelope[data.QuotePage]
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("Failed to parse response body: %v", err)
+		}
+	}
+	return w, body.Data
+}
+
+// quoteIDs returns the IDs of quotes in order
+func quoteIDs(quotes []data.Quote) []string {
+	ids := make([]string, len(quotes))
+	for i, q := range quotes {
+		ids[i] = q.ID
+	}
+	return ids
+}
+
+func TestQuoteList(t *testing.T) {
+	t.Run("Pagination", func(t *testing.T) {
+		router := newQuoteRouter(data.NewQuoteService())
+
+		var ids []string
+		query := "limit=4"
+		for pages := 0; ; pages++ {
+			if pages > 3 {
+				t.Fatal("Pagination did not end")
+			}
+			w, page := listQuotes(t, router, query)
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status OK; got %v: %s", w.Code, w.Body.String())
+			}
+			if page.Total != 10 || w.Header().Get("X-Total-Count") != "10" {
+				t.Errorf("Expected a total of 10; got %d (header %q)", page.Total, w.Header().Get("X-Total-Count"))
+			}
+			ids = append(ids, quoteIDs(page.Quotes)...)
+
+			link := w.Header().Get("Link")
+			if page.NextCursor == "" {
+				if link != "" {
+					t.Errorf("Expected no Link header on the last page; got %q", link)
+				}
+				break
+			}
+			want := `</quotes?cursor=` + page.NextCursor + `&limit=4>; rel="next"`
+			if link != want {
+				t.Errorf("Expected Link %q; got %q", want, link)
+			}
+			query = "limit=4&cursor=" + page.NextCursor
+		}
+
+		want := []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10"}
+		if !reflect.DeepEqual(ids, want) {
+			t.Errorf("Expected IDs %v across pages; got %v", want, ids)
+		}
+	})
+
+	t.Run("StableCursor", func(t *testing.T) {
+		service := data.NewQuoteService()
+		router := newQuoteRouter(service)
+
+		_, first := listQuotes(t, router, "limit=3")
+		// Removing a quote already seen does not make the next page skip one
+		service.Delete("2")
+		_, second := listQuotes(t, router, "limit=3&cursor="+first.NextCursor)
+		if got := quoteIDs(second.Quotes); !reflect.DeepEqual(got, []string{"4", "5", "6"}) {
+			t.Errorf("Expected IDs [4 5 6] after the cursor; got %v", got)
+		}
+	})
+
+	t.Run("Filters", func(t *testing.T) {
+		router := newQuoteRouter(data.NewQuoteService())
+
+		tests := []struct {
+			query string
+			ids   []string
+		}{
+			{"author=walt+disney", []string{"2"}},
+			{"q=SUCCESS", []string{"8", "9"}},
+			{"tag=life", []string{"1", "3", "5", "6", "7"}},
+			{"tag=life&tag=Time", []string{"3"}},
+			{"tag=life&q=busy", []string{"1", "6"}},
+			{"author=Nobody", []string{}},
+			{"sort=-id&limit=3", []string{"10", "9", "8"}},
+			{"sort=author&limit=3", []string{"10", "5", "4"}},
+			{"sort=-text&tag=success", []string{"9", "8"}},
+		}
+		for _, tt := range tests {
+			w, page := listQuotes(t, router, tt.query)
+			if w.Code != http.StatusOK {
+				t.Errorf("%s: expected status OK; got %v: %s", tt.query, w.Code, w.Body.String())
+				continue
+			}
+			if got := quoteIDs(page.Quotes); !reflect.DeepEqual(got, tt.ids) {
+				t.Errorf("%s: expected IDs %v; got %v", tt.query, tt.ids, got)
+			}
+		}
+	})
+
+	t.Run("SortedPages", func(t *testing.T) {
+		router := newQuoteRouter(data.NewQuoteService())
+
+		_, first := listQuotes(t, router, "sort=-author&limit=5")
+		_, second := listQuotes(t, router, "sort=-author&limit=5&cursor="+first.NextCursor)
+		_, all := listQuotes(t, router, "sort=-author")
+		got := append(quoteIDs(first.Quotes), quoteIDs(second.Quotes)...)
+		if !reflect.DeepEqual(got, quoteIDs(all.Quotes)) {
+			t.Errorf("Expected pages to match the full listing %v; got %v", quoteIDs(all.Quotes), got)
+		}
+		if second.NextCursor != "" {
+			t.Errorf("Expected the second page to be the last; got cursor %q", second.NextCursor)
+		}
+	})
+
+	t.Run("InvalidParameters", func(t *testing.T) {
+		router := newQuoteRouter(data.NewQuoteService())
+		_, page := listQuotes(t, router, "limit=2")
+
+		for _, query := range []string{
+			"sort=rating",
+			"limit=0",
+			"limit=101",
+			"limit=ten",
+			"cursor=not-a-cursor",
+			"sort=author&cursor=" + page.NextCursor,
+		} {
+			w, _ := listQuotes(t, router, query)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("%s: expected status BadRequest; got %v", query, w.Code)
+				continue
+			}
+			assertErrorCode(t, w.Body.Bytes(), response.CodeInvalidParameter)
+		}
+	})
+}
+
+func TestQuoteTags(t *testing.T) {
+	router := newQuoteRouter(data.NewQuoteService())
+
+	w := serve(router, "POST", "/quotes", `{"text": "Make it work, make it right, make it fast.", "author": "Kent Beck", "tags": [" Software", "craft", "software"]}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status Created; got %v: %s", w.Code, w.Body.String())
+	}
+	if quote := decodeQuote(t, w); !reflect.DeepEqual(quote.Tags, []string{"software", "craft"}) {
+		t.Errorf("Expected normalized tags [software craft]; got %v", quote.Tags)
+	}
+
+	for _, tags := range []string{`["two words"]`, `[""]`, `["` + strings.Repeat("a", data.MaxQuoteTagLength+1) + `"]`} {
+		w = serve(router, "POST", "/quotes", `{"text": "Words.", "author": "Someone", "tags": `+tags+`}`)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status BadRequest; got %v", tags, w.Code)
+		}
 	}
 }
+
+// getQuoteOfTheDay requests the quote of the day from api at now and returns the recorder and body
+func getQuoteOfTheDay(t *testing.T, api *routes.QuoteAPI, now time.Time, query string) (*httptest.ResponseRecorder, routes.DailyQuote) {
+	t.Helper()
+
+	api.Now = func() time.Time { return now }
+	w := serve(newTestRouter(routes.Services{Quotes: api}), "GET", "/quotes/today?"+query, "")
+
+	var body response.Envelope[routes.DailyQuote]
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("Failed to parse response body: %v", err)
+		}
+	}
+	return w, body.Data
+}
+
+func TestQuoteOfTheDay(t *testing.T) {
+	morning := time.Date(2026, 10, 17, 8, 0, 0, 0, time.UTC)
+
+	t.Run("SameAllDay", func(t *testing.T) {
+		// Separate services stand in for separate server instances
+		_, first := getQuoteOfTheDay(t, routes.NewQuoteAPI(data.NewQuoteService()), morning, "")
+		_, second := getQuoteOfTheDay(t, routes.NewQuoteAPI(data.NewQuoteService()), morning.Add(15*time.Hour), "")
+		if first.Quote.ID == "" || !reflect.DeepEqual(first, second) {
+			t.Errorf("Expected the same quote all day; got %+v and %+v", first, second)
+		}
+		if first.Date != "2026-10-17" || first.Timezone != "UTC" {
+			t.Errorf("Expected date 2026-10-17 in UTC; got %s in %s", first.Date, first.Timezone)
+		}
+	})
+
+	t.Run("CacheUntilMidnight", func(t *testing.T) {
+		w, _ := getQuoteOfTheDay(t, routes.NewQuoteAPI(data.NewQuoteService()), morning, "")
+		if got := w.Header().Get("Cache-Control"); got != "public, max-age=57600" {
+			t.Errorf("Expected caching for the 16 hours to midnight; got %q", got)
+		}
+		if got := w.Header().Get("Expires"); got != "Sun, 18 Oct 2026 00:00:00 GMT" {
+			t.Errorf("Expected Expires at midnight; got %q", got)
+		}
+	})
+
+	t.Run("TimeZone", func(t *testing.T) {
+		// 23:30 UTC is already the next day in Tokyo, which reaches midnight 15.5 hours later
+		lateEvening := time.Date(2026, 10, 17, 23, 30, 0, 0, time.UTC)
+		api := routes.NewQuoteAPI(data.NewQuoteService())
+
+		w, tokyo := getQuoteOfTheDay(t, api, lateEvening, "tz=Asia/Tokyo")
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status OK; got %v: %s", w.Code, w.Body.String())
+		}
+		if tokyo.Date != "2026-10-18" || tokyo.Timezone != "Asia/Tokyo" {
+			t.Errorf("Expected date 2026-10-18 in Asia/Tokyo; got %s in %s", tokyo.Date, tokyo.Timezone)
+		}
+		if got := w.Header().Get("Cache-Control"); got != "public, max-age=55800" {
+			t.Errorf("Expected caching until Tokyo midnight; got %q", got)
+		}
+
+		_, utcNextDay := getQuoteOfTheDay(t, api, time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC), "")
+		if tokyo.Quote.ID != utcNextDay.Quote.ID {
+			t.Errorf("Expected the quote to depend only on the date; got %s and %s", tokyo.Quote.ID, utcNextDay.Quote.ID)
+		}
+	})
+
+	t.Run("NoRepeat", func(t *testing.T) {
+		service := data.NewQuoteService()
+		quotes, _ := service.List()
+		n := len(quotes)
+
+		// Cycles start on days that are multiples of the collection size since 1970-01-01
+		start := time.Unix(int64(2000*n)*86400, 0).UTC()
+		seen := make(map[string]bool)
+		for i := range n {
+			quote, err := service.QuoteOfTheDay(start.AddDate(0, 0, i), true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if seen[quote.ID] {
+				t.Errorf("Quote %s repeated within a cycle on day %d", quote.ID, i)
+			}
+			seen[quote.ID] = true
+		}
+
+		api := routes.NewQuoteAPI(service)
+		_, first := getQuoteOfTheDay(t, api, start, "no_repeat=true")
+		want, _ := service.QuoteOfTheDay(start, true)
+		if first.Quote.ID != want.ID {
+			t.Errorf("Expected no_repeat=true to use the cycle; got %s, want %s", first.Quote.ID, want.ID)
+		}
+	})
+
+	t.Run("InvalidParameters", func(t *testing.T) {
+		api := routes.NewQuoteAPI(data.NewQuoteService())
+		for _, query := range []string{"tz=Mars/Olympus", "tz=Local", "no_repeat=maybe"} {
+			w, _ := getQuoteOfTheDay(t, api, morning, query)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("%s: expected status BadRequest; got %v", query, w.Code)
+				continue
+			}
+			assertErrorCode(t, w.Body.Bytes(), response.CodeInvalidParameter)
+		}
+	})
+}
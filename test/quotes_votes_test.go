@@ -0,0 +1,393 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jorge2751/GoAPI/internal/api/data"
+	"github.com/jorge2751/GoAPI/internal/api/response"
+	"github.com/jorge2751/GoAPI/internal/api/routes"
+)
+
+// testVoters are the API client voters newVoteRouter accepts; each votes with its name plus "-token"
+var testVoters = []string{"alice", "bob", "carol"}
+
+// newVoteRouter serves the API with service as its quote collection and testVoters as API clients
+func newVoteRouter(service *data.QuoteService) http.Handler {
+	api := routes.NewQuoteAPI(service)
+	api.VoterTokens = map[string]string{}
+	for _, voter := range testVoters {
+		api.VoterTokens[voter+"-token"] = voter
+	}
+	return newTestRouter(routes.Services{Quotes: api})
+}
+
+// voterAuth returns the Authorization header value for voter's API token, or "" for no voter
+func voterAuth(voter string) string {
+	if voter == "" {
+		return ""
+	}
+	return "Bearer " + voter + "-token"
+}
+
+// vote casts voter's vote on quote id and returns the resulting rating
+func vote(t *testing.T, router http.Handler, voter, id string, value int) data.QuoteRating {
+	t.Helper()
+
+	w := serve(router, "PUT", "/quotes/"+id+"/vote", fmt.Sprintf(`{"vote": %d}`, value), "Authorization", voterAuth(voter))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status OK for the vote; got %v: %s", w.Code, w.Body.String())
+	}
+	return decodeRating(t, w)
+}
+
+// decodeRating parses a rating response envelope
+func decodeRating(t *testing.T, w *httptest.ResponseRecorder) data.QuoteRating {
+	t.Helper()
+
+	var body response.Envelope[data.QuoteRating]
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to parse response body: %v", err)
+	}
+	return body.Data
+}
+
+func TestQuoteVotes(t *testing.T) {
+	router := newVoteRouter(data.NewQuoteService())
+
+	vote(t, router, "alice", "3", 1)
+	vote(t, router, "bob", "3", 1)
+	rating := vote(t, router, "carol", "3", -1)
+	if rating.Score != 1 || rating.Upvotes != 2 || rating.Downvotes != 1 || rating.Vote != -1 {
+		t.Errorf("Unexpected rating after three votes: %+v", rating)
+	}
+
+	// Voting again replaces the voter's vote
+	rating = vote(t, router, "carol", "3", 1)
+	if rating.Score != 3 || rating.Downvotes != 0 || rating.Vote != 1 {
+		t.Errorf("Expected carol's vote to be replaced; got %+v", rating)
+	}
+	rating = vote(t, router, "bob", "3", 0)
+	if rating.Score != 2 || rating.Upvotes != 2 || rating.Vote != 0 {
+		t.Errorf("Expected bob's vote to be withdrawn; got %+v", rating)
+	}
+
+	w := serve(router, "GET", "/quotes/3/vote", "", "Authorization", voterAuth("alice"))
+	if rating := decodeRating(t, w); rating.Score != 2 || rating.Vote != 1 {
+		t.Errorf("Expected alice to see her vote in the rating; got %+v", rating)
+	}
+
+	t.Run("Invalid", func(t *testing.T) {
+		tests := []struct {
+			name, voter, path, body string
+			status                  int
+		}{
+			{"OutOfRange", "alice", "/quotes/3/vote", `{"vote": 2}`, http.StatusBadRequest},
+			{"MissingVote", "alice", "/quotes/3/vote", `{}`, http.StatusBadRequest},
+			{"NotJSON", "alice", "/quotes/3/vote", `up`, http.StatusBadRequest},
+			{"UnknownToken", "mallory", "/quotes/3/vote", `{"vote": 1}`, http.StatusUnauthorized},
+			{"UnknownQuote", "alice", "/quotes/99/vote", `{"vote": 1}`, http.StatusNotFound},
+		}
+		for _, tt := range tests {
+			w := serve(router, "PUT", tt.path, tt.body, "Authorization", voterAuth(tt.voter))
+			if w.Code != tt.status {
+				t.Errorf("%s: expected status %d; got %v: %s", tt.name, tt.status, w.Code, w.Body.String())
+			}
+		}
+	})
+
+	t.Run("AnonymousCookie", func(t *testing.T) {
+		// A vote without the cookie is refused but sets the cookie
+		w := serve(router, "PUT", "/quotes/5/vote", `{"vote": 1}`)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected status Unauthorized for a vote without a cookie; got %v", w.Code)
+		}
+		cookies := w.Result().Cookies()
+		if len(cookies) != 1 || cookies[0].Name != routes.VoterCookie || !cookies[0].HttpOnly {
+			t.Fatalf("Expected an HttpOnly %s cookie for an anonymous voter; got %v", routes.VoterCookie, cookies)
+		}
+
+		// Repeating it with the cookie counts the vote, and the cookie keeps identifying the voter
+		w = serve(router, "PUT", "/quotes/5/vote", `{"vote": 1}`, "Cookie", routes.VoterCookie+"="+cookies[0].Value)
+		if rating := decodeRating(t, w); w.Code != http.StatusOK || rating.Upvotes != 1 || rating.Vote != 1 {
+			t.Errorf("Expected the vote to count with the cookie; got %v: %+v", w.Code, rating)
+		}
+		if len(w.Result().Cookies()) != 0 {
+			t.Error("Expected no new cookie for a known voter")
+		}
+		if rating := decodeRating(t, serve(router, "GET", "/quotes/5/vote", "", "Cookie", routes.VoterCookie+"="+cookies[0].Value)); rating.Vote != 1 {
+			t.Errorf("Expected the cookie to identify the same voter; got %+v", rating)
+		}
+
+		// Reading a rating sets the cookie without refusing the request
+		w = serve(router, "GET", "/quotes/5/vote", "")
+		if w.Code != http.StatusOK || len(w.Result().Cookies()) != 1 {
+			t.Errorf("Expected status OK and a cookie for a rating; got %v with %v", w.Code, w.Result().Cookies())
+		}
+
+		// Cookieless requests and made-up cookies never count as voters
+		for range 50 {
+			serve(router, "PUT", "/quotes/5/vote", `{"vote": 1}`)
+		}
+		forged := routes.VoterCookie + "=anon-1234.abcd"
+		if w := serve(router, "PUT", "/quotes/5/vote", `{"vote": 1}`, "Cookie", forged); w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected status Unauthorized for a forged cookie; got %v", w.Code)
+		}
+		if rating := decodeRating(t, serve(router, "GET", "/quotes/5/vote", "")); rating.Upvotes != 1 {
+			t.Errorf("Expected only the cookie holder's vote to count; got %+v", rating)
+		}
+	})
+
+	t.Run("VoterLimit", func(t *testing.T) {
+		service := data.NewQuoteService()
+		service.MaxVoters = 2
+		router := newVoteRouter(service)
+
+		vote(t, router, "alice", "1", 1)
+		vote(t, router, "bob", "2", 1)
+		// Known voters can keep voting
+		vote(t, router, "alice", "2", -1)
+		if w := serve(router, "PUT", "/quotes/1/vote", `{"vote": 1}`, "Authorization", voterAuth("carol")); w.Code != http.StatusConflict {
+			t.Errorf("Expected status Conflict for a voter past the limit; got %v", w.Code)
+		}
+		if w := serve(router, "PUT", "/quotes/1/favorite", "", "Authorization", voterAuth("carol")); w.Code != http.StatusConflict {
+			t.Errorf("Expected status Conflict for a favorite past the limit; got %v", w.Code)
+		}
+
+		// Withdrawing bob's only vote frees a place
+		vote(t, router, "bob", "2", 0)
+		vote(t, router, "carol", "1", 1)
+	})
+
+	t.Run("DeletedQuote", func(t *testing.T) {
+		if w := serve(router, "DELETE", "/quotes/3", ""); w.Code != http.StatusNoContent {
+			t.Fatalf("Expected status NoContent; got %v", w.Code)
+		}
+		if w := serve(router, "GET", "/quotes/3/vote", "", "Authorization", voterAuth("alice")); w.Code != http.StatusNotFound {
+			t.Errorf("Expected the deleted quote's rating to be gone; got %v", w.Code)
+		}
+	})
+}
+
+func TestQuoteFavorites(t *testing.T) {
+	router := newVoteRouter(data.NewQuoteService())
+
+	for _, id := range []string{"4", "2", "7"} {
+		if w := serve(router, "PUT", "/quotes/"+id+"/favorite", "", "Authorization", voterAuth("alice")); w.Code != http.StatusOK {
+			t.Fatalf("Expected status OK; got %v: %s", w.Code, w.Body.String())
+		}
+	}
+	// Marking twice counts once
+	w := serve(router, "PUT", "/quotes/4/favorite", "", "Authorization", voterAuth("alice"))
+	if rating := decodeRating(t, w); rating.Favorites != 1 || !rating.Favorite {
+		t.Errorf("Expected one favorite by alice; got %+v", rating)
+	}
+	w = serve(router, "DELETE", "/quotes/7/favorite", "", "Authorization", voterAuth("alice"))
+	if rating := decodeRating(t, w); rating.Favorites != 0 || rating.Favorite {
+		t.Errorf("Expected the favorite to be removed; got %+v", rating)
+	}
+	serve(router, "PUT", "/quotes/9/favorite", "", "Authorization", voterAuth("bob"))
+
+	favorites := func(voter string) []string {
+		var body response.Envelope[[]data.Quote]
+		json.Unmarshal(serve(router, "GET", "/quotes/favorites", "", "Authorization", voterAuth(voter)).Body.Bytes(), &body)
+		return quoteIDs(body.Data)
+	}
+	if got := favorites("alice"); strings.Join(got, ",") != "2,4" {
+		t.Errorf("Expected alice's favorites [2 4]; got %v", got)
+	}
+	if got := favorites("bob"); strings.Join(got, ",") != "9" {
+		t.Errorf("Expected bob's favorites [9]; got %v", got)
+	}
+	if got := favorites("carol"); len(got) != 0 {
+		t.Errorf("Expected no favorites for carol; got %v", got)
+	}
+	if w := serve(router, "PUT", "/quotes/99/favorite", "", "Authorization", voterAuth("alice")); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status NotFound for an unknown quote; got %v", w.Code)
+	}
+}
+
+func TestTopQuotes(t *testing.T) {
+	router := newVoteRouter(data.NewQuoteService())
+
+	vote(t, router, "alice", "6", 1)
+	vote(t, router, "bob", "6", 1)
+	vote(t, router, "alice", "2", 1)
+	vote(t, router, "alice", "8", 1)
+	serve(router, "PUT", "/quotes/8/favorite", "", "Authorization", voterAuth("bob"))
+	vote(t, router, "alice", "1", -1)
+
+	top := func(query string) []string {
+		t.Helper()
+		w := serve(router, "GET", "/quotes/top"+query, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status OK; got %v: %s", w.Code, w.Body.String())
+		}
+		var body response.Envelope[[]data.RatedQuote]
+		json.Unmarshal(w.Body.Bytes(), &body)
+		ids := make([]string, len(body.Data))
+		for i, rated := range body.Data {
+			ids[i] = rated.Quote.ID
+		}
+		return ids
+	}
+
+	// Score first, then favorites; unrated quotes are left out
+	if got := top(""); strings.Join(got, ",") != "6,8,2,1" {
+		t.Errorf("Expected top quotes [6 8 2 1]; got %v", got)
+	}
+	if got := top("?limit=2"); strings.Join(got, ",") != "6,8" {
+		t.Errorf("Expected top 2 quotes [6 8]; got %v", got)
+	}
+	if w := serve(router, "GET", "/quotes/top?limit=0", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status BadRequest for limit=0; got %v", w.Code)
+	}
+}
+
+func TestWeightedRandomQuote(t *testing.T) {
+	service := data.NewQuoteServiceWithSource(data.NewMemoryQuoteStore(data.DefaultQuotes()), rand.NewPCG(3, 4))
+	for i := range 99 {
+		service.Vote("3", fmt.Sprintf("voter-%d", i), 1)
+	}
+	for i := range 9 {
+		service.Vote("5", fmt.Sprintf("voter-%d", i), -1)
+	}
+
+	// Quote 3 weighs 100 against 8 unvoted quotes at 1 and quote 5 at 0.1
+	counts := map[string]int{}
+	for range 2000 {
+		quote, err := service.GetWeightedRandomQuote()
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[quote.ID]++
+	}
+	if counts["3"] < 1750 || counts["3"] > 1950 {
+		t.Errorf("Expected quote 3 about 92%% of the time; got %d of 2000", counts["3"])
+	}
+	if counts["5"] > 20 {
+		t.Errorf("Expected the downvoted quote rarely; got %d of 2000", counts["5"])
+	}
+
+	router := newVoteRouter(service)
+	if w := serve(router, "GET", "/quotes/random?weighted=true", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected status OK; got %v", w.Code)
+	}
+	if w := serve(router, "GET", "/quotes/random?weighted=maybe", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status BadRequest; got %v", w.Code)
+	}
+}
+
+func TestConcurrentQuoteVotes(t *testing.T) {
+	service := data.NewQuoteService()
+
+	var wg sync.WaitGroup
+	for i := range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			voter := fmt.Sprintf("voter-%d", i)
+			service.Vote("1", voter, 1)
+			service.SetFavorite("1", voter, true)
+			service.GetWeightedRandomQuote()
+			service.Top(5)
+		}()
+	}
+	wg.Wait()
+
+	rating, err := service.Rating("1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rating.Upvotes != 50 || rating.Favorites != 50 {
+		t.Errorf("Expected 50 upvotes and favorites; got %+v", rating)
+	}
+}
+
+// pausingQuoteStore is a quote store whose next Get, once armed, waits for
+// release after reading the quote, and which reports each Delete on deleted
+type pausingQuoteStore struct {
+	data.QuoteStore
+	entered chan struct{}
+	release chan struct{}
+	deleted chan struct{}
+	armed   atomic.Bool
+}
+
+func (s *pausingQuoteStore) Get(id string) (data.Quote, error) {
+	q, err := s.QuoteStore.Get(id)
+	if s.armed.CompareAndSwap(true, false) {
+		s.entered <- struct{}{}
+		<-s.release
+	}
+	return q, err
+}
+
+func (s *pausingQuoteStore) Delete(id string) error {
+	err := s.QuoteStore.Delete(id)
+	s.deleted <- struct{}{}
+	return err
+}
+
+func TestQuoteVotesRacingDelete(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		mark func(service *data.QuoteService, id string) error
+	}{
+		{"Vote", func(service *data.QuoteService, id string) error {
+			_, err := service.Vote(id, "alice", 1)
+			return err
+		}},
+		{"Favorite", func(service *data.QuoteService, id string) error {
+			_, err := service.SetFavorite(id, "alice", true)
+			return err
+		}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &pausingQuoteStore{
+				QuoteStore: data.NewMemoryQuoteStore(nil),
+				entered:    make(chan struct{}),
+				release:    make(chan struct{}),
+				deleted:    make(chan struct{}, 1),
+			}
+			service := data.NewQuoteServiceWithStore(store)
+			service.MaxVoters = 1
+			q, err := service.Create(data.Quote{Text: "Words.", Author: "Someone"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The quote is deleted after the vote has found it but before it is recorded
+			store.armed.Store(true)
+			marked := make(chan error, 1)
+			go func() { marked <- tt.mark(service, q.ID) }()
+			<-store.entered
+			deletedQuote := make(chan error, 1)
+			go func() { deletedQuote <- service.Delete(q.ID) }()
+			<-store.deleted
+			close(store.release)
+			if err := <-marked; err != nil {
+				t.Fatal(err)
+			}
+			if err := <-deletedQuote; err != nil {
+				t.Fatal(err)
+			}
+
+			// A vote kept for the deleted quote would still hold alice's place
+			other, err := service.Create(data.Quote{Text: "Other words.", Author: "Someone"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := service.Vote(other.ID, "bob", 1); err != nil {
+				t.Errorf("Expected the deleted quote to release its voters; got %v", err)
+			}
+		})
+	}
+}
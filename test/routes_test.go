@@ -1,11 +1,19 @@
 package test
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
+	"github.com/jorge2751/GoAPI/internal/api/data"
+	"github.com/jorge2751/GoAPI/internal/api/middleware"
+	"github.com/jorge2751/GoAPI/internal/api/requestid"
+	"github.com/jorge2751/GoAPI/internal/api/response"
 	"github.com/jorge2751/GoAPI/internal/api/routes"
 )
 
@@ -37,16 +45,230 @@ func TestHelloWorldHandler(t *testing.T) {
 	}
 
 	// Check the response body
-	var response routes.Response
-	err = json.NewDecoder(rr.Body).Decode(&response)
+	var body response.Envelope[routes.Response]
+	err = json.NewDecoder(rr.Body).Decode(&body)
 	if err != nil {
 		t.Errorf("Failed to decode response body: %v", err)
 	}
 
 	// Verify the message field
 	expectedMessage := "Hello World from Go API!"
-	if response.Message != expectedMessage {
+	if body.Status != "success" {
+		t.Errorf("handler returned unexpected status: got %v want %v",
+			body.Status, "success")
+	}
+	if body.Data.Message != expectedMessage {
 		t.Errorf("handler returned unexpected message: got %v want %v",
-			response.Message, expectedMessage)
+			body.Data.Message, expectedMessage)
+	}
+}
+
+// newTestRouter registers every route on a fresh mux the same way main does, so
+// tests exercise the real route table and middleware fallbacks. Services left nil
+// get defaults: the built-in quotes and art, and weather, subscriptions and streams
+// backed by services.Weather or an unconfigured weather service.
+func newTestRouter(services routes.Services) http.Handler {
+	if services.Quotes == nil {
+		services.Quotes = routes.NewQuoteAPI(data.NewQuoteService())
+	}
+	if services.Art == nil {
+		services.Art = routes.NewArtAPI(data.NewArtService())
+	}
+	if services.Weather == nil {
+		services.Weather = routes.NewWeatherService("")
+	}
+	if services.Subscriptions == nil {
+		services.Subscriptions = routes.NewSubscriptionManager(services.Weather)
+	}
+	if services.Streamer == nil {
+		services.Streamer = routes.NewWeatherStreamer(services.Weather)
+	}
+
+	mux := http.NewServeMux()
+	routes.RegisterRoutes(mux, middleware.NewChain(), services)
+	return routes.FallbackHandler(mux, middleware.NewChain())
+}
+
+// serve sends a request to handler and returns the recorder. headers holds header
+// name and value pairs; pairs with an empty value are left out.
+func serve(handler http.Handler, method, target, body string, headers ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	for i := 0; i+1 < len(headers); i += 2 {
+		if headers[i+1] != "" {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestMethodRouting(t *testing.T) {
+	server := httptest.NewServer(newTestRouter(routes.Services{}))
+	defer server.Close()
+
+	do := func(method, path string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(method, server.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := server.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	t.Run("GetAllowed", func(t *testing.T) {
+		resp := do("GET", "/hello_world")
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Expected status OK; got %v", resp.StatusCode)
+		}
+	})
+
+	t.Run("OtherMethodsRejected", func(t *testing.T) {
+		// /quotes/random shares its path shape with /quotes/{id}, which serves PUT and DELETE
+		tests := []struct {
+			path, allow string
+		}{
+			{"/hello_world", "GET, HEAD, OPTIONS"},
+			{"/quotes/random", "GET, HEAD, OPTIONS"},
+			{"/quotes/top", "GET, HEAD, OPTIONS"},
+		}
+		for _, tt := range tests {
+			for _, method := range []string{"POST", "PUT", "DELETE", "PATCH"} {
+				resp := do(method, tt.path)
+				body, _ := io.ReadAll(resp.Body)
+				resp.Body.Close()
+
+				if resp.StatusCode != http.StatusMethodNotAllowed {
+					t.Errorf("%s %s: expected status 405; got %v", method, tt.path, resp.StatusCode)
+				}
+				if allow := resp.Header.Get("Allow"); allow != tt.allow {
+					t.Errorf("%s %s: expected Allow %q; got %q", method, tt.path, tt.allow, allow)
+				}
+				assertErrorCode(t, body, response.CodeMethodNotAllowed)
+			}
+		}
+	})
+
+	t.Run("Head", func(t *testing.T) {
+		resp := do("HEAD", "/art/m-pattern")
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Expected status OK; got %v", resp.StatusCode)
+		}
+		if len(body) != 0 {
+			t.Errorf("Expected empty body for HEAD; got %d bytes", len(body))
+		}
+		if contentType := resp.Header.Get("Content-Type"); contentType != "text/plain; charset=utf-8" {
+			t.Errorf("Expected GET content type on HEAD; got %q", contentType)
+		}
+	})
+
+	t.Run("Options", func(t *testing.T) {
+		resp := do("OPTIONS", "/weather")
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusNoContent {
+			t.Errorf("Expected status 204; got %v", resp.StatusCode)
+		}
+		if allow := resp.Header.Get("Allow"); allow != "GET, HEAD, OPTIONS" {
+			t.Errorf("Expected Allow 'GET, HEAD, OPTIONS'; got %q", allow)
+		}
+	})
+
+	t.Run("UnknownPath", func(t *testing.T) {
+		resp := do("GET", "/nope")
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("Expected status 404; got %v", resp.StatusCode)
+		}
+		assertErrorCode(t, body, response.CodeNotFound)
+	})
+}
+
+func TestFixedPathsBesideWildcards(t *testing.T) {
+	router := newTestRouter(routes.Services{})
+
+	// Each fixed path also matches a /quotes/{id} wildcard, which must not serve it
+	tests := []struct {
+		method, path, allow string
+	}{
+		{"PUT", "/quotes/random", "GET, HEAD, OPTIONS"},
+		{"DELETE", "/quotes/random", "GET, HEAD, OPTIONS"},
+		{"POST", "/quotes/random", "GET, HEAD, OPTIONS"},
+		{"DELETE", "/quotes/top", "GET, HEAD, OPTIONS"},
+		{"PUT", "/quotes/favorites", "GET, HEAD, OPTIONS"},
+		{"PUT", "/quotes/export", "GET, HEAD, OPTIONS"},
+		{"GET", "/quotes/import", "OPTIONS, POST"},
+		{"DELETE", "/quotes/import", "OPTIONS, POST"},
+	}
+	for _, tt := range tests {
+		w := serve(router, tt.method, tt.path, "")
+		if w.Code != http.StatusMethodNotAllowed {
+			t.Errorf("%s %s: expected status 405; got %v: %s", tt.method, tt.path, w.Code, w.Body.String())
+			continue
+		}
+		if allow := w.Header().Get("Allow"); allow != tt.allow {
+			t.Errorf("%s %s: expected Allow %q; got %q", tt.method, tt.path, tt.allow, allow)
+		}
+		assertErrorCode(t, w.Body.Bytes(), response.CodeMethodNotAllowed)
+
+		if allow := serve(router, "OPTIONS", tt.path, "").Header().Get("Allow"); allow != tt.allow {
+			t.Errorf("OPTIONS %s: expected Allow %q to match the 405; got %q", tt.path, tt.allow, allow)
+		}
+	}
+
+	// Other IDs still reach the wildcard routes
+	if w := serve(router, "DELETE", "/quotes/3", ""); w.Code != http.StatusNoContent {
+		t.Errorf("Expected DELETE /quotes/3 to delete the quote; got %v", w.Code)
+	}
+	if allow := serve(router, "PATCH", "/quotes/3", "").Header().Get("Allow"); allow != "DELETE, GET, HEAD, OPTIONS, PUT" {
+		t.Errorf("Expected the wildcard route's Allow header; got %q", allow)
+	}
+}
+
+func TestFallbackMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	chain := middleware.NewChain(middleware.NewLoggingMiddleware(newTestLogger(&buf)), middleware.RecoveryMiddleware)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /hello_world", routes.HelloWorldHandler)
+	router := routes.FallbackHandler(mux, chain)
+
+	for _, tt := range []struct {
+		method, path string
+		status       int
+	}{
+		{"GET", "/nowhere", http.StatusNotFound},
+		{"DELETE", "/hello_world", http.StatusMethodNotAllowed},
+	} {
+		buf.Reset()
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		req.Header.Set(requestid.Header, "fallback-req")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != tt.status {
+			t.Errorf("%s %s: expected status %v; got %v", tt.method, tt.path, tt.status, w.Code)
+		}
+		if !bytes.Contains(w.Body.Bytes(), []byte(`"request_id":"fallback-req"`)) {
+			t.Errorf("%s %s: expected request ID in error body; got %s", tt.method, tt.path, w.Body.String())
+		}
+		if log := buf.String(); !strings.Contains(log, fmt.Sprintf(`"status":%d`, tt.status)) || !strings.Contains(log, `"request_id":"fallback-req"`) {
+			t.Errorf("%s %s: expected the response to be logged; got %s", tt.method, tt.path, log)
+		}
+	}
+}
+
+func TestDebugRoutesDisabled(t *testing.T) {
+	if w := serve(newTestRouter(routes.Services{}), "GET", "/debug/weather", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status NotFound without Debug; got %v", w.Code)
 	}
 }
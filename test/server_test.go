@@ -0,0 +1,114 @@
+package test
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jorge2751/GoAPI/internal/api/server"
+)
+
+func TestLoadConfig(t *testing.T) {
+	env := map[string]string{
+		"PORT":             "9000",
+		"READ_TIMEOUT":     "7s",
+		"WRITE_TIMEOUT":    "1m",
+		"SHUTDOWN_TIMEOUT": "3s",
+	}
+	cfg, err := server.LoadConfig(func(key string) string { return env[key] })
+	if err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+
+	if cfg.Port != "9000" {
+		t.Errorf("Expected port 9000; got %s", cfg.Port)
+	}
+	if cfg.ReadTimeout != 7*time.Second {
+		t.Errorf("Expected read timeout 7s; got %v", cfg.ReadTimeout)
+	}
+	if cfg.WriteTimeout != time.Minute {
+		t.Errorf("Expected write timeout 1m; got %v", cfg.WriteTimeout)
+	}
+	if cfg.ShutdownTimeout != 3*time.Second {
+		t.Errorf("Expected shutdown timeout 3s; got %v", cfg.ShutdownTimeout)
+	}
+
+	// Unset values keep their defaults
+	if cfg.IdleTimeout != server.DefaultConfig().IdleTimeout {
+		t.Errorf("Expected default idle timeout; got %v", cfg.IdleTimeout)
+	}
+
+	// Invalid durations are rejected
+	_, err = server.LoadConfig(func(key string) string {
+		if key == "IDLE_TIMEOUT" {
+			return "soon"
+		}
+		return ""
+	})
+	if err == nil {
+		t.Error("Expected error for invalid IDLE_TIMEOUT")
+	}
+}
+
+func TestServeGracefulShutdown(t *testing.T) {
+	started := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		io.WriteString(w, "done")
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := server.New(server.DefaultConfig(), handler)
+	var hookCalled atomic.Bool
+	srv.RegisterOnShutdown(func() { hookCalled.Store(true) })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.Serve(ctx, srv, ln, 2*time.Second)
+	}()
+
+	// Start a slow request, then trigger shutdown while it is in flight
+	type result struct {
+		body string
+		err  error
+	}
+	results := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String())
+		if err != nil {
+			results <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		results <- result{body: string(body), err: err}
+	}()
+
+	<-started
+	cancel()
+
+	res := <-results
+	if res.err != nil {
+		t.Fatalf("In-flight request failed during shutdown: %v", res.err)
+	}
+	if res.body != "done" {
+		t.Errorf("Expected body 'done'; got %q", res.body)
+	}
+
+	if err := <-serveErr; err != nil {
+		t.Errorf("Serve returned error: %v", err)
+	}
+	if !hookCalled.Load() {
+		t.Error("Expected shutdown hook to be called")
+	}
+}
@@ -0,0 +1,179 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jorge2751/GoAPI/internal/api/routes"
+)
+
+// startCountingWeatherAPIServer starts the mock WeatherAPI and counts the requests it receives
+func startCountingWeatherAPIServer(calls *atomic.Int32) *httptest.Server {
+	handler := mockWeatherAPIHandler()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		handler(w, r)
+	}))
+}
+
+// newCachedWeatherService returns a WeatherService pointed at server with the given cache
+func newCachedWeatherService(server *httptest.Server, cache *routes.WeatherCache) *routes.WeatherService {
+	weatherService := routes.NewWeatherServiceWithProviders(newMockWeatherAPIProvider(server, "test-api-key"))
+	weatherService.Cache = cache
+	return weatherService
+}
+
+// getWeather calls the weather handler for city and returns the recorder
+func getWeather(weatherService *routes.WeatherService, city string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/weather?city="+strings.ReplaceAll(city, " ", "+"), nil)
+	w := httptest.NewRecorder()
+	weatherService.WeatherHandler(w, req)
+	return w
+}
+
+func TestWeatherCache(t *testing.T) {
+	t.Run("NormalizedKey", func(t *testing.T) {
+		var calls atomic.Int32
+		server := startCountingWeatherAPIServer(&calls)
+		defer server.Close()
+
+		weatherService := newCachedWeatherService(server, routes.NewWeatherCache(time.Minute, time.Minute, 10))
+
+		first := getWeather(weatherService, "London")
+		if first.Code != http.StatusOK {
+			t.Fatalf("Expected status OK; got %v", first.Code)
+		}
+		if got := first.Header().Get("X-Cache"); got != "MISS" {
+			t.Errorf("Expected X-Cache MISS on first request; got %q", got)
+		}
+
+		for _, city := range []string{"london", "  LONDON ", "London"} {
+			w := getWeather(weatherService, city)
+			if got := w.Header().Get("X-Cache"); got != "HIT" {
+				t.Errorf("%q: expected X-Cache HIT; got %q", city, got)
+			}
+			if w.Header().Get("Age") == "" {
+				t.Errorf("%q: expected Age header", city)
+			}
+			if cc := w.Header().Get("Cache-Control"); !strings.Contains(cc, "max-age=") {
+				t.Errorf("%q: expected max-age in Cache-Control; got %q", city, cc)
+			}
+		}
+
+		if got := calls.Load(); got != 1 {
+			t.Errorf("Expected 1 upstream call; got %d", got)
+		}
+	})
+
+	t.Run("StaleWhileRevalidate", func(t *testing.T) {
+		var calls atomic.Int32
+		server := startCountingWeatherAPIServer(&calls)
+		defer server.Close()
+
+		weatherService := newCachedWeatherService(server, routes.NewWeatherCache(50*time.Millisecond, time.Minute, 10))
+
+		getWeather(weatherService, "Paris")
+		time.Sleep(80 * time.Millisecond)
+
+		stale := getWeather(weatherService, "Paris")
+		if stale.Code != http.StatusOK {
+			t.Fatalf("Expected stale response to be served; got %v", stale.Code)
+		}
+		if got := stale.Header().Get("X-Cache"); got != "STALE" {
+			t.Errorf("Expected X-Cache STALE; got %q", got)
+		}
+
+		// The background refresh replaces the entry
+		deadline := time.Now().Add(2 * time.Second)
+		for calls.Load() < 2 && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+		if got := calls.Load(); got != 2 {
+			t.Fatalf("Expected background revalidation; got %d upstream calls", got)
+		}
+
+		deadline = time.Now().Add(2 * time.Second)
+		for getWeather(weatherService, "Paris").Header().Get("X-Cache") != "HIT" {
+			if time.Now().After(deadline) {
+				t.Fatal("Expected a fresh entry after revalidation")
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	})
+
+	t.Run("LRUEviction", func(t *testing.T) {
+		var calls atomic.Int32
+		server := startCountingWeatherAPIServer(&calls)
+		defer server.Close()
+
+		cache := routes.NewWeatherCache(time.Minute, 0, 2)
+		weatherService := newCachedWeatherService(server, cache)
+
+		getWeather(weatherService, "A")
+		getWeather(weatherService, "B")
+		getWeather(weatherService, "A") // A becomes most recently used
+		getWeather(weatherService, "C") // evicts B
+
+		if cache.Len() != 2 {
+			t.Errorf("Expected 2 cached entries; got %d", cache.Len())
+		}
+		if got := getWeather(weatherService, "A").Header().Get("X-Cache"); got != "HIT" {
+			t.Errorf("Expected A to stay cached; got X-Cache %q", got)
+		}
+		if got := getWeather(weatherService, "B").Header().Get("X-Cache"); got != "MISS" {
+			t.Errorf("Expected B to be evicted; got X-Cache %q", got)
+		}
+		if got := calls.Load(); got != 4 {
+			t.Errorf("Expected 4 upstream calls; got %d", got)
+		}
+	})
+}
+
+func TestWeatherRequestCoalescing(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	handler := mockWeatherAPIHandler()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-release // hold the upstream call until every client is waiting
+		handler(w, r)
+	}))
+	defer server.Close()
+
+	// Caching is disabled so only coalescing can prevent duplicate upstream calls
+	weatherService := newCachedWeatherService(server, nil)
+
+	const clients = 10
+	cities := []string{"Berlin", "berlin", "BERLIN"}
+	codes := make(chan int, clients)
+	for i := 0; i < clients; i++ {
+		go func(city string) {
+			codes <- getWeather(weatherService, city).Code
+		}(cities[i%len(cities)])
+	}
+
+	// Wait for the upstream call to start and the other clients to join it
+	deadline := time.Now().Add(2 * time.Second)
+	for weatherService.Stats().Coalesced < clients-1 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	close(release)
+
+	for i := 0; i < clients; i++ {
+		if code := <-codes; code != http.StatusOK {
+			t.Errorf("Expected status OK; got %v", code)
+		}
+	}
+
+	if got := calls.Load(); got != 1 {
+		t.Errorf("Expected 1 upstream call; got %d", got)
+	}
+	stats := weatherService.Stats()
+	if stats.UpstreamRequests != 1 || stats.Coalesced != clients-1 {
+		t.Errorf("Expected 1 upstream request and %d coalesced; got %+v", clients-1, stats)
+	}
+}
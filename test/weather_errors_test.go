@@ -0,0 +1,140 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/jorge2751/GoAPI/internal/api/response"
+	"github.com/jorge2751/GoAPI/internal/api/routes"
+)
+
+func TestWeatherUpstreamErrorMapping(t *testing.T) {
+	mockAPIServer := startMockWeatherAPIServer()
+	defer mockAPIServer.Close()
+
+	weatherService := routes.NewWeatherServiceWithProviders(newMockWeatherAPIProvider(mockAPIServer, "test-api-key"))
+	weatherService.Cache = nil
+
+	tests := []struct {
+		city   string
+		status int
+		code   string
+	}{
+		{"unknowncity", http.StatusNotFound, response.CodeNotFound},
+		{"quotacity", http.StatusTooManyRequests, response.CodeRateLimited},
+		{"errorcity", http.StatusBadGateway, response.CodeUpstreamFailure},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.city, func(t *testing.T) {
+			w := getWeather(weatherService, tt.city)
+			if w.Code != tt.status {
+				t.Errorf("Expected status %d; got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+			assertErrorCode(t, w.Body.Bytes(), tt.code)
+		})
+	}
+}
+
+func TestWeatherAPIKeyRedaction(t *testing.T) {
+	var logs bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(newTestLogger(&logs))
+	defer slog.SetDefault(previous)
+
+	const apiKey = "invalid-key"
+
+	t.Run("RejectedKey", func(t *testing.T) {
+		mockAPIServer := startMockWeatherAPIServer()
+		defer mockAPIServer.Close()
+		weatherService := routes.NewWeatherServiceWithProviders(newMockWeatherAPIProvider(mockAPIServer, apiKey))
+
+		w := getWeather(weatherService, "Paris")
+		if w.Code != http.StatusBadGateway {
+			t.Errorf("Expected status BadGateway for a rejected key; got %v", w.Code)
+		}
+		if strings.Contains(w.Body.String(), apiKey) {
+			t.Errorf("API key leaked into response: %s", w.Body.String())
+		}
+	})
+
+	t.Run("NetworkError", func(t *testing.T) {
+		// A closed server makes the HTTP client fail with an error that quotes the request URL
+		mockAPIServer := startMockWeatherAPIServer()
+		provider := newMockWeatherAPIProvider(mockAPIServer, apiKey)
+		provider.Retry = routes.RetryPolicy{MaxAttempts: 1}
+		mockAPIServer.Close()
+		weatherService := routes.NewWeatherServiceWithProviders(provider)
+
+		w := getWeather(weatherService, "Paris")
+		if w.Code != http.StatusBadGateway {
+			t.Errorf("Expected status BadGateway; got %v", w.Code)
+		}
+		if strings.Contains(w.Body.String(), apiKey) {
+			t.Errorf("API key leaked into response: %s", w.Body.String())
+		}
+	})
+
+	if logs.Len() == 0 {
+		t.Fatal("Expected the failures to be logged")
+	}
+	if strings.Contains(logs.String(), apiKey) {
+		t.Errorf("API key leaked into logs: %s", logs.String())
+	}
+	if !strings.Contains(logs.String(), "[REDACTED]") {
+		t.Errorf("Expected the key to be redacted in logs; got %s", logs.String())
+	}
+}
+
+func TestWeatherCityInput(t *testing.T) {
+	mockAPIServer := startMockWeatherAPIServer()
+	defer mockAPIServer.Close()
+
+	weatherService := routes.NewWeatherServiceWithProviders(newMockWeatherAPIProvider(mockAPIServer, "test-api-key"))
+
+	t.Run("EscapedUpstreamQuery", func(t *testing.T) {
+		// The mock names the location after the q parameter it received
+		for _, city := range []string{"New York", "São Paulo", "Washington, D.C.", "N'Djamena"} {
+			req := httptest.NewRequest("GET", "/weather?city="+url.QueryEscape(city), nil)
+			w := httptest.NewRecorder()
+			weatherService.WeatherHandler(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Errorf("%s: expected status OK; got %v: %s", city, w.Code, w.Body.String())
+				continue
+			}
+			var body response.Envelope[routes.CurrentWeatherReport]
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("Failed to parse response body: %v", err)
+			}
+			if body.Data.Location.Name != city {
+				t.Errorf("Expected upstream query %q; got %q", city, body.Data.Location.Name)
+			}
+		}
+	})
+
+	t.Run("Rejected", func(t *testing.T) {
+		for _, city := range []string{
+			strings.Repeat("a", routes.MaxCityLength+1),
+			"Paris&key=other",
+			"Par\x00is",
+			"<script>",
+		} {
+			req := httptest.NewRequest("GET", "/weather?city="+url.QueryEscape(city), nil)
+			w := httptest.NewRecorder()
+			weatherService.WeatherHandler(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("%.20q: expected status BadRequest; got %v", city, w.Code)
+				continue
+			}
+			assertErrorCode(t, w.Body.Bytes(), response.CodeInvalidParameter)
+		}
+	})
+}
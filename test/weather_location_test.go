@@ -0,0 +1,267 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jorge2751/GoAPI/internal/api/response"
+	"github.com/jorge2751/GoAPI/internal/api/routes"
+)
+
+func TestWeatherLocationLookups(t *testing.T) {
+	mockAPIServer := startMockWeatherAPIServer()
+	defer mockAPIServer.Close()
+
+	weatherService := routes.NewWeatherServiceWithProviders(newMockWeatherAPIProvider(mockAPIServer, "test-api-key"))
+
+	// The mock names the location after the q parameter it received
+	tests := []struct {
+		name      string
+		query     string
+		forwarded string
+		wantQ     string
+	}{
+		{"Coordinates", "lat=48.8567&lon=2.3508", "", "48.8567,2.3508"},
+		{"CoordinatesRounded", "lat=-33.868819&lon=151.209295", "", "-33.8688,151.2093"},
+		{"PostalCode", "postal_code=10001", "", "10001"},
+		{"ExplicitIP", "ip=198.51.100.4", "", "198.51.100.4"},
+		{"AutoIPForwarded", "ip=auto", "203.0.113.7, 10.0.0.1", "203.0.113.7"},
+		{"AutoIPRemoteAddr", "ip=auto", "", "192.0.2.1"}, // httptest's default RemoteAddr
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/weather?"+tt.query, nil)
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			w := httptest.NewRecorder()
+			weatherService.WeatherHandler(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status OK; got %v: %s", w.Code, w.Body.String())
+			}
+			var body response.Envelope[routes.CurrentWeatherReport]
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("Failed to parse response body: %v", err)
+			}
+			if body.Data.Location.Name != tt.wantQ {
+				t.Errorf("Expected upstream query %q; got %q", tt.wantQ, body.Data.Location.Name)
+			}
+
+			// Shared caches must not hand one client's IP lookup to another
+			scope := "public, "
+			if strings.HasPrefix(tt.query, "ip=") {
+				scope = "private, "
+			}
+			if cc := w.Header().Get("Cache-Control"); !strings.HasPrefix(cc, scope) {
+				t.Errorf("Expected Cache-Control starting with %q; got %q", scope, cc)
+			}
+		})
+	}
+
+	t.Run("InvalidLocations", func(t *testing.T) {
+		for _, query := range []string{
+			"lat=abc&lon=2",
+			"lat=48.85",
+			"lat=91&lon=0",
+			"lat=0&lon=181",
+			"lat=NaN&lon=NaN",
+			"lat=0&lon=nan",
+			"ip=not-an-ip",
+			"city=Paris&postal_code=75001",
+		} {
+			req := httptest.NewRequest("GET", "/weather?"+query, nil)
+			w := httptest.NewRecorder()
+			weatherService.WeatherHandler(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("%s: expected status BadRequest; got %v", query, w.Code)
+				continue
+			}
+			assertErrorCode(t, w.Body.Bytes(), response.CodeInvalidParameter)
+		}
+	})
+
+	t.Run("ForecastByCoordinates", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/weather/forecast?lat=10&lon=20&days=1", nil)
+		w := httptest.NewRecorder()
+		weatherService.ForecastHandler(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status OK; got %v: %s", w.Code, w.Body.String())
+		}
+		var body response.Envelope[routes.WeatherForecast]
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("Failed to parse response body: %v", err)
+		}
+		if body.Data.Location.Name != "10,20" {
+			t.Errorf("Expected upstream query 10,20; got %q", body.Data.Location.Name)
+		}
+	})
+}
+
+func TestOpenMeteoLocationLookups(t *testing.T) {
+	var searches atomic.Int32
+	openMeteo := startMockOpenMeteoServer()
+	defer openMeteo.Close()
+	counting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/search" {
+			searches.Add(1)
+		}
+		openMeteo.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer counting.Close()
+
+	weatherService := routes.NewWeatherServiceWithProviders(newMockOpenMeteoProvider(counting))
+
+	t.Run("CoordinatesSkipGeocoding", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/weather?lat=10.5&lon=-20.25", nil)
+		w := httptest.NewRecorder()
+		weatherService.WeatherHandler(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status OK; got %v: %s", w.Code, w.Body.String())
+		}
+		var body response.Envelope[routes.CurrentWeatherReport]
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("Failed to parse response body: %v", err)
+		}
+		if body.Data.Location.Lat != 10.5 || body.Data.Location.Lon != -20.25 {
+			t.Errorf("Unexpected location: %+v", body.Data.Location)
+		}
+		if got := searches.Load(); got != 0 {
+			t.Errorf("Expected no geocoding requests; got %d", got)
+		}
+	})
+
+	t.Run("IPUnsupported", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/weather?ip=198.51.100.4", nil)
+		w := httptest.NewRecorder()
+		weatherService.WeatherHandler(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status BadRequest; got %v", w.Code)
+		}
+		assertErrorCode(t, w.Body.Bytes(), response.CodeInvalidParameter)
+	})
+}
+
+// postBatch sends body to the batch handler and returns the recorder
+func postBatch(weatherService *routes.WeatherService, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/weather/batch", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	weatherService.BatchHandler(w, req)
+	return w
+}
+
+func TestWeatherBatch(t *testing.T) {
+	t.Run("MixedResults", func(t *testing.T) {
+		mockAPIServer := startMockWeatherAPIServer()
+		defer mockAPIServer.Close()
+		provider := newMockWeatherAPIProvider(mockAPIServer, "test-api-key")
+		provider.Retry = routes.RetryPolicy{MaxAttempts: 1}
+		weatherService := routes.NewWeatherServiceWithProviders(provider)
+
+		w := postBatch(weatherService, `{"units": "metric", "locations": [
+            {"city": "Paris"},
+            {"lat": 1.5, "lon": 2.5},
+            {"city": "errorcity"},
+            {"lat": 1.5}
+        ]}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status OK; got %v: %s", w.Code, w.Body.String())
+		}
+
+		var body response.Envelope[routes.WeatherBatchResponse]
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("Failed to parse response body: %v", err)
+		}
+		results := body.Data.Results
+		if len(results) != 4 || body.Data.Succeeded != 2 || body.Data.Failed != 2 {
+			t.Fatalf("Expected 2 successes and 2 failures; got %+v", body.Data)
+		}
+		for i, result := range results {
+			if result.Index != i {
+				t.Errorf("Result %d has index %d", i, result.Index)
+			}
+		}
+		if results[0].Data == nil || results[0].Data.Location.Name != "Paris" || results[0].Data.Units.System != routes.UnitsMetric {
+			t.Errorf("Unexpected first result: %+v", results[0])
+		}
+		if results[1].Data == nil || results[1].Data.Location.Name != "1.5,2.5" {
+			t.Errorf("Unexpected second result: %+v", results[1])
+		}
+		if results[2].Error == nil || results[2].Error.Code != response.CodeUpstreamFailure {
+			t.Errorf("Expected upstream failure for third result; got %+v", results[2])
+		}
+		if results[3].Status != http.StatusBadRequest || results[3].Error == nil || results[3].Error.Code != response.CodeInvalidParameter {
+			t.Errorf("Expected invalid parameter for fourth result; got %+v", results[3])
+		}
+	})
+
+	t.Run("BoundedParallelism", func(t *testing.T) {
+		var inFlight, peak atomic.Int32
+		handler := mockWeatherAPIHandler()
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n := inFlight.Add(1)
+			defer inFlight.Add(-1)
+			for {
+				old := peak.Load()
+				if n <= old || peak.CompareAndSwap(old, n) {
+					break
+				}
+			}
+			time.Sleep(20 * time.Millisecond)
+			handler(w, r)
+		}))
+		defer server.Close()
+		weatherService := routes.NewWeatherServiceWithProviders(newMockWeatherAPIProvider(server, "test-api-key"))
+
+		locations := make([]string, 12)
+		for i := range locations {
+			locations[i] = fmt.Sprintf(`{"city": "City%d"}`, i)
+		}
+		w := postBatch(weatherService, `{"locations": [`+strings.Join(locations, ",")+`]}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status OK; got %v: %s", w.Code, w.Body.String())
+		}
+
+		got := peak.Load()
+		if got > routes.DefaultWeatherBatchConcurrency {
+			t.Errorf("Expected at most %d concurrent upstream requests; got %d", routes.DefaultWeatherBatchConcurrency, got)
+		}
+		if got < 2 {
+			t.Errorf("Expected lookups to run concurrently; peak was %d", got)
+		}
+	})
+
+	t.Run("InvalidRequests", func(t *testing.T) {
+		weatherService := routes.NewWeatherServiceWithProviders()
+		tooMany := strings.Repeat(`{"city": "x"},`, routes.MaxWeatherBatchSize) + `{"city": "x"}`
+
+		for _, tc := range []struct {
+			body string
+			code string
+		}{
+			{`not json`, response.CodeInvalidParameter},
+			{`{"locations": []}`, response.CodeMissingParameter},
+			{`{"locations": [` + tooMany + `]}`, response.CodeInvalidParameter},
+			{`{"locations": [{"city": "x"}], "units": "kelvin"}`, response.CodeInvalidParameter},
+		} {
+			w := postBatch(weatherService, tc.body)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("%.30s: expected status BadRequest; got %v", tc.body, w.Code)
+				continue
+			}
+			assertErrorCode(t, w.Body.Bytes(), tc.code)
+		}
+	})
+}
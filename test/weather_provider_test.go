@@ -0,0 +1,258 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jorge2751/GoAPI/internal/api/response"
+	"github.com/jorge2751/GoAPI/internal/api/routes"
+)
+
+// Mock Open-Meteo server serving both the geocoding and forecast APIs
+func startMockOpenMeteoServer() *httptest.Server {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/search", func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("name")
+		if name == "Nowhere" {
+			fmt.Fprintln(w, `{"generationtime_ms": 0.5}`)
+			return
+		}
+		fmt.Fprintf(w, `{"results": [{
+            "name": %q,
+            "admin1": "Test Region",
+            "country": "Test Country",
+            "latitude": 10.5,
+            "longitude": -20.25,
+            "timezone": "Europe/London"
+        }]}`, name)
+	})
+
+	mux.HandleFunc("/forecast", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("latitude") != "10.5" || r.URL.Query().Get("longitude") != "-20.25" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintln(w, `{"error": true, "reason": "unexpected coordinates"}`)
+			return
+		}
+		if r.URL.Query().Get("daily") == "sunrise,sunset" {
+			date := r.URL.Query().Get("start_date")
+			fmt.Fprintf(w, `{"daily": {"time": [%q], "sunrise": ["%sT06:45"], "sunset": ["%sT20:10"]}}`, date, date, date)
+			return
+		}
+		if r.URL.Query().Get("daily") != "" {
+			fmt.Fprintln(w, `{"daily": {
+                "time": ["2030-01-01", "2030-01-02"],
+                "weather_code": [61, 0],
+                "temperature_2m_max": [20.0, 25.0],
+                "temperature_2m_min": [10.0, 12.5],
+                "precipitation_sum": [3.2, 0],
+                "precipitation_probability_max": [80, 5]
+            }}`)
+			return
+		}
+		fmt.Fprintln(w, `{"current": {
+            "time": "2030-01-01T14:30",
+            "temperature_2m": 15.0,
+            "apparent_temperature": 13.0,
+            "relative_humidity_2m": 60,
+            "weather_code": 2,
+            "wind_speed_10m": 20.0,
+            "wind_direction_10m": 95,
+            "pressure_msl": 1015.0,
+            "uv_index": 3.5,
+            "visibility": 24140.0
+        }}`)
+	})
+
+	mux.HandleFunc("/archive", func(w http.ResponseWriter, r *http.Request) {
+		date := r.URL.Query().Get("start_date")
+		fmt.Fprintf(w, `{"daily": {
+            "time": [%q],
+            "weather_code": [3],
+            "temperature_2m_max": [18.0],
+            "temperature_2m_min": [9.0],
+            "precipitation_sum": [0.4]
+        }}`, date)
+	})
+
+	return httptest.NewServer(mux)
+}
+
+// newMockOpenMeteoProvider returns an Open-Meteo provider that talks to server
+func newMockOpenMeteoProvider(server *httptest.Server) *routes.OpenMeteoProvider {
+	provider := routes.NewOpenMeteoProvider()
+	provider.HTTPClient = server.Client()
+	provider.BaseURL = server.URL
+	provider.GeocodingURL = server.URL
+	provider.ArchiveURL = server.URL
+	return provider
+}
+
+func TestOpenMeteoProvider(t *testing.T) {
+	server := startMockOpenMeteoServer()
+	defer server.Close()
+
+	weatherService := routes.NewWeatherServiceWithProviders(newMockOpenMeteoProvider(server))
+
+	t.Run("Success", func(t *testing.T) {
+		w := getWeather(weatherService, "Lisbon")
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status OK; got %v: %s", w.Code, w.Body.String())
+		}
+
+		var body response.Envelope[routes.CurrentWeatherReport]
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("Failed to parse response body: %v", err)
+		}
+		resp := body.Data
+
+		if resp.Location.Name != "Lisbon" || resp.Location.Region != "Test Region" {
+			t.Errorf("Unexpected location: %+v", resp.Location)
+		}
+		if resp.Location.Lat != 10.5 || resp.Location.Timezone != "Europe/London" || resp.Location.LocalTime != "2030-01-01 14:30" {
+			t.Errorf("Unexpected location details: %+v", resp.Location)
+		}
+		if resp.Current.Temperature != 59.0 || resp.Current.FeelsLike != 55.4 {
+			t.Errorf("Expected 59F feeling like 55.4F; got %v/%v", resp.Current.Temperature, resp.Current.FeelsLike)
+		}
+		if resp.Current.WindSpeed != 12.4 || resp.Current.WindDirection != "E" || resp.Current.Visibility != 15.0 {
+			t.Errorf("Unexpected imperial conditions: %+v", resp.Current)
+		}
+		if resp.Current.Condition != "Partly cloudy" {
+			t.Errorf("Expected condition Partly cloudy; got %s", resp.Current.Condition)
+		}
+		if resp.Provider != routes.ProviderOpenMeteo {
+			t.Errorf("Expected provider %s; got %s", routes.ProviderOpenMeteo, resp.Provider)
+		}
+	})
+
+	t.Run("Metric", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/weather?city=Lisbon&units=metric", nil)
+		w := httptest.NewRecorder()
+		weatherService.WeatherHandler(w, req)
+
+		var body response.Envelope[routes.CurrentWeatherReport]
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("Failed to parse response body: %v", err)
+		}
+		current := body.Data.Current
+		if current.Temperature != 15.0 || current.WindSpeed != 20.0 || current.Pressure != 1015.0 || current.Visibility != 24.1 {
+			t.Errorf("Unexpected metric conditions: %+v", current)
+		}
+		if current.Humidity != 60 || current.UV != 3.5 {
+			t.Errorf("Unexpected humidity/UV: %+v", current)
+		}
+	})
+
+	t.Run("Forecast", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		weatherService.ForecastHandler(w, httptest.NewRequest("GET", "/weather/forecast?city=Lisbon&days=2", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status OK; got %v: %s", w.Code, w.Body.String())
+		}
+
+		var body response.Envelope[routes.WeatherForecast]
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("Failed to parse response body: %v", err)
+		}
+		if len(body.Data.Days) != 2 {
+			t.Fatalf("Expected 2 days; got %d", len(body.Data.Days))
+		}
+		day := body.Data.Days[0]
+		if day.MaxTempF != 68 || day.MinTempC != 10 || day.Condition != "Light rain" {
+			t.Errorf("Unexpected first day: %+v", day)
+		}
+		if day.ChanceOfRain == nil || *day.ChanceOfRain != 80 {
+			t.Errorf("Expected 80%% chance of rain; got %v", day.ChanceOfRain)
+		}
+	})
+
+	t.Run("History", func(t *testing.T) {
+		date := time.Now().UTC().AddDate(0, 0, -10).Format("2006-01-02")
+		w := httptest.NewRecorder()
+		weatherService.HistoryHandler(w, httptest.NewRequest("GET", "/weather/history?city=Lisbon&date="+date, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status OK; got %v: %s", w.Code, w.Body.String())
+		}
+
+		var body response.Envelope[routes.WeatherHistory]
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("Failed to parse response body: %v", err)
+		}
+		if body.Data.Day.Date != date || body.Data.Day.MaxTempC != 18 || body.Data.Day.Condition != "Overcast" {
+			t.Errorf("Unexpected history day: %+v", body.Data.Day)
+		}
+	})
+
+	t.Run("Astronomy", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		weatherService.AstronomyHandler(w, httptest.NewRequest("GET", "/weather/astronomy?city=Lisbon&date=2030-06-21", nil))
+
+		var body response.Envelope[routes.WeatherAstronomy]
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("Failed to parse response body: %v", err)
+		}
+		if body.Data.Sunrise != "06:45" || body.Data.Sunset != "20:10" || body.Data.MoonPhase != "" {
+			t.Errorf("Unexpected astronomy data: %+v", body.Data)
+		}
+	})
+
+	t.Run("LocationNotFound", func(t *testing.T) {
+		w := getWeather(weatherService, "Nowhere")
+		if w.Code != http.StatusNotFound {
+			t.Errorf("Expected status 404; got %v", w.Code)
+		}
+		assertErrorCode(t, w.Body.Bytes(), response.CodeNotFound)
+	})
+}
+
+func TestWeatherProviderFailover(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+
+	openMeteo := startMockOpenMeteoServer()
+	defer openMeteo.Close()
+
+	primary := newMockWeatherAPIProvider(failing, "test-api-key")
+	primary.Retry = routes.RetryPolicy{MaxAttempts: 1}
+	weatherService := routes.NewWeatherServiceWithProviders(primary, newMockOpenMeteoProvider(openMeteo))
+
+	w := getWeather(weatherService, "Lisbon")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected failover to succeed; got %v: %s", w.Code, w.Body.String())
+	}
+
+	var body response.Envelope[routes.CurrentWeatherReport]
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to parse response body: %v", err)
+	}
+	if body.Data.Provider != routes.ProviderOpenMeteo {
+		t.Errorf("Expected data from %s; got %s", routes.ProviderOpenMeteo, body.Data.Provider)
+	}
+	if got := weatherService.Stats().Failovers; got != 1 {
+		t.Errorf("Expected 1 failover; got %d", got)
+	}
+}
+
+func TestNewWeatherProvider(t *testing.T) {
+	for _, name := range []string{"weatherapi", "OpenMeteo"} {
+		provider, err := routes.NewWeatherProvider(name, "key", routes.NewUpstream())
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+			continue
+		}
+		if provider == nil {
+			t.Errorf("%s: expected a provider", name)
+		}
+	}
+
+	if _, err := routes.NewWeatherProvider("darksky", "key", routes.NewUpstream()); err == nil {
+		t.Error("Expected error for unknown provider")
+	}
+}
@@ -0,0 +1,349 @@
+package test
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jorge2751/GoAPI/internal/api/response"
+	"github.com/jorge2751/GoAPI/internal/api/routes"
+)
+
+// sseEvent is one event or comment read from an event stream
+type sseEvent struct {
+	id      string
+	event   string
+	data    string
+	comment string
+}
+
+// sseStream reads the events of an open /weather/stream response
+type sseStream struct {
+	resp   *http.Response
+	events chan sseEvent
+}
+
+// openStream connects to the streamer's handler on server and starts reading events
+func openStream(t *testing.T, server *httptest.Server, query, lastEventID string) *sseStream {
+	t.Helper()
+
+	req, err := http.NewRequest("GET", server.URL+"/weather/stream?"+query, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		t.Fatalf("Expected status OK; got %v", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("Expected Content-Type text/event-stream; got %q", got)
+	}
+
+	stream := &sseStream{resp: resp, events: make(chan sseEvent, 16)}
+	go func() {
+		defer close(stream.events)
+		scanner := bufio.NewScanner(resp.Body)
+		var ev sseEvent
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case line == "":
+				if ev != (sseEvent{}) {
+					stream.events <- ev
+				}
+				ev = sseEvent{}
+			case strings.HasPrefix(line, ":"):
+				ev.comment = strings.TrimSpace(line[1:])
+			case strings.HasPrefix(line, "id: "):
+				ev.id = line[len("id: "):]
+			case strings.HasPrefix(line, "event: "):
+				ev.event = line[len("event: "):]
+			case strings.HasPrefix(line, "data: "):
+				ev.data = line[len("data: "):]
+			}
+		}
+	}()
+	return stream
+}
+
+// next returns the next event that is not a retry hint, failing after a timeout
+func (s *sseStream) next(t *testing.T) sseEvent {
+	t.Helper()
+
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case ev, ok := <-s.events:
+			if !ok {
+				t.Fatal("Stream closed before the next event")
+			}
+			if ev.event == "" && ev.comment == "" {
+				continue // retry: hint
+			}
+			return ev
+		case <-timeout:
+			t.Fatal("Timed out waiting for the next event")
+		}
+	}
+}
+
+// nextWeather returns the next weather event, skipping heartbeats
+func (s *sseStream) nextWeather(t *testing.T) (sseEvent, routes.CurrentWeatherReport) {
+	t.Helper()
+
+	for {
+		ev := s.next(t)
+		if ev.event != "weather" {
+			continue
+		}
+		var report routes.CurrentWeatherReport
+		if err := json.Unmarshal([]byte(ev.data), &report); err != nil {
+			t.Fatalf("Failed to parse event data: %v", err)
+		}
+		return ev, report
+	}
+}
+
+// assertStreamRefused checks that a stream for query is refused because a limit is reached
+func assertStreamRefused(t *testing.T, server *httptest.Server, query string) {
+	t.Helper()
+
+	resp, err := server.Client().Get(server.URL + "/weather/stream?" + query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("%s: expected status ServiceUnavailable; got %v", query, resp.StatusCode)
+	}
+	if resp.Header.Get("Retry-After") == "" {
+		t.Errorf("%s: expected a Retry-After header", query)
+	}
+	assertErrorCode(t, body, response.CodeLimitReached)
+}
+
+func (s *sseStream) close() {
+	s.resp.Body.Close()
+}
+
+// newTestStreamer returns a streamer reading uncached weather from weatherServer, served by an httptest server
+func newTestStreamer(weatherServer *httptest.Server, interval, heartbeat time.Duration) (*routes.WeatherStreamer, *httptest.Server) {
+	weatherService := routes.NewWeatherServiceWithProviders(newMockWeatherAPIProvider(weatherServer, "test-api-key"))
+	weatherService.Cache = nil
+	streamer := routes.NewWeatherStreamer(weatherService)
+	streamer.Interval = interval
+	streamer.Heartbeat = heartbeat
+
+	return streamer, httptest.NewServer(newTestRouter(routes.Services{Weather: weatherService, Streamer: streamer}))
+}
+
+// waitFor polls cond until it holds, failing after a timeout
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWeatherStream(t *testing.T) {
+	t.Run("SharedPoller", func(t *testing.T) {
+		var calls atomic.Int32
+		weatherServer := startCountingWeatherAPIServer(&calls)
+		defer weatherServer.Close()
+		streamer, server := newTestStreamer(weatherServer, time.Hour, time.Hour)
+		defer server.Close()
+		defer streamer.Close()
+
+		var streams []*sseStream
+		for range 3 {
+			stream := openStream(t, server, "city=London", "")
+			defer stream.close()
+			streams = append(streams, stream)
+		}
+		for _, stream := range streams {
+			ev, report := stream.nextWeather(t)
+			if ev.id == "" || report.Location.Name != "London" {
+				t.Errorf("Unexpected first event: %+v", ev)
+			}
+		}
+		if got := calls.Load(); got != 1 {
+			t.Errorf("Expected 1 upstream call for 3 subscribers; got %d", got)
+		}
+	})
+
+	t.Run("PushesChanges", func(t *testing.T) {
+		conditions := &mockConditions{tempC: 20, condition: "Sunny"}
+		weatherServer := startVariableWeatherAPIServer(conditions)
+		defer weatherServer.Close()
+		streamer, server := newTestStreamer(weatherServer, 10*time.Millisecond, time.Hour)
+		defer server.Close()
+		defer streamer.Close()
+
+		stream := openStream(t, server, "city=Paris&units=imperial", "")
+		defer stream.close()
+
+		first, report := stream.nextWeather(t)
+		if report.Current.Temperature != 68 || report.Current.Condition != "Sunny" {
+			t.Errorf("Unexpected first report: %+v", report.Current)
+		}
+
+		conditions.set(25, "Cloudy")
+		second, report := stream.nextWeather(t)
+		if second.id == first.id {
+			t.Errorf("Expected a new event ID for changed conditions; got %q twice", second.id)
+		}
+		if report.Current.Temperature != 77 || report.Current.Condition != "Cloudy" {
+			t.Errorf("Unexpected changed report: %+v", report.Current)
+		}
+	})
+
+	t.Run("HeartbeatAndResume", func(t *testing.T) {
+		weatherServer := startMockWeatherAPIServer()
+		defer weatherServer.Close()
+		streamer, server := newTestStreamer(weatherServer, time.Hour, 20*time.Millisecond)
+		defer server.Close()
+		defer streamer.Close()
+
+		stream := openStream(t, server, "city=London", "")
+		defer stream.close()
+		first, _ := stream.nextWeather(t)
+		if ev := stream.next(t); ev.comment != "heartbeat" {
+			t.Errorf("Expected a heartbeat comment on an idle stream; got %+v", ev)
+		}
+
+		// A client resuming with the latest event ID does not get it again
+		resumed := openStream(t, server, "city=London", first.id)
+		defer resumed.close()
+		if ev := resumed.next(t); ev.comment != "heartbeat" {
+			t.Errorf("Expected no replay of event %q; got %+v", first.id, ev)
+		}
+	})
+
+	t.Run("Teardown", func(t *testing.T) {
+		weatherServer := startMockWeatherAPIServer()
+		defer weatherServer.Close()
+		streamer, server := newTestStreamer(weatherServer, time.Hour, time.Hour)
+		defer server.Close()
+
+		disconnecting := openStream(t, server, "city=London", "")
+		disconnecting.nextWeather(t)
+		remaining := openStream(t, server, "city=Paris", "")
+		defer remaining.close()
+		remaining.nextWeather(t)
+
+		disconnecting.close()
+		waitFor(t, "the disconnected subscriber to be removed", func() bool { return streamer.Subscribers() == 1 })
+
+		streamer.Close()
+		select {
+		case _, ok := <-remaining.events:
+			for ok {
+				_, ok = <-remaining.events
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("Expected Close to end open streams")
+		}
+		if got := streamer.Subscribers(); got != 0 {
+			t.Errorf("Expected no subscribers after Close; got %d", got)
+		}
+
+		// New streams are refused once closed
+		resp, err := server.Client().Get(server.URL + "/weather/stream?city=London")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("Expected status ServiceUnavailable after Close; got %v", resp.StatusCode)
+		}
+	})
+
+	t.Run("ErrorSentOnce", func(t *testing.T) {
+		var calls atomic.Int32
+		weatherServer := startCountingWeatherAPIServer(&calls)
+		defer weatherServer.Close()
+		streamer, server := newTestStreamer(weatherServer, 5*time.Millisecond, 50*time.Millisecond)
+		defer server.Close()
+		defer streamer.Close()
+
+		stream := openStream(t, server, "city=unknowncity", "")
+		defer stream.close()
+		ev := stream.next(t)
+		var body response.ErrorBody
+		if err := json.Unmarshal([]byte(ev.data), &body); ev.event != "error" || err != nil || body.Code != response.CodeNotFound {
+			t.Fatalf("Expected a not_found error event; got %+v", ev)
+		}
+
+		// The location keeps failing the same way, so only heartbeats follow
+		for range 2 {
+			if ev := stream.next(t); ev.comment != "heartbeat" {
+				t.Errorf("Expected the same error not to be sent again; got %+v", ev)
+			}
+		}
+		if got := calls.Load(); got < 3 {
+			t.Errorf("Expected the location to be polled repeatedly; got %d upstream calls", got)
+		}
+	})
+
+	t.Run("Limits", func(t *testing.T) {
+		weatherServer := startMockWeatherAPIServer()
+		defer weatherServer.Close()
+		streamer, server := newTestStreamer(weatherServer, time.Hour, time.Hour)
+		defer server.Close()
+		defer streamer.Close()
+		streamer.MaxLocations = 1
+		streamer.MaxSubscribers = 2
+
+		london := openStream(t, server, "city=London", "")
+		defer london.close()
+		london.nextWeather(t)
+
+		// A second location is refused, another subscriber to the first is not
+		assertStreamRefused(t, server, "city=Paris")
+		again := openStream(t, server, "city=London", "")
+		defer again.close()
+		again.nextWeather(t)
+
+		// Every subscriber slot is taken
+		assertStreamRefused(t, server, "city=London")
+
+		again.close()
+		waitFor(t, "the subscriber slot to be released", func() bool { return streamer.Subscribers() == 1 })
+		reopened := openStream(t, server, "city=London", "")
+		defer reopened.close()
+		reopened.nextWeather(t)
+	})
+
+	t.Run("MissingLocation", func(t *testing.T) {
+		streamer := routes.NewWeatherStreamer(routes.NewWeatherService("test-api-key"))
+		req := httptest.NewRequest("GET", "/weather/stream", nil)
+		w := httptest.NewRecorder()
+		streamer.StreamHandler(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status BadRequest; got %v", w.Code)
+		}
+	})
+}
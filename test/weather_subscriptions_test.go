@@ -0,0 +1,364 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jorge2751/GoAPI/internal/api/response"
+	"github.com/jorge2751/GoAPI/internal/api/routes"
+)
+
+// mockConditions are the current conditions served by startVariableWeatherAPIServer
+type mockConditions struct {
+	mu        sync.Mutex
+	tempC     float64
+	condition string
+}
+
+func (c *mockConditions) set(tempC float64, condition string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tempC, c.condition = tempC, condition
+}
+
+// startVariableWeatherAPIServer serves WeatherAPI current.json responses with the conditions in c
+func startVariableWeatherAPIServer(c *mockConditions) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		fmt.Fprintf(w, `{"location": {"name": %q}, "current": {"temp_c": %v, "temp_f": %v, "condition": {"text": %q}}}`,
+			r.URL.Query().Get("q"), c.tempC, c.tempC*9/5+32, c.condition)
+	}))
+}
+
+// webhookDelivery is one request received by a webhookReceiver
+type webhookDelivery struct {
+	header http.Header
+	body   []byte
+}
+
+// webhookReceiver records webhook deliveries, failing the first failures of them with 503
+type webhookReceiver struct {
+	mu         sync.Mutex
+	deliveries []webhookDelivery
+	failures   atomic.Int32
+}
+
+func (wr *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	wr.mu.Lock()
+	wr.deliveries = append(wr.deliveries, webhookDelivery{header: r.Header.Clone(), body: body})
+	wr.mu.Unlock()
+
+	if wr.failures.Add(-1) >= 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (wr *webhookReceiver) received() []webhookDelivery {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+	return append([]webhookDelivery(nil), wr.deliveries...)
+}
+
+// newTestSubscriptionManager returns a manager reading uncached weather from
+// weatherServer that may deliver to the loopback webhook servers of the tests
+func newTestSubscriptionManager(weatherServer *httptest.Server) *routes.SubscriptionManager {
+	weatherService := routes.NewWeatherServiceWithProviders(newMockWeatherAPIProvider(weatherServer, "test-api-key"))
+	weatherService.Cache = nil
+	manager := routes.NewSubscriptionManager(weatherService)
+	manager.Webhook.AllowPrivateNetworks = true
+	manager.Webhook.Retry = routes.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+	return manager
+}
+
+// createSubscription registers a subscription with manager from a JSON body and returns the recorder
+func createSubscription(manager *routes.SubscriptionManager, body string) *httptest.ResponseRecorder {
+	return serve(newTestRouter(routes.Services{Subscriptions: manager}), "POST", "/weather/subscriptions", body)
+}
+
+// mustCreateSubscription registers a subscription and returns it, secret included
+func mustCreateSubscription(t *testing.T, manager *routes.SubscriptionManager, body string) routes.Subscription {
+	t.Helper()
+
+	w := createSubscription(manager, body)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status Created; got %v: %s", w.Code, w.Body.String())
+	}
+	var created response.Envelope[routes.Subscription]
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatalf("Failed to parse response body: %v", err)
+	}
+	return created.Data
+}
+
+func TestWeatherSubscriptionAPI(t *testing.T) {
+	weatherServer := startMockWeatherAPIServer()
+	defer weatherServer.Close()
+	weatherService := routes.NewWeatherServiceWithProviders(newMockWeatherAPIProvider(weatherServer, "test-api-key"))
+	manager := routes.NewSubscriptionManager(weatherService)
+
+	router := newTestRouter(routes.Services{Weather: weatherService, Subscriptions: manager})
+
+	w := serve(router, "POST", "/weather/subscriptions", `{"city": "Paris", "rule": {"type": "temperature_above", "threshold": 30, "units": "metric"}, "webhook_url": "https://example.com/hook"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status Created; got %v: %s", w.Code, w.Body.String())
+	}
+	var created response.Envelope[routes.Subscription]
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatalf("Failed to parse response body: %v", err)
+	}
+	sub := created.Data
+	if sub.ID == "" || sub.Secret == "" || sub.Location != "Paris" || sub.Rule.Units != routes.UnitsMetric {
+		t.Errorf("Unexpected subscription: %+v", sub)
+	}
+	if got := w.Header().Get("Location"); got != "/weather/subscriptions/"+sub.ID {
+		t.Errorf("Expected Location header for the subscription; got %q", got)
+	}
+
+	// A second subscriber, whose secret must not give access to the first subscription
+	var other response.Envelope[routes.Subscription]
+	json.Unmarshal(serve(router, "POST", "/weather/subscriptions", `{"city": "Rome", "rule": {"type": "condition_change"}, "webhook_url": "https://example.org/hook"}`).Body.Bytes(), &other)
+
+	t.Run("Get", func(t *testing.T) {
+		w := serve(router, "GET", "/weather/subscriptions/"+sub.ID, "", "Authorization", "Bearer "+sub.Secret)
+		if w.Code != http.StatusOK || strings.Contains(w.Body.String(), sub.Secret) {
+			t.Errorf("Expected the subscription without its secret; got %v: %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("RequiresSecret", func(t *testing.T) {
+		for _, method := range []string{"GET", "DELETE"} {
+			w := serve(router, method, "/weather/subscriptions/"+sub.ID, "")
+			if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") != "Bearer" {
+				t.Errorf("%s: expected status Unauthorized with a Bearer challenge; got %v", method, w.Code)
+			}
+			assertErrorCode(t, w.Body.Bytes(), response.CodeUnauthorized)
+
+			// Another subscriber's secret is treated as an unknown subscription
+			if w := serve(router, method, "/weather/subscriptions/"+sub.ID, "", "Authorization", "Bearer "+other.Data.Secret); w.Code != http.StatusNotFound {
+				t.Errorf("%s: expected status NotFound with another secret; got %v", method, w.Code)
+			}
+		}
+	})
+
+	t.Run("NoList", func(t *testing.T) {
+		if w := serve(router, "GET", "/weather/subscriptions", ""); w.Code != http.StatusMethodNotAllowed {
+			t.Errorf("Expected subscriptions not to be listable; got %v", w.Code)
+		}
+	})
+
+	t.Run("InvalidRequests", func(t *testing.T) {
+		for _, body := range []string{
+			`{"city": "Paris", "rule": {"type": "windy"}, "webhook_url": "https://example.com/hook"}`,
+			`{"city": "Paris", "rule": {"type": "temperature_below"}, "webhook_url": "https://example.com/hook"}`,
+			`{"city": "Paris", "rule": {"type": "condition_change"}, "webhook_url": "ftp://example.com/hook"}`,
+			`{"city": "Paris", "rule": {"type": "condition_change"}, "webhook_url": "/relative"}`,
+			`{"rule": {"type": "condition_change"}, "webhook_url": "https://example.com/hook"}`,
+			`{"city": "Paris", "rule": {"type": "condition_change", "units": "kelvin"}, "webhook_url": "https://example.com/hook"}`,
+			// Internal addresses
+			`{"city": "Paris", "rule": {"type": "condition_change"}, "webhook_url": "http://127.0.0.1/hook"}`,
+			`{"city": "Paris", "rule": {"type": "condition_change"}, "webhook_url": "http://localhost:8080/hook"}`,
+			`{"city": "Paris", "rule": {"type": "condition_change"}, "webhook_url": "http://10.1.2.3/hook"}`,
+			`{"city": "Paris", "rule": {"type": "condition_change"}, "webhook_url": "http://169.254.169.254/latest/meta-data"}`,
+			`{"city": "Paris", "rule": {"type": "condition_change"}, "webhook_url": "http://[::1]/hook"}`,
+			`{"city": "Paris", "rule": {"type": "condition_change"}, "webhook_url": "http://0.0.0.0/hook"}`,
+			`{"city": "Paris", "rule": {"type": "condition_change"}, "webhook_url": "http://0.1.2.3/hook"}`,
+			`{"city": "Paris", "rule": {"type": "condition_change"}, "webhook_url": "http://100.64.1.1/hook"}`,
+			`{"city": "Paris", "rule": {"type": "condition_change"}, "webhook_url": "http://100.127.255.254/hook"}`,
+			`{"city": "Paris", "rule": {"type": "condition_change"}, "webhook_url": "http://192.0.0.8/hook"}`,
+			`{"city": "Paris", "rule": {"type": "condition_change"}, "webhook_url": "http://198.18.0.1/hook"}`,
+			`{"city": "Paris", "rule": {"type": "condition_change"}, "webhook_url": "http://198.19.255.1/hook"}`,
+			`{"city": "Paris", "rule": {"type": "condition_change"}, "webhook_url": "http://[::ffff:100.64.1.1]/hook"}`,
+		} {
+			if w := serve(router, "POST", "/weather/subscriptions", body); w.Code != http.StatusBadRequest {
+				t.Errorf("%s: expected status BadRequest; got %v", body, w.Code)
+			}
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		if w := serve(router, "DELETE", "/weather/subscriptions/"+sub.ID, "", "Authorization", "Bearer "+sub.Secret); w.Code != http.StatusNoContent {
+			t.Errorf("Expected status NoContent; got %v", w.Code)
+		}
+		if w := serve(router, "GET", "/weather/subscriptions/"+sub.ID, "", "Authorization", "Bearer "+sub.Secret); w.Code != http.StatusNotFound {
+			t.Errorf("Expected status NotFound after delete; got %v", w.Code)
+		}
+		if w := serve(router, "DELETE", "/weather/subscriptions/"+sub.ID, "", "Authorization", "Bearer "+sub.Secret); w.Code != http.StatusNotFound {
+			t.Errorf("Expected status NotFound for a second delete; got %v", w.Code)
+		}
+	})
+}
+
+func TestWeatherSubscriptionWebhooks(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("TemperatureThreshold", func(t *testing.T) {
+		conditions := &mockConditions{tempC: 15, condition: "Sunny"}
+		weatherServer := startVariableWeatherAPIServer(conditions)
+		defer weatherServer.Close()
+		receiver := &webhookReceiver{}
+		hook := httptest.NewServer(receiver)
+		defer hook.Close()
+
+		manager := newTestSubscriptionManager(weatherServer)
+		sub := mustCreateSubscription(t, manager, `{"city": "Madrid", "rule": {"type": "temperature_above", "threshold": 20, "units": "metric"}, "webhook_url": "`+hook.URL+`"}`)
+
+		manager.Poll(ctx)
+		if got := len(receiver.received()); got != 0 {
+			t.Fatalf("Expected no webhook below the threshold; got %d", got)
+		}
+
+		conditions.set(25, "Sunny")
+		manager.Poll(ctx)
+		deliveries := receiver.received()
+		if len(deliveries) != 1 {
+			t.Fatalf("Expected 1 webhook once the threshold is crossed; got %d", len(deliveries))
+		}
+
+		// Verify the signature the way a receiver would
+		delivery := deliveries[0]
+		timestamp, err := strconv.ParseInt(delivery.header.Get(routes.WebhookTimestampHeader), 10, 64)
+		if err != nil {
+			t.Fatalf("Invalid timestamp header: %v", err)
+		}
+		if got, want := delivery.header.Get(routes.WebhookSignatureHeader), routes.SignWebhook(sub.Secret, timestamp, delivery.body); got != want {
+			t.Errorf("Signature mismatch: got %s want %s", got, want)
+		}
+
+		var event routes.WebhookEvent
+		if err := json.Unmarshal(delivery.body, &event); err != nil {
+			t.Fatalf("Failed to parse webhook body: %v", err)
+		}
+		if event.Type != routes.RuleTemperatureAbove || event.SubscriptionID != sub.ID || event.Weather.Current.Temperature != 25 {
+			t.Errorf("Unexpected event: %+v", event)
+		}
+		if delivery.header.Get(routes.WebhookEventHeader) != event.ID {
+			t.Errorf("Expected event header %s; got %s", event.ID, delivery.header.Get(routes.WebhookEventHeader))
+		}
+
+		// Still above the threshold: no new event until it drops and rises again
+		manager.Poll(ctx)
+		conditions.set(10, "Sunny")
+		manager.Poll(ctx)
+		if got := len(receiver.received()); got != 1 {
+			t.Errorf("Expected no repeat webhooks; got %d deliveries", got)
+		}
+		conditions.set(22, "Sunny")
+		manager.Poll(ctx)
+		if got := len(receiver.received()); got != 2 {
+			t.Errorf("Expected a webhook when the threshold is crossed again; got %d deliveries", got)
+		}
+	})
+
+	t.Run("ConditionChange", func(t *testing.T) {
+		conditions := &mockConditions{tempC: 15, condition: "Sunny"}
+		weatherServer := startVariableWeatherAPIServer(conditions)
+		defer weatherServer.Close()
+		receiver := &webhookReceiver{}
+		hook := httptest.NewServer(receiver)
+		defer hook.Close()
+
+		manager := newTestSubscriptionManager(weatherServer)
+		mustCreateSubscription(t, manager, `{"city": "Oslo", "rule": {"type": "condition_change"}, "webhook_url": "`+hook.URL+`"}`)
+
+		manager.Poll(ctx)
+		manager.Poll(ctx)
+		if got := len(receiver.received()); got != 0 {
+			t.Fatalf("Expected no webhook while the condition is unchanged; got %d", got)
+		}
+
+		conditions.set(12, "Light rain")
+		manager.Poll(ctx)
+		deliveries := receiver.received()
+		if len(deliveries) != 1 {
+			t.Fatalf("Expected 1 webhook after the condition changed; got %d", len(deliveries))
+		}
+		var event routes.WebhookEvent
+		if err := json.Unmarshal(deliveries[0].body, &event); err != nil {
+			t.Fatalf("Failed to parse webhook body: %v", err)
+		}
+		if event.PreviousCondition != "Sunny" || event.Weather.Current.Condition != "Light rain" {
+			t.Errorf("Unexpected event: %+v", event)
+		}
+	})
+
+	t.Run("RetriesFailedDeliveries", func(t *testing.T) {
+		conditions := &mockConditions{tempC: -5, condition: "Snow"}
+		weatherServer := startVariableWeatherAPIServer(conditions)
+		defer weatherServer.Close()
+		receiver := &webhookReceiver{}
+		receiver.failures.Store(2)
+		hook := httptest.NewServer(receiver)
+		defer hook.Close()
+
+		manager := newTestSubscriptionManager(weatherServer)
+		sub := mustCreateSubscription(t, manager, `{"city": "Riga", "rule": {"type": "temperature_below", "threshold": 32}, "webhook_url": "`+hook.URL+`"}`)
+
+		manager.Poll(ctx)
+		deliveries := receiver.received()
+		if len(deliveries) != 3 {
+			t.Fatalf("Expected 3 delivery attempts; got %d", len(deliveries))
+		}
+		if deliveries[0].header.Get(routes.WebhookEventHeader) != deliveries[2].header.Get(routes.WebhookEventHeader) {
+			t.Error("Expected retries to keep the event ID")
+		}
+
+		w := serve(newTestRouter(routes.Services{Subscriptions: manager}), "GET", "/weather/subscriptions/"+sub.ID, "", "Authorization", "Bearer "+sub.Secret)
+		var got response.Envelope[routes.Subscription]
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("Failed to parse response body: %v", err)
+		}
+		last := got.Data.LastDelivery
+		if last == nil || last.Attempts != 3 || last.StatusCode != http.StatusOK || last.Error != "" {
+			t.Errorf("Unexpected last delivery: %+v", last)
+		}
+	})
+}
+
+func TestWebhookSenderBlocksInternalAddresses(t *testing.T) {
+	ctx := context.Background()
+	receiver := &webhookReceiver{}
+	hook := httptest.NewServer(receiver)
+	defer hook.Close()
+
+	t.Run("ConnectTime", func(t *testing.T) {
+		sender := routes.NewWebhookSender()
+		// A hostname is only resolved when the delivery connects
+		hookURL := strings.Replace(hook.URL, "127.0.0.1", "localhost", 1)
+		status := sender.Send(ctx, hookURL, "secret", "event-1", []byte(`{}`))
+		if status.Attempts != 1 || !strings.Contains(status.Error, routes.ErrWebhookAddressBlocked.Error()) {
+			t.Errorf("Expected one blocked attempt; got %+v", status)
+		}
+		if got := len(receiver.received()); got != 0 {
+			t.Errorf("Expected no delivery to a loopback address; got %d", got)
+		}
+	})
+
+	t.Run("Redirect", func(t *testing.T) {
+		redirect := httptest.NewServer(http.RedirectHandler(hook.URL, http.StatusFound))
+		defer redirect.Close()
+
+		sender := routes.NewWebhookSender()
+		sender.AllowPrivateNetworks = true
+		status := sender.Send(ctx, redirect.URL, "secret", "event-2", []byte(`{}`))
+		if status.StatusCode != http.StatusFound || status.Error == "" {
+			t.Errorf("Expected the redirect to be reported as a failure; got %+v", status)
+		}
+		if got := len(receiver.received()); got != 0 {
+			t.Errorf("Expected the redirect not to be followed; got %d deliveries", got)
+		}
+	})
+}
@@ -5,15 +5,31 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/jorge2751/GoAPI/internal/api/response"
 	"github.com/jorge2751/GoAPI/internal/api/routes"
 )
 
 // Mock WeatherAPI server
 func startMockWeatherAPIServer() *httptest.Server {
-	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	return httptest.NewServer(mockWeatherAPIHandler())
+}
+
+// newMockWeatherAPIProvider returns a WeatherAPI provider that talks to server
+func newMockWeatherAPIProvider(server *httptest.Server, apiKey string) *routes.WeatherAPIProvider {
+	provider := routes.NewWeatherAPIProvider(apiKey)
+	provider.HTTPClient = server.Client()
+	provider.BaseURL = server.URL // Set BaseURL to mock server
+	return provider
+}
+
+// mockWeatherAPIHandler simulates the WeatherAPI current.json endpoint
+func mockWeatherAPIHandler() http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		apiKey := r.URL.Query().Get("key")
 		city := r.URL.Query().Get("q")
 
@@ -29,23 +45,82 @@ func startMockWeatherAPIServer() *httptest.Server {
 			return
 		}
 
+		// Simulate WeatherAPI's coded error responses
+		switch {
+		case apiKey == "invalid-key":
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprintf(w, `{"error":{"code":2006,"message":"API key %s is invalid."}}`, apiKey)
+			return
+		case city == "unknowncity":
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintln(w, `{"error":{"code":1006,"message":"No matching location found."}}`)
+			return
+		case city == "quotacity":
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprintln(w, `{"error":{"code":2007,"message":"API key has exceeded calls per month quota."}}`)
+			return
+		}
+
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/forecast.json"):
+			days, _ := strconv.Atoi(r.URL.Query().Get("days"))
+			dates := make([]string, 0, days)
+			for i := 1; i <= days; i++ {
+				dates = append(dates, fmt.Sprintf("2030-01-%02d", i))
+			}
+			writeMockForecast(w, city, dates)
+			return
+		case strings.HasSuffix(r.URL.Path, "/history.json"):
+			writeMockForecast(w, city, []string{r.URL.Query().Get("dt")})
+			return
+		case strings.HasSuffix(r.URL.Path, "/astronomy.json"):
+			fmt.Fprintf(w, `{
+                "location": {"name": %q, "region": "Test Region", "country": "Test Country"},
+                "astronomy": {"astro": {
+                    "sunrise": "07:05 AM",
+                    "sunset": "05:30 PM",
+                    "moonrise": "No moonrise",
+                    "moonset": "10:15 AM",
+                    "moon_phase": "Waxing Crescent"
+                }}
+            }`, city)
+			return
+		}
+
 		// Simulate successful response for any other city
 		w.WriteHeader(http.StatusOK)
 		response := fmt.Sprintf(`{
             "location": {
                 "name": "%s",
                 "region": "Test Region",
-                "country": "Test Country"
+                "country": "Test Country",
+                "lat": 51.52,
+                "lon": -0.11,
+                "tz_id": "Europe/London",
+                "localtime": "2030-01-01 9:05"
             },
             "current": {
-                "temp_b": 15.0,
+                "temp_c": -9.4,
+                "temp_f": 15.0,
+                "feelslike_c": -12.0,
+                "feelslike_f": 10.4,
                 "condition": {
                     "text": "Partly cloudy"
-                }
+                },
+                "humidity": 72,
+                "wind_kph": 16.1,
+                "wind_mph": 10.0,
+                "wind_degree": 250,
+                "wind_dir": "WSW",
+                "pressure_mb": 1012.0,
+                "pressure_in": 29.88,
+                "uv": 1.0,
+                "vis_km": 10.0,
+                "vis_miles": 6.0
             }
         }`, city)
 		fmt.Fprintln(w, response)
-	}))
+	})
 }
 
 func TestWeatherHandler(t *testing.T) {
@@ -53,10 +128,8 @@ func TestWeatherHandler(t *testing.T) {
 	defer mockAPIServer.Close()
 
 	// Create a WeatherService instance pointing to the mock server
-	// We override the HTTPClient to ensure it hits our mock server
-	weatherService := routes.NewWeatherService("test-api-key")
-	weatherService.HTTPClient = mockAPIServer.Client()
-	weatherService.BaseURL = mockAPIServer.URL // Set BaseURL to mock server
+	// We override the provider's HTTPClient to ensure it hits our mock server
+	weatherService := routes.NewWeatherServiceWithProviders(newMockWeatherAPIProvider(mockAPIServer, "test-api-key"))
 
 	// --- Test Cases ---
 
@@ -70,19 +143,70 @@ func TestWeatherHandler(t *testing.T) {
 			t.Errorf("Expected status OK; got %v", w.Code)
 		}
 
-		var resp routes.WeatherAPIResponse
-		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		var body response.Envelope[routes.CurrentWeatherReport]
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
 			t.Fatalf("Failed to parse response body: %v", err)
 		}
+		resp := body.Data
 
 		if resp.Location.Name != "TestCity" {
 			t.Errorf("Expected location name TestCity; got %s", resp.Location.Name)
 		}
-		if resp.Current.TempF != 15.0 {
-			t.Errorf("Expected temp 15.0; got %f", resp.Current.TempF)
+		if resp.Location.Timezone != "Europe/London" || resp.Location.LocalTime != "2030-01-01 09:05" {
+			t.Errorf("Unexpected location time fields: %+v", resp.Location)
+		}
+		if resp.Units.System != routes.UnitsImperial {
+			t.Errorf("Expected default units imperial; got %s", resp.Units.System)
+		}
+		if resp.Current.Temperature != 15.0 {
+			t.Errorf("Expected temp 15.0; got %f", resp.Current.Temperature)
+		}
+		if resp.Current.WindSpeed != 10.0 || resp.Current.Pressure != 29.88 || resp.Current.Visibility != 6.0 {
+			t.Errorf("Expected imperial wind/pressure/visibility; got %+v", resp.Current)
+		}
+		if resp.Current.Condition != "Partly cloudy" {
+			t.Errorf("Expected condition Partly cloudy; got %s", resp.Current.Condition)
+		}
+		if resp.Provider != routes.ProviderWeatherAPI {
+			t.Errorf("Expected provider %s; got %s", routes.ProviderWeatherAPI, resp.Provider)
 		}
 	})
 
+	t.Run("MetricUnits", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/weather?city=TestCity&units=metric", nil)
+		w := httptest.NewRecorder()
+		weatherService.WeatherHandler(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status OK; got %v", w.Code)
+		}
+		var body response.Envelope[routes.CurrentWeatherReport]
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("Failed to parse response body: %v", err)
+		}
+		current := body.Data.Current
+		if current.Temperature != -9.4 || current.FeelsLike != -12.0 {
+			t.Errorf("Expected -9.4C feeling like -12C; got %v/%v", current.Temperature, current.FeelsLike)
+		}
+		if current.WindSpeed != 16.1 || current.Pressure != 1012.0 || current.Visibility != 10.0 {
+			t.Errorf("Expected metric wind/pressure/visibility; got %+v", current)
+		}
+		if body.Data.Units.Temperature != "C" || body.Data.Units.Speed != "km/h" {
+			t.Errorf("Unexpected unit labels: %+v", body.Data.Units)
+		}
+	})
+
+	t.Run("InvalidUnits", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/weather?city=TestCity&units=kelvin", nil)
+		w := httptest.NewRecorder()
+		weatherService.WeatherHandler(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status BadRequest; got %v", w.Code)
+		}
+		assertErrorCode(t, w.Body.Bytes(), response.CodeInvalidParameter)
+	})
+
 	// Test Case 2: Missing city parameter
 	t.Run("MissingCityParam", func(t *testing.T) {
 		req := httptest.NewRequest("GET", "/weather", nil)
@@ -95,13 +219,13 @@ func TestWeatherHandler(t *testing.T) {
 		if !strings.Contains(w.Body.String(), "Query parameter 'city' is required") {
 			t.Errorf("Expected error message about missing city; got %s", w.Body.String())
 		}
+		assertErrorCode(t, w.Body.Bytes(), response.CodeMissingParameter)
 	})
 
 	// Test Case 3: Missing API Key (in service config)
 	t.Run("MissingAPIKey", func(t *testing.T) {
 		// Create a service instance without an API key
-		badWeatherService := routes.NewWeatherService("")
-		badWeatherService.HTTPClient = mockAPIServer.Client()
+		badWeatherService := routes.NewWeatherServiceWithProviders(newMockWeatherAPIProvider(mockAPIServer, ""))
 
 		req := httptest.NewRequest("GET", "/weather?city=SomeCity", nil)
 		w := httptest.NewRecorder()
@@ -136,11 +260,156 @@ func TestWeatherHandler(t *testing.T) {
 		w := httptest.NewRecorder()
 		weatherService.WeatherHandler(w, req) // Use the original service with mock client
 
-		if w.Code != http.StatusInternalServerError {
-			t.Errorf("Expected status InternalServerError on API error; got %v", w.Code)
+		if w.Code != http.StatusBadGateway {
+			t.Errorf("Expected status BadGateway on API error; got %v", w.Code)
 		}
-		if !strings.Contains(w.Body.String(), "WeatherAPI request failed with status 500") {
+		if !strings.Contains(w.Body.String(), "Weather provider request failed with status 500") {
 			t.Errorf("Expected error message about API failure; got %s", w.Body.String())
 		}
+		if strings.Contains(w.Body.String(), "Internal API error simulation") {
+			t.Errorf("Expected the upstream body not to be echoed; got %s", w.Body.String())
+		}
+	})
+}
+
+// assertErrorCode checks that body is an error envelope with the given code
+func assertErrorCode(t *testing.T, body []byte, code string) {
+	t.Helper()
+
+	var envelope response.Envelope[any]
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		t.Fatalf("Failed to parse error body: %v", err)
+	}
+	if envelope.Status != response.StatusError {
+		t.Errorf("Expected status %q; got %q", response.StatusError, envelope.Status)
+	}
+	if envelope.Error == nil || envelope.Error.Code != code {
+		t.Errorf("Expected error code %q; got %+v", code, envelope.Error)
+	}
+}
+
+// writeMockForecast writes a WeatherAPI forecast response with one entry per date
+func writeMockForecast(w http.ResponseWriter, city string, dates []string) {
+	forecastDays := make([]string, 0, len(dates))
+	for _, date := range dates {
+		forecastDays = append(forecastDays, fmt.Sprintf(`{
+            "date": %q,
+            "day": {
+                "maxtemp_c": 20.0, "maxtemp_f": 68.0,
+                "mintemp_c": 10.0, "mintemp_f": 50.0,
+                "totalprecip_mm": 1.5,
+                "daily_chance_of_rain": 40,
+                "condition": {"text": "Sunny"}
+            }
+        }`, date))
+	}
+	fmt.Fprintf(w, `{
+        "location": {"name": %q, "region": "Test Region", "country": "Test Country"},
+        "forecast": {"forecastday": [%s]}
+    }`, city, strings.Join(forecastDays, ","))
+}
+
+func TestWeatherForecastHandlers(t *testing.T) {
+	mockAPIServer := startMockWeatherAPIServer()
+	defer mockAPIServer.Close()
+
+	weatherService := routes.NewWeatherServiceWithProviders(newMockWeatherAPIProvider(mockAPIServer, "test-api-key"))
+	router := newTestRouter(routes.Services{Weather: weatherService})
+
+	t.Run("Forecast", func(t *testing.T) {
+		w := serve(router, "GET", "/weather/forecast?city=TestCity&days=5", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status OK; got %v: %s", w.Code, w.Body.String())
+		}
+
+		var body response.Envelope[routes.WeatherForecast]
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("Failed to parse response body: %v", err)
+		}
+		if len(body.Data.Days) != 5 {
+			t.Fatalf("Expected 5 forecast days; got %d", len(body.Data.Days))
+		}
+		day := body.Data.Days[0]
+		if day.Date != "2030-01-01" || day.MaxTempC != 20 || day.MinTempF != 50 || day.Condition != "Sunny" {
+			t.Errorf("Unexpected first day: %+v", day)
+		}
+		if day.ChanceOfRain == nil || *day.ChanceOfRain != 40 {
+			t.Errorf("Expected 40%% chance of rain; got %v", day.ChanceOfRain)
+		}
+		if body.Data.Location.Name != "TestCity" {
+			t.Errorf("Expected location TestCity; got %s", body.Data.Location.Name)
+		}
+	})
+
+	t.Run("ForecastDefaultDays", func(t *testing.T) {
+		var body response.Envelope[routes.WeatherForecast]
+		json.Unmarshal(serve(router, "GET", "/weather/forecast?city=TestCity", "").Body.Bytes(), &body)
+		if len(body.Data.Days) != routes.DefaultForecastDays {
+			t.Errorf("Expected %d forecast days by default; got %d", routes.DefaultForecastDays, len(body.Data.Days))
+		}
+	})
+
+	t.Run("History", func(t *testing.T) {
+		date := time.Now().UTC().AddDate(0, 0, -3).Format("2006-01-02")
+		w := serve(router, "GET", "/weather/history?city=TestCity&date="+date, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status OK; got %v: %s", w.Code, w.Body.String())
+		}
+
+		var body response.Envelope[routes.WeatherHistory]
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("Failed to parse response body: %v", err)
+		}
+		if body.Data.Day.Date != date || body.Data.Day.MaxTempF != 68 {
+			t.Errorf("Unexpected history day: %+v", body.Data.Day)
+		}
+		if body.Data.Day.ChanceOfRain != nil {
+			t.Errorf("Expected no chance of rain for a past day; got %v", *body.Data.Day.ChanceOfRain)
+		}
+	})
+
+	t.Run("Astronomy", func(t *testing.T) {
+		w := serve(router, "GET", "/weather/astronomy?city=TestCity&date=2030-06-21", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status OK; got %v: %s", w.Code, w.Body.String())
+		}
+
+		var body response.Envelope[routes.WeatherAstronomy]
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("Failed to parse response body: %v", err)
+		}
+		astro := body.Data
+		if astro.Date != "2030-06-21" || astro.Sunrise != "07:05" || astro.Sunset != "17:30" {
+			t.Errorf("Unexpected sun times: %+v", astro)
+		}
+		if astro.Moonrise != "" || astro.Moonset != "10:15" || astro.MoonPhase != "Waxing Crescent" {
+			t.Errorf("Unexpected moon data: %+v", astro)
+		}
+	})
+
+	t.Run("InvalidParameters", func(t *testing.T) {
+		future := time.Now().UTC().AddDate(0, 0, 2).Format("2006-01-02")
+		cases := []struct {
+			target string
+			code   string
+		}{
+			{"/weather/forecast", response.CodeMissingParameter},
+			{"/weather/forecast?city=TestCity&days=0", response.CodeInvalidParameter},
+			{"/weather/forecast?city=TestCity&days=15", response.CodeInvalidParameter},
+			{"/weather/forecast?city=TestCity&days=three", response.CodeInvalidParameter},
+			{"/weather/history?city=TestCity", response.CodeMissingParameter},
+			{"/weather/history?city=TestCity&date=01/02/2024", response.CodeInvalidParameter},
+			{"/weather/history?city=TestCity&date=" + future, response.CodeInvalidParameter},
+			{"/weather/history?city=TestCity&date=2001-01-01", response.CodeInvalidParameter},
+			{"/weather/astronomy?city=TestCity&date=tomorrow", response.CodeInvalidParameter},
+		}
+		for _, tc := range cases {
+			w := serve(router, "GET", tc.target, "")
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("%s: expected status 400; got %v", tc.target, w.Code)
+				continue
+			}
+			assertErrorCode(t, w.Body.Bytes(), tc.code)
+		}
 	})
 }
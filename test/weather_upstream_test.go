@@ -0,0 +1,168 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jorge2751/GoAPI/internal/api/response"
+	"github.com/jorge2751/GoAPI/internal/api/routes"
+)
+
+// startFlakyWeatherAPIServer fails the first failures requests with status, then behaves like the mock WeatherAPI
+func startFlakyWeatherAPIServer(calls *atomic.Int32, failures int32, status int, retryAfter string) *httptest.Server {
+	handler := mockWeatherAPIHandler()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= failures {
+			if retryAfter != "" {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			w.WriteHeader(status)
+			return
+		}
+		handler(w, r)
+	}))
+}
+
+// fastRetryPolicy keeps retry tests quick
+var fastRetryPolicy = routes.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}
+
+func TestWeatherRetries(t *testing.T) {
+	t.Run("RetriesServerErrors", func(t *testing.T) {
+		var calls atomic.Int32
+		server := startFlakyWeatherAPIServer(&calls, 2, http.StatusServiceUnavailable, "")
+		defer server.Close()
+
+		provider := newMockWeatherAPIProvider(server, "test-api-key")
+		provider.Retry = fastRetryPolicy
+		weatherService := routes.NewWeatherServiceWithProviders(provider)
+		weatherService.Cache = nil
+
+		w := getWeather(weatherService, "Madrid")
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status OK after retries; got %v: %s", w.Code, w.Body.String())
+		}
+		if got := calls.Load(); got != 3 {
+			t.Errorf("Expected 3 upstream attempts; got %d", got)
+		}
+		if got := provider.Status().Retries; got != 2 {
+			t.Errorf("Expected 2 retries; got %d", got)
+		}
+	})
+
+	t.Run("HonorsRetryAfter", func(t *testing.T) {
+		var calls atomic.Int32
+		server := startFlakyWeatherAPIServer(&calls, 1, http.StatusTooManyRequests, "0")
+		defer server.Close()
+
+		provider := newMockWeatherAPIProvider(server, "test-api-key")
+		provider.Retry = fastRetryPolicy
+		weatherService := routes.NewWeatherServiceWithProviders(provider)
+		weatherService.Cache = nil
+
+		if w := getWeather(weatherService, "Lima"); w.Code != http.StatusOK {
+			t.Errorf("Expected status OK after 429 retry; got %v", w.Code)
+		}
+		if got := calls.Load(); got != 2 {
+			t.Errorf("Expected 2 upstream attempts; got %d", got)
+		}
+	})
+
+	t.Run("GivesUpWhenRetryAfterTooLong", func(t *testing.T) {
+		var calls atomic.Int32
+		server := startFlakyWeatherAPIServer(&calls, 1, http.StatusTooManyRequests, "3600")
+		defer server.Close()
+
+		provider := newMockWeatherAPIProvider(server, "test-api-key")
+		provider.Retry = fastRetryPolicy
+		weatherService := routes.NewWeatherServiceWithProviders(provider)
+		weatherService.Cache = nil
+
+		if w := getWeather(weatherService, "Quito"); w.Code == http.StatusOK {
+			t.Errorf("Expected failure when Retry-After exceeds the retry policy")
+		}
+		if got := calls.Load(); got != 1 {
+			t.Errorf("Expected 1 upstream attempt; got %d", got)
+		}
+	})
+
+	t.Run("DoesNotRetryClientErrors", func(t *testing.T) {
+		var calls atomic.Int32
+		server := startFlakyWeatherAPIServer(&calls, 5, http.StatusBadRequest, "")
+		defer server.Close()
+
+		provider := newMockWeatherAPIProvider(server, "test-api-key")
+		provider.Retry = fastRetryPolicy
+		weatherService := routes.NewWeatherServiceWithProviders(provider)
+		weatherService.Cache = nil
+
+		getWeather(weatherService, "Bogota")
+		if got := calls.Load(); got != 1 {
+			t.Errorf("Expected 1 upstream attempt for a 400; got %d", got)
+		}
+	})
+}
+
+func TestWeatherCircuitBreaker(t *testing.T) {
+	var calls atomic.Int32
+	server := startFlakyWeatherAPIServer(&calls, 2, http.StatusInternalServerError, "")
+	defer server.Close()
+
+	provider := newMockWeatherAPIProvider(server, "test-api-key")
+	provider.Retry = routes.RetryPolicy{MaxAttempts: 1}
+	provider.Breaker = routes.NewCircuitBreaker(2, 100*time.Millisecond)
+	weatherService := routes.NewWeatherServiceWithProviders(provider)
+	weatherService.Cache = nil
+	router := newTestRouter(routes.Services{Weather: weatherService, Debug: true})
+
+	debugState := func() string {
+		t.Helper()
+		rr := serve(router, "GET", "/debug/weather", "")
+
+		var body response.Envelope[struct {
+			Providers []struct {
+				Name    string                 `json:"name"`
+				Breaker routes.BreakerSnapshot `json:"circuit_breaker"`
+			} `json:"providers"`
+		}]
+		if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+			t.Fatalf("Failed to parse debug response: %v", err)
+		}
+		if len(body.Data.Providers) != 1 || body.Data.Providers[0].Name != routes.ProviderWeatherAPI {
+			t.Fatalf("Expected the WeatherAPI provider in debug output; got %+v", body.Data.Providers)
+		}
+		return body.Data.Providers[0].Breaker.State
+	}
+
+	// Two failures open the circuit
+	getWeather(weatherService, "Oslo")
+	getWeather(weatherService, "Oslo")
+	if state := debugState(); state != "open" {
+		t.Fatalf("Expected breaker to be open; got %q", state)
+	}
+
+	// While open, requests fail fast without reaching the upstream
+	w := getWeather(weatherService, "Oslo")
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 while open; got %v", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("Expected Retry-After header while open")
+	}
+	assertErrorCode(t, w.Body.Bytes(), response.CodeUpstreamUnavailable)
+	if got := calls.Load(); got != 2 {
+		t.Errorf("Expected no upstream call while open; got %d calls", got)
+	}
+
+	// After the cooldown a trial request succeeds and closes the circuit
+	time.Sleep(120 * time.Millisecond)
+	if w := getWeather(weatherService, "Oslo"); w.Code != http.StatusOK {
+		t.Errorf("Expected trial request to succeed; got %v", w.Code)
+	}
+	if state := debugState(); state != "closed" {
+		t.Errorf("Expected breaker to be closed; got %q", state)
+	}
+}